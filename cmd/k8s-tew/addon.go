@@ -0,0 +1,83 @@
+package main
+
+import (
+	"os"
+
+	"github.com/darxkies/k8s-tew/pkg/manifest"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var addonKeepPersistentVolumeClaims bool
+
+var addonCmd = &cobra.Command{
+	Use:   "addon",
+	Short: "Manage the addons installed in the cluster",
+}
+
+var addonListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the installed addons",
+	Run: func(cmd *cobra.Command, args []string) {
+		if error := bootstrap(false); error != nil {
+			log.WithFields(log.Fields{"error": error}).Error("Failed initializing")
+
+			os.Exit(-1)
+		}
+
+		applier, error := manifest.NewApplier(_config)
+		if error != nil {
+			log.WithFields(log.Fields{"error": error}).Error("Failed listing addons")
+
+			os.Exit(-2)
+		}
+
+		applySets, error := applier.ListAddons()
+		if error != nil {
+			log.WithFields(log.Fields{"error": error}).Error("Failed listing addons")
+
+			os.Exit(-2)
+		}
+
+		for _, applySet := range applySets {
+			log.WithFields(log.Fields{"name": applySet.Name, "feature": applySet.Feature, "namespaces": applySet.Namespaces}).Info("Addon")
+		}
+	},
+}
+
+var addonUninstallCmd = &cobra.Command{
+	Use:   "uninstall <name>",
+	Short: "Uninstall an addon",
+	Long:  "Delete all objects that were applied for the addon. The name is the name of the setup command in the configuration (e.g. efk-setup).",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if error := bootstrap(false); error != nil {
+			log.WithFields(log.Fields{"error": error}).Error("Failed initializing")
+
+			os.Exit(-1)
+		}
+
+		applier, error := manifest.NewApplier(_config)
+		if error != nil {
+			log.WithFields(log.Fields{"error": error}).Error("Failed uninstalling addon")
+
+			os.Exit(-2)
+		}
+
+		if error := applier.Uninstall(args[0], addonKeepPersistentVolumeClaims); error != nil {
+			log.WithFields(log.Fields{"addon": args[0], "error": error}).Error("Failed uninstalling addon")
+
+			os.Exit(-3)
+		}
+
+		log.Info("Done")
+	},
+}
+
+func init() {
+	addonUninstallCmd.Flags().BoolVar(&addonKeepPersistentVolumeClaims, "keep-pvcs", false, "Keep the persistent volume claims and the namespaces containing them")
+	addonCmd.AddCommand(addonListCmd)
+	addonCmd.AddCommand(addonUninstallCmd)
+	RootCmd.AddCommand(addonCmd)
+}
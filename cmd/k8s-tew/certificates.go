@@ -0,0 +1,310 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+
+	"github.com/darxkies/k8s-tew/deployment"
+	"github.com/darxkies/k8s-tew/generate"
+	"github.com/darxkies/k8s-tew/utils"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var rotateCertificates []string
+var rotateCA string
+var rotateEtcdCA bool
+var rotateSkipDeploy bool
+var statusThreshold uint
+var statusJSON bool
+var statusProbe bool
+var importCAName string
+var importCACertificate string
+var importCAKey string
+var importCAChain string
+var csrDirectory string
+var exportAllCSRs bool
+
+var certificatesCmd = &cobra.Command{
+	Use:   "certificates",
+	Short: "Manage the cluster certificates",
+}
+
+var certificatesRotateCmd = &cobra.Command{
+	Use:   "rotate",
+	Short: "Reissue certificates and push them to the nodes",
+	Long:  "Reissue the leaf certificates (all except service-account, or the selected ones) and the kubeconfigs, then push them to one node at a time and restart the components using them. With --ca, the rotation of the cluster CA, or of the CA given with --ca=etcd-ca or --ca=front-proxy-ca, is moved one stage further (trust, switch, finish) instead. With --etcd-ca, etcd of a cluster generated before it had its own CA is moved one stage further to it (trust, switch, finish). A stage that was not deployed successfully is deployed again by the next call instead of moving further.",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if error := bootstrap(false); error != nil {
+			log.WithFields(log.Fields{"error": error}).Error("Failed initializing")
+
+			os.Exit(-1)
+		}
+
+		generator := generate.NewGenerator(_config)
+
+		var state *deployment.RotationState
+
+		if rotateEtcdCA || len(rotateCA) > 0 {
+			name := rotateCA
+
+			if rotateEtcdCA {
+				name = utils.EtcdCaMigration
+			}
+
+			var error error
+
+			if state, error = deployment.LoadRotationState(_config.GetFullLocalAssetFilename(utils.CARotationState)); error != nil {
+				log.WithFields(log.Fields{"error": error}).Error("Failed rotating CA")
+
+				os.Exit(-2)
+			}
+
+			if error := generateCAStage(generator, state, name); error != nil {
+				log.WithFields(log.Fields{"error": error, "name": name}).Error("Failed rotating CA")
+
+				os.Exit(-2)
+			}
+
+		} else {
+			if error := generator.RotateCertificates(rotateCertificates); error != nil {
+				log.WithFields(log.Fields{"error": error, "certificates": generator.GetCertificateNames()}).Error("Failed rotating certificates")
+
+				os.Exit(-2)
+			}
+		}
+
+		if rotateSkipDeploy {
+			log.Info("Done")
+
+			return
+		}
+
+		_deployment := deployment.NewDeployment(_config, identityFile, false, false, false, commandRetries, skipPreflight, true, false, false, false, false, false, false, false)
+
+		rotation := deployment.NewRotation(_config, _deployment, commandRetries)
+
+		utils.SetProgressSteps(rotation.Steps() + 1)
+
+		utils.ShowProgress()
+
+		if error := rotation.Run(); error != nil {
+			log.WithFields(log.Fields{"error": error}).Error("Failed pushing certificates")
+
+			os.Exit(-3)
+		}
+
+		if state != nil {
+			if error := state.Finish(); error != nil {
+				log.WithFields(log.Fields{"error": error}).Error("Failed pushing certificates")
+
+				os.Exit(-3)
+			}
+		}
+
+		utils.HideProgress()
+
+		log.Info("Done")
+	},
+}
+
+// getCAStage returns the stage the CA rotation or the etcd CA migration moves to next
+func getCAStage(generator *generate.Generator, name string) (string, error) {
+	if name == utils.EtcdCaMigration {
+		return generator.GetEtcdCAMigrationStage(), nil
+	}
+
+	return generator.GetCARotationStage(name)
+}
+
+// generateCAStage moves the CA rotation or the etcd CA migration one stage further. A stage that was generated but not
+// deployed yet is deployed again instead, its files are generated again only if the generation was interrupted.
+func generateCAStage(generator *generate.Generator, state *deployment.RotationState, name string) error {
+	stage, error := getCAStage(generator, name)
+	if error != nil {
+		return error
+	}
+
+	if state.IsPending() {
+		if state.Name != name {
+			return fmt.Errorf("The stage '%s' of '%s' was not deployed yet, run the rotation of '%s' again first", state.Stage, state.Name, state.Name)
+		}
+
+		if stage != state.Stage {
+			log.WithFields(log.Fields{"name": name, "stage": state.Stage}).Info("Deploying the pending stage again")
+
+			return generator.RegenerateCAFiles()
+		}
+	}
+
+	if len(stage) == 0 {
+		return fmt.Errorf("Etcd uses its own CA already")
+	}
+
+	if error := state.Generated(name, stage); error != nil {
+		return error
+	}
+
+	if name == utils.EtcdCaMigration {
+		_, error = generator.MigrateEtcdCA()
+
+	} else {
+		_, error = generator.RotateCA(name)
+	}
+
+	if error != nil {
+		return error
+	}
+
+	next, error := getCAStage(generator, name)
+	if error != nil {
+		return error
+	}
+
+	log.WithFields(log.Fields{"name": name, "stage": stage, "next-stage": next}).Info("CA stage generated")
+
+	return nil
+}
+
+var certificatesStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show the certificates and when they expire",
+	Long:  "List the CAs, the leaf certificates and the certificates embedded in the kubeconfigs. Certificates expiring within the threshold, not signed by a trusted CA or with SANs not matching the nodes are flagged. The exit code is 1 if any certificate was flagged.",
+	Run: func(cmd *cobra.Command, args []string) {
+		if error := bootstrap(false); error != nil {
+			log.WithFields(log.Fields{"error": error}).Error("Failed initializing")
+
+			os.Exit(-1)
+		}
+
+		statuses, error := generate.NewGenerator(_config).GetCertificateStatuses(statusThreshold, statusProbe)
+		if error != nil {
+			log.WithFields(log.Fields{"error": error}).Error("Failed checking certificates")
+
+			os.Exit(-2)
+		}
+
+		if statusJSON {
+			content, error := json.MarshalIndent(statuses, "", "  ")
+			if error != nil {
+				log.WithFields(log.Fields{"error": error}).Error("Failed checking certificates")
+
+				os.Exit(-2)
+			}
+
+			fmt.Println(string(content))
+
+		} else {
+			statuses.Dump()
+		}
+
+		if statuses.Problems() > 0 {
+			os.Exit(1)
+		}
+	},
+}
+
+var certificatesImportCACmd = &cobra.Command{
+	Use:   "import-ca",
+	Short: "Replace a CA with an existing one",
+	Long:  "Replace a CA with an existing root or intermediate CA. The chain is appended to the CA bundle and to the issued certificates. Without a private key, the certificates have to be signed externally using export-csr and import. A CA that exists already is imported as the next CA and moved in place with rotate --ca=<name>.",
+	Run: func(cmd *cobra.Command, args []string) {
+		if error := bootstrap(false); error != nil {
+			log.WithFields(log.Fields{"error": error}).Error("Failed initializing")
+
+			os.Exit(-1)
+		}
+
+		if error := generate.NewGenerator(_config).ImportCA(importCAName, importCACertificate, importCAKey, importCAChain); error != nil {
+			log.WithFields(log.Fields{"error": error}).Error("Failed importing CA")
+
+			os.Exit(-2)
+		}
+
+		log.Info("Done")
+	},
+}
+
+var certificatesExportCSRCmd = &cobra.Command{
+	Use:   "export-csr",
+	Short: "Export the certificate signing requests for the external CAs",
+	Long:  "Write the certificate signing requests of the certificates issued by CAs imported without private key. Only the certificates that are missing, not issued by the current CA or not matching the nodes are exported, unless --all is set.",
+	Run: func(cmd *cobra.Command, args []string) {
+		if error := bootstrap(false); error != nil {
+			log.WithFields(log.Fields{"error": error}).Error("Failed initializing")
+
+			os.Exit(-1)
+		}
+
+		if error := utils.CreateDirectoryIfMissing(csrDirectory); error != nil {
+			log.WithFields(log.Fields{"error": error}).Error("Failed exporting certificate signing requests")
+
+			os.Exit(-2)
+		}
+
+		count, error := generate.NewGenerator(_config).ExportCertificateSigningRequests(csrDirectory, exportAllCSRs)
+		if error != nil {
+			log.WithFields(log.Fields{"error": error}).Error("Failed exporting certificate signing requests")
+
+			os.Exit(-2)
+		}
+
+		log.WithFields(log.Fields{"count": count, "directory": csrDirectory}).Info("Certificate signing requests exported")
+	},
+}
+
+var certificatesImportCmd = &cobra.Command{
+	Use:   "import",
+	Short: "Import externally signed certificates",
+	Long:  "Import the certificates signed for the exported certificate signing requests. The files need the names of the requests with the extension .pem.",
+	Run: func(cmd *cobra.Command, args []string) {
+		if error := bootstrap(false); error != nil {
+			log.WithFields(log.Fields{"error": error}).Error("Failed initializing")
+
+			os.Exit(-1)
+		}
+
+		count, error := generate.NewGenerator(_config).ImportCertificates(csrDirectory)
+		if error != nil {
+			log.WithFields(log.Fields{"error": error}).Error("Failed importing certificates")
+
+			os.Exit(-2)
+		}
+
+		log.WithFields(log.Fields{"count": count, "directory": csrDirectory}).Info("Certificates imported")
+	},
+}
+
+func init() {
+	certificatesImportCACmd.Flags().StringVar(&importCAName, "name", "ca", "The CA to replace (ca, etcd-ca or front-proxy-ca)")
+	certificatesImportCACmd.Flags().StringVar(&importCACertificate, "certificate", "", "The CA certificate, optionally followed by its issuers")
+	certificatesImportCACmd.Flags().StringVar(&importCAKey, "key", "", "The private key of the CA. If omitted, the certificates are signed externally")
+	certificatesImportCACmd.Flags().StringVar(&importCAChain, "chain", "", "The issuers of the CA up to the root")
+	certificatesImportCACmd.MarkFlagRequired("certificate")
+	certificatesCmd.AddCommand(certificatesImportCACmd)
+	certificatesExportCSRCmd.Flags().StringVarP(&csrDirectory, "directory", "d", "", "The directory the certificate signing requests are written to")
+	certificatesExportCSRCmd.Flags().BoolVar(&exportAllCSRs, "all", false, "Export the requests of all certificates")
+	certificatesExportCSRCmd.MarkFlagRequired("directory")
+	certificatesCmd.AddCommand(certificatesExportCSRCmd)
+	certificatesImportCmd.Flags().StringVarP(&csrDirectory, "directory", "d", "", "The directory containing the signed certificates")
+	certificatesImportCmd.MarkFlagRequired("directory")
+	certificatesCmd.AddCommand(certificatesImportCmd)
+	certificatesStatusCmd.Flags().UintVar(&statusThreshold, "threshold", 30, "Flag certificates expiring within this count of days")
+	certificatesStatusCmd.Flags().BoolVar(&statusJSON, "json", false, "Print the status as JSON")
+	certificatesStatusCmd.Flags().BoolVar(&statusProbe, "probe", false, "Compare the certificates served by the API servers, etcd and the kubelets with the local ones")
+	certificatesCmd.AddCommand(certificatesStatusCmd)
+	certificatesRotateCmd.Flags().StringVarP(&identityFile, "identity-file", "i", path.Join(os.Getenv("HOME"), ".ssh/id_rsa"), "SSH identity file")
+	certificatesRotateCmd.Flags().UintVarP(&commandRetries, "command-retries", "r", 300, "The count of seconds to wait for a node to recover")
+	certificatesRotateCmd.Flags().StringSliceVarP(&rotateCertificates, "certificate", "c", []string{}, "Reissue only the named certificate (admin, aggregator, controller-manager, etcd-client, etcd-peer, etcd-server, kubelet, kubernetes, proxy, scheduler, service-account), can be repeated")
+	certificatesRotateCmd.Flags().StringVar(&rotateCA, "ca", "", "Move the rotation of the CA (ca, etcd-ca or front-proxy-ca) one stage further")
+	certificatesRotateCmd.Flags().Lookup("ca").NoOptDefVal = "ca"
+	certificatesRotateCmd.Flags().BoolVar(&rotateEtcdCA, "etcd-ca", false, "Move etcd one stage further to its own CA")
+	certificatesRotateCmd.Flags().BoolVar(&rotateSkipDeploy, "skip-deploy", false, "Only generate the files locally")
+	certificatesRotateCmd.Flags().BoolVar(&skipPreflight, "skip-preflight", false, "Skip the preflight checks")
+	certificatesCmd.AddCommand(certificatesRotateCmd)
+	RootCmd.AddCommand(certificatesCmd)
+}
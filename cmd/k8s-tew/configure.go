@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
 
 	"github.com/darxkies/k8s-tew/utils"
 	log "github.com/sirupsen/logrus"
@@ -79,6 +80,86 @@ func init() {
 		_config.Config.RSASize = value
 	})
 
+	addStringOption("key-algorithm", utils.KeyAlgorithmRSA, "Key algorithm of the certificates (rsa, ecdsa-p256 or ecdsa-p384)", func(value string) {
+		_config.Config.KeyAlgorithm = value
+	})
+
+	addStringOption("oidc-issuer-url", "", "OIDC issuer URL, enables the OIDC authentication", func(value string) {
+		_config.Config.OIDC.IssuerURL = value
+	})
+
+	addStringOption("oidc-client-id", "", "OIDC client id", func(value string) {
+		_config.Config.OIDC.ClientID = value
+	})
+
+	addStringOption("oidc-username-claim", "", "OIDC claim used as user name", func(value string) {
+		_config.Config.OIDC.UsernameClaim = value
+	})
+
+	addStringOption("oidc-username-prefix", "", "OIDC prefix of the user names", func(value string) {
+		_config.Config.OIDC.UsernamePrefix = value
+	})
+
+	addStringOption("oidc-groups-claim", "", "OIDC claim used as groups", func(value string) {
+		_config.Config.OIDC.GroupsClaim = value
+	})
+
+	addStringOption("oidc-groups-prefix", "", "OIDC prefix of the groups", func(value string) {
+		_config.Config.OIDC.GroupsPrefix = value
+	})
+
+	addStringOption("oidc-ca-file", "", "CA of the OIDC provider", func(value string) {
+		_config.Config.OIDC.CAFile = value
+	})
+
+	addStringOption("audit-policy", utils.AuditPolicyMetadata, "Preset of the audit policy (minimal, metadata or request-response)", func(value string) {
+		_config.Config.Audit.Policy = value
+	})
+
+	addStringOption("audit-policy-file", "", "Custom audit policy, replaces the preset", func(value string) {
+		_config.Config.Audit.PolicyFile = value
+	})
+
+	addStringOption("audit-log-path", "", "Audit log on the controllers, by default in the logging directory", func(value string) {
+		_config.Config.Audit.LogPath = value
+	})
+
+	addUint16Option("audit-log-max-age", utils.AuditMaxAge, "Days the rotated audit logs are kept", func(value uint16) {
+		_config.Config.Audit.MaxAge = uint(value)
+	})
+
+	addUint16Option("audit-log-max-size", utils.AuditMaxSize, "Size in megabytes of the audit log before it is rotated", func(value uint16) {
+		_config.Config.Audit.MaxSize = uint(value)
+	})
+
+	addUint16Option("audit-log-max-backups", utils.AuditMaxBackups, "Count of rotated audit logs kept", func(value uint16) {
+		_config.Config.Audit.MaxBackups = uint(value)
+	})
+
+	addStringOption("audit-webhook-url", "", "URL of the audit webhook backend, empty disables it", func(value string) {
+		_config.Config.Audit.WebhookURL = value
+	})
+
+	addStringOption("audit-webhook-ca-file", "", "CA of the audit webhook backend", func(value string) {
+		_config.Config.Audit.WebhookCAFile = value
+	})
+
+	addStringOption("encryption-kms-name", "", "Name of the KMS plugin encrypting the secrets", func(value string) {
+		_config.Config.EncryptionKMS.Name = value
+	})
+
+	addStringOption("encryption-kms-endpoint", "", "Socket of the KMS plugin like unix:///var/run/kms-plugin/socket.sock, empty disables it", func(value string) {
+		_config.Config.EncryptionKMS.Endpoint = value
+	})
+
+	addUint16Option("encryption-kms-cache-size", 0, "Count of data encryption keys cached by the API servers, 0 uses the default", func(value uint16) {
+		_config.Config.EncryptionKMS.CacheSize = uint(value)
+	})
+
+	addStringOption("encryption-kms-timeout", "", "Timeout of the calls to the KMS plugin like 3s", func(value string) {
+		_config.Config.EncryptionKMS.Timeout = value
+	})
+
 	addUint16Option("ca-certificate-validity-period", utils.CaValidityPeriod, "CA Certificate Validity Period", func(value uint16) {
 		_config.Config.CAValidityPeriod = uint(value)
 	})
@@ -87,6 +168,18 @@ func init() {
 		_config.Config.ClientValidityPeriod = uint(value)
 	})
 
+	addUint16Option("revisions", utils.Revisions, "Count of previous asset revisions kept on the nodes for rollbacks", func(value uint16) {
+		_config.Config.Revisions = uint(value)
+	})
+
+	addUint16Option("etcd-snapshot-interval", 0, "Interval in hours between etcd snapshots taken by the bootstrapper, 0 disables them", func(value uint16) {
+		_config.Config.EtcdSnapshotInterval = uint(value)
+	})
+
+	addUint16Option("etcd-snapshot-retention", utils.EtcdSnapshotRetention, "Count of scheduled etcd snapshots kept", func(value uint16) {
+		_config.Config.EtcdSnapshotRetention = uint(value)
+	})
+
 	addUint16Option("apiserver-port", utils.PortApiServer, "API Server Port", func(value uint16) {
 		_config.Config.APIServerPort = value
 	})
@@ -123,6 +216,20 @@ func init() {
 		_config.Config.WorkerVirtualIPInterface = value
 	})
 
+	addStringOption("etcd-snapshot-storage", utils.EtcdSnapshotStorageLocal, "Storage of the etcd snapshots (local or minio)", func(value string) {
+		_config.Config.EtcdSnapshotStorage = value
+	})
+
+	addStringOption("extra-sans", "", "Comma separated DNS names and IP addresses added to the API server certificate", func(value string) {
+		_config.Config.ExtraSANs = []string{}
+
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); len(name) > 0 {
+				_config.Config.ExtraSANs = append(_config.Config.ExtraSANs, name)
+			}
+		}
+	})
+
 	addStringOption("cluster-domain", utils.ClusterDomain, "Cluster domain", func(value string) {
 		_config.Config.ClusterDomain = value
 	})
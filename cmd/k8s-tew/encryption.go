@@ -0,0 +1,144 @@
+package main
+
+import (
+	"os"
+	"path"
+
+	"github.com/darxkies/k8s-tew/deployment"
+	"github.com/darxkies/k8s-tew/generate"
+	"github.com/darxkies/k8s-tew/utils"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var encryptionCmd = &cobra.Command{
+	Use:   "encryption",
+	Short: "Manage the encryption of the secrets",
+}
+
+var encryptionRotateCmd = &cobra.Command{
+	Use:   "rotate",
+	Short: "Replace the key encrypting the secrets",
+	Long:  "Add a new key, make it the primary key, rewrite all secrets and drop the old key. The encryption config is pushed to one controller at a time after each stage and the API servers are restarted. An interrupted rotation first rolls out the stage generated last, then it continues with the next stage.",
+	Run: func(cmd *cobra.Command, args []string) {
+		if error := bootstrap(false); error != nil {
+			log.WithFields(log.Fields{"error": error}).Error("Failed initializing")
+
+			os.Exit(-1)
+		}
+
+		generator := generate.NewGenerator(_config)
+
+		state, error := deployment.LoadRotationState(_config.GetFullLocalAssetFilename(utils.EncryptionRotationState))
+		if error != nil {
+			log.WithFields(log.Fields{"error": error}).Error("Failed rotating encryption key")
+
+			os.Exit(-2)
+		}
+
+		stage, error := generator.GetEncryptionRotationStage()
+		if error != nil {
+			log.WithFields(log.Fields{"error": error}).Error("Failed rotating encryption key")
+
+			os.Exit(-2)
+		}
+
+		// An interrupted rotation first rolls out the stage generated last
+		if state.IsPending() {
+			log.WithFields(log.Fields{"stage": state.Stage}).Info("Continuing encryption key rotation")
+
+			stage = state.Stage
+		}
+
+		stages := []string{utils.EncryptionRotationAdd, utils.EncryptionRotationPromote, utils.EncryptionRotationDrop}
+
+		for len(stages) > 0 && stages[0] != stage {
+			stages = stages[1:]
+		}
+
+		_deployment := deployment.NewDeployment(_config, identityFile, false, false, false, commandRetries, skipPreflight, true, false, false, false, false, false, false, false)
+
+		rotation := deployment.NewAPIServerRotation(_config, _deployment, commandRetries)
+
+		// Preflight and one roll per stage plus rewriting the secrets
+		utils.SetProgressSteps(rotation.Steps() + (len(stages)-1)*rotation.RollSteps() + 2)
+
+		utils.ShowProgress()
+
+		if error := rotation.Prepare(); error != nil {
+			log.WithFields(log.Fields{"error": error}).Error("Failed rotating encryption key")
+
+			os.Exit(-3)
+		}
+
+		for range stages {
+			if error := rotateEncryptionStage(generator, rotation, state, stage); error != nil {
+				log.WithFields(log.Fields{"error": error, "stage": stage}).Error("Failed rotating encryption key")
+
+				os.Exit(-3)
+			}
+
+			if stage == utils.EncryptionRotationDrop {
+				if error := state.Remove(); error != nil {
+					log.WithFields(log.Fields{"error": error}).Error("Failed rotating encryption key")
+
+					os.Exit(-3)
+				}
+
+				break
+			}
+
+			if stage, error = generator.GetEncryptionRotationStage(); error != nil {
+				log.WithFields(log.Fields{"error": error}).Error("Failed rotating encryption key")
+
+				os.Exit(-3)
+			}
+		}
+
+		utils.HideProgress()
+
+		log.Info("Done")
+	},
+}
+
+// rotateEncryptionStage generates the stage unless it was generated before and rolls it out to all API servers
+func rotateEncryptionStage(generator *generate.Generator, rotation *deployment.Rotation, state *deployment.RotationState, stage string) error {
+	next, error := generator.GetEncryptionRotationStage()
+	if error != nil {
+		return error
+	}
+
+	if next == stage {
+		// The secrets are rewritten once the new key is the primary one on all API servers
+		if stage == utils.EncryptionRotationDrop {
+			if _, error := deployment.RewriteSecrets(_config); error != nil {
+				return error
+			}
+
+			utils.IncreaseProgressStep()
+		}
+
+		if error := state.Generated(utils.EncryptionConfig, stage); error != nil {
+			return error
+		}
+
+		if _, error := generator.RotateEncryptionKey(); error != nil {
+			return error
+		}
+	}
+
+	if error := rotation.Roll(); error != nil {
+		return error
+	}
+
+	return state.Finish()
+}
+
+func init() {
+	encryptionRotateCmd.Flags().StringVarP(&identityFile, "identity-file", "i", path.Join(os.Getenv("HOME"), ".ssh/id_rsa"), "SSH identity file")
+	encryptionRotateCmd.Flags().UintVarP(&commandRetries, "command-retries", "r", 300, "The count of seconds to wait for a node to recover")
+	encryptionRotateCmd.Flags().BoolVar(&skipPreflight, "skip-preflight", false, "Skip the preflight checks")
+	encryptionCmd.AddCommand(encryptionRotateCmd)
+	RootCmd.AddCommand(encryptionCmd)
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"os"
+	"path"
+	"time"
+
+	"github.com/darxkies/k8s-tew/deployment"
+	"github.com/darxkies/k8s-tew/pkg/etcd"
+	"github.com/darxkies/k8s-tew/utils"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var etcdSnapshotSchedule bool
+
+var etcdCmd = &cobra.Command{
+	Use:   "etcd",
+	Short: "Manage the etcd cluster",
+}
+
+var etcdSnapshotCmd = &cobra.Command{
+	Use:   "snapshot",
+	Short: "Save, list and restore etcd snapshots",
+}
+
+var etcdSnapshotSaveCmd = &cobra.Command{
+	Use:   "save",
+	Short: "Take an etcd snapshot",
+	Long:  "Take an etcd snapshot and store it in the configured storage. With --schedule a snapshot is taken every configured interval until the command is stopped.",
+	Run: func(cmd *cobra.Command, args []string) {
+		if error := bootstrap(false); error != nil {
+			log.WithFields(log.Fields{"error": error}).Error("Failed initializing")
+
+			os.Exit(-1)
+		}
+
+		if etcdSnapshotSchedule {
+			if _config.Config.EtcdSnapshotInterval == 0 {
+				log.Error("No etcd snapshot interval configured")
+
+				os.Exit(-2)
+			}
+
+			// Never returns
+			etcd.ScheduleSnapshots(_config, make(chan struct{}))
+		}
+
+		name, error := etcd.SaveSnapshot(_config)
+		if error != nil {
+			log.WithFields(log.Fields{"error": error}).Error("Failed saving snapshot")
+
+			os.Exit(-3)
+		}
+
+		log.WithFields(log.Fields{"name": name, "storage": _config.Config.EtcdSnapshotStorage}).Info("Done")
+	},
+}
+
+var etcdSnapshotListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the etcd snapshots",
+	Run: func(cmd *cobra.Command, args []string) {
+		if error := bootstrap(false); error != nil {
+			log.WithFields(log.Fields{"error": error}).Error("Failed initializing")
+
+			os.Exit(-1)
+		}
+
+		snapshots, error := etcd.ListSnapshots(_config)
+		if error != nil {
+			log.WithFields(log.Fields{"error": error}).Error("Failed listing snapshots")
+
+			os.Exit(-2)
+		}
+
+		for _, snapshot := range snapshots {
+			log.WithFields(log.Fields{"name": snapshot.Name, "size": snapshot.Size, "date": snapshot.Date.Format(time.RFC3339), "storage": snapshot.Storage}).Info("Snapshot")
+		}
+	},
+}
+
+var etcdSnapshotRestoreCmd = &cobra.Command{
+	Use:   "restore <name>",
+	Short: "Restore an etcd snapshot on all controllers",
+	Long:  "Stop etcd and the api servers on all controllers, rebuild the etcd data directories from the snapshot and start them again. The previous data directories are kept next to the restored ones.",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if error := bootstrap(false); error != nil {
+			log.WithFields(log.Fields{"error": error}).Error("Failed initializing")
+
+			os.Exit(-1)
+		}
+
+		restore, error := deployment.NewEtcdRestore(_config, identityFile, args[0], commandRetries)
+		if error != nil {
+			log.WithFields(log.Fields{"error": error}).Error("Failed restoring snapshot")
+
+			os.Exit(-2)
+		}
+
+		utils.SetProgressSteps(restore.Steps() + 1)
+
+		utils.ShowProgress()
+
+		if error := restore.Run(); error != nil {
+			log.WithFields(log.Fields{"snapshot": args[0], "error": error}).Error("Failed restoring snapshot")
+
+			os.Exit(-3)
+		}
+
+		utils.HideProgress()
+
+		log.Info("Done")
+	},
+}
+
+func init() {
+	etcdSnapshotSaveCmd.Flags().BoolVar(&etcdSnapshotSchedule, "schedule", false, "Keep taking snapshots every configured interval")
+	etcdSnapshotRestoreCmd.Flags().StringVarP(&identityFile, "identity-file", "i", path.Join(os.Getenv("HOME"), ".ssh/id_rsa"), "SSH identity file")
+	etcdSnapshotRestoreCmd.Flags().UintVarP(&commandRetries, "command-retries", "r", 300, "The count of seconds to wait for etcd to stop and to become healthy again")
+	etcdSnapshotCmd.AddCommand(etcdSnapshotSaveCmd)
+	etcdSnapshotCmd.AddCommand(etcdSnapshotListCmd)
+	etcdSnapshotCmd.AddCommand(etcdSnapshotRestoreCmd)
+	etcdCmd.AddCommand(etcdSnapshotCmd)
+	RootCmd.AddCommand(etcdCmd)
+}
@@ -39,6 +39,8 @@ var initializeCmd = &cobra.Command{
 			utils.IncreaseProgressStep()
 		}
 
+		_config.GenerateMinioKeys()
+
 		if error := _config.Save(); error != nil {
 			log.WithFields(log.Fields{"error": error}).Error("Initialize failed")
 
@@ -2,13 +2,18 @@ package main
 
 import (
 	"os"
+	"path"
 
+	"github.com/darxkies/k8s-tew/deployment"
+	"github.com/darxkies/k8s-tew/generate"
 	"github.com/darxkies/k8s-tew/utils"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
 
 var removeNodeName string
+var removeNodeDecommission bool
+var removeNodeDryRun bool
 
 func removeNode() error {
 	// Load config and check the rights
@@ -16,7 +21,38 @@ func removeNode() error {
 		return error
 	}
 
-	utils.SetProgressSteps(1)
+	if !removeNodeDecommission {
+		utils.SetProgressSteps(1)
+
+		if error := _config.RemoveNode(removeNodeName); error != nil {
+			return error
+		}
+
+		return _config.Save()
+	}
+
+	decommission, error := deployment.NewDecommission(_config, identityFile, removeNodeName, commandRetries, removeNodeDryRun)
+	if error != nil {
+		return error
+	}
+
+	generator := generate.NewGenerator(_config)
+
+	utils.SetProgressSteps(decommission.Steps() + 1 + generator.Steps())
+
+	utils.ShowProgress()
+
+	if error := decommission.Run(); error != nil {
+		return error
+	}
+
+	if removeNodeDryRun {
+		utils.HideProgress()
+
+		log.WithFields(log.Fields{"node": removeNodeName}).Info("Would remove node and regenerate the assets")
+
+		return nil
+	}
 
 	if error := _config.RemoveNode(removeNodeName); error != nil {
 		return error
@@ -26,13 +62,24 @@ func removeNode() error {
 		return error
 	}
 
+	utils.IncreaseProgressStep()
+
+	// Regenerate the certificates and the manifests that listed the node
+	if error := generator.GenerateFiles(); error != nil {
+		return error
+	}
+
+	utils.HideProgress()
+
+	log.Info("Run deploy to update the remaining nodes")
+
 	return nil
 }
 
 var nodeRemoveCmd = &cobra.Command{
 	Use:   "node-remove",
 	Short: "Remove a node",
-	Long:  "Remove a node",
+	Long:  "Remove a node. With --decommission the node is also drained, deleted from Kubernetes and etcd, and wiped.",
 	Run: func(cmd *cobra.Command, args []string) {
 		if error := removeNode(); error != nil {
 			log.WithFields(log.Fields{"error": error}).Error("Failed to remove node")
@@ -44,5 +91,9 @@ var nodeRemoveCmd = &cobra.Command{
 
 func init() {
 	nodeRemoveCmd.Flags().StringVarP(&removeNodeName, "name", "n", "", "Unique name of the node")
+	nodeRemoveCmd.Flags().BoolVar(&removeNodeDecommission, "decommission", false, "Drain the node, delete it from Kubernetes and etcd, stop the service and wipe the deployed files")
+	nodeRemoveCmd.Flags().BoolVar(&removeNodeDryRun, "dry-run", false, "Only show what the decommissioning would do")
+	nodeRemoveCmd.Flags().StringVarP(&identityFile, "identity-file", "i", path.Join(os.Getenv("HOME"), ".ssh/id_rsa"), "SSH identity file")
+	nodeRemoveCmd.Flags().UintVarP(&commandRetries, "command-retries", "r", 300, "The count of retries while draining the node")
 	RootCmd.AddCommand(nodeRemoveCmd)
 }
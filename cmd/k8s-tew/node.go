@@ -0,0 +1,239 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+
+	"github.com/darxkies/k8s-tew/config"
+	"github.com/darxkies/k8s-tew/deployment"
+	"github.com/darxkies/k8s-tew/servers"
+	"github.com/darxkies/k8s-tew/utils"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var nodeControlName string
+var nodeStatusJSON bool
+
+// nodeControl is implemented by the local control API client and by the SSH transport
+type nodeControl interface {
+	Status() (*config.ServersStatus, error)
+	RestartServer(name string) error
+	RerunCommand(name string) error
+	Reload() error
+}
+
+func getNodeControl() (nodeControl, error) {
+	if len(nodeControlName) == 0 {
+		return servers.NewControlClient(_config.GetFullLocalAssetFilename(utils.ControlSocket)), nil
+	}
+
+	node, ok := _config.Config.Nodes[nodeControlName]
+	if !ok {
+		return nil, fmt.Errorf("node '%s' not found", nodeControlName)
+	}
+
+	return deployment.NewNodeControl(identityFile, nodeControlName, node, _config), nil
+}
+
+// getNodeStatus falls back to the status file on this node if 'k8s-tew run' cannot be reached
+func getNodeStatus() (*config.ServersStatus, error) {
+	control, error := getNodeControl()
+	if error != nil {
+		return nil, error
+	}
+
+	status, error := control.Status()
+	if error == nil || len(nodeControlName) > 0 {
+		return status, error
+	}
+
+	log.WithFields(log.Fields{"error": error}).Debug("Control api not reachable")
+
+	status, _error := config.LoadServersStatus(_config.GetFullLocalAssetFilename(utils.ServersStatus))
+	if _error != nil {
+		return nil, error
+	}
+
+	status.Running = status.IsRunning()
+
+	return status, nil
+}
+
+func runNodeAction(action string, callback func(control nodeControl) error) {
+	if error := bootstrap(false); error != nil {
+		log.WithFields(log.Fields{"error": error}).Error("Failed initializing")
+
+		os.Exit(-1)
+	}
+
+	control, error := getNodeControl()
+	if error != nil {
+		log.WithFields(log.Fields{"error": error}).Error(action)
+
+		os.Exit(-2)
+	}
+
+	if error := callback(control); error != nil {
+		log.WithFields(log.Fields{"error": error}).Error(action)
+
+		os.Exit(-3)
+	}
+
+	log.Info("Done")
+}
+
+var nodeCmd = &cobra.Command{
+	Use:   "node",
+	Short: "Inspect and control the servers supervised by 'k8s-tew run' on a node",
+	Long:  "Inspect and control the servers supervised by 'k8s-tew run' on a node. The commands talk to the control API of 'k8s-tew run' on this node or, with --node, on a remote node through SSH.",
+}
+
+var nodeStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show the servers, the commands and the config version of a node",
+	Long:  "Show the state, the PID, the uptime, the restarts and the last exit of the servers, the state of the commands and the config version of a node. The exit code is 1 if a server is crash looping or failed, if a command failed or if 'k8s-tew run' is not running.",
+	Run: func(cmd *cobra.Command, args []string) {
+		if error := bootstrap(false); error != nil {
+			log.WithFields(log.Fields{"error": error}).Error("Failed initializing")
+
+			os.Exit(-1)
+		}
+
+		status, error := getNodeStatus()
+		if error != nil {
+			log.WithFields(log.Fields{"error": error}).Error("Failed reading status")
+
+			os.Exit(-2)
+		}
+
+		if nodeStatusJSON {
+			content, error := json.MarshalIndent(status, "", "  ")
+			if error != nil {
+				log.WithFields(log.Fields{"error": error}).Error("Failed reading status")
+
+				os.Exit(-2)
+			}
+
+			fmt.Println(string(content))
+
+		} else {
+			showNodeStatus(status)
+		}
+
+		if !status.Running || status.Degraded() {
+			os.Exit(1)
+		}
+	},
+}
+
+func showNodeStatus(status *config.ServersStatus) {
+	fields := log.Fields{"node": status.Node, "config-version": status.ConfigVersion, "pid": status.PID}
+
+	if !status.Running {
+		fields["updated-at"] = status.UpdatedAt
+
+		log.WithFields(fields).Warn("k8s-tew run is not running, the status is outdated")
+
+	} else {
+		log.WithFields(fields).Info("Node")
+	}
+
+	for _, server := range status.Servers {
+		fields := log.Fields{"name": server.Name, "state": server.State, "restart-policy": server.RestartPolicy, "restarts": server.Restarts}
+
+		if server.PID > 0 {
+			fields["pid"] = server.PID
+		}
+
+		if len(server.Uptime) > 0 {
+			fields["uptime"] = server.Uptime
+		}
+
+		if server.ExitCode != nil {
+			fields["exit-code"] = *server.ExitCode
+		}
+
+		if len(server.Signal) > 0 {
+			fields["signal"] = server.Signal
+		}
+
+		if len(server.Error) > 0 {
+			fields["error"] = server.Error
+		}
+
+		if server.Degraded {
+			log.WithFields(fields).Warn("Server degraded")
+
+		} else if server.Failed() {
+			log.WithFields(fields).Warn("Server failed")
+
+		} else {
+			log.WithFields(fields).Info("Server")
+		}
+	}
+
+	for _, command := range status.Commands {
+		fields := log.Fields{"name": command.Name, "state": command.State}
+
+		if len(command.Error) > 0 {
+			fields["error"] = command.Error
+		}
+
+		if command.State == utils.CommandStateFailed {
+			log.WithFields(fields).Warn("Command failed")
+
+		} else {
+			log.WithFields(fields).Info("Command")
+		}
+	}
+}
+
+var nodeRestartServerCmd = &cobra.Command{
+	Use:   "restart-server <name>",
+	Short: "Restart a server supervised by 'k8s-tew run'",
+	Long:  "Restart a server supervised by 'k8s-tew run' right away, without waiting for the restart backoff. Servers that exited for good are started again.",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		runNodeAction("Failed restarting server", func(control nodeControl) error {
+			return control.RestartServer(args[0])
+		})
+	},
+}
+
+var nodeRerunCommandCmd = &cobra.Command{
+	Use:   "rerun-command <name>",
+	Short: "Execute a command of 'k8s-tew run' again",
+	Long:  "Execute a command of 'k8s-tew run' again in the background. Its state is shown by 'k8s-tew node status'.",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		runNodeAction("Failed rerunning command", func(control nodeControl) error {
+			return control.RerunCommand(args[0])
+		})
+	},
+}
+
+var nodeReloadCmd = &cobra.Command{
+	Use:   "reload",
+	Short: "Reload the config of 'k8s-tew run'",
+	Long:  "Load the config again. Removed servers are stopped, added servers are started and changed servers are restarted.",
+	Run: func(cmd *cobra.Command, args []string) {
+		runNodeAction("Failed reloading config", func(control nodeControl) error {
+			return control.Reload()
+		})
+	},
+}
+
+func init() {
+	for _, command := range []*cobra.Command{nodeStatusCmd, nodeRestartServerCmd, nodeRerunCommandCmd, nodeReloadCmd} {
+		command.Flags().StringVarP(&nodeControlName, "node", "n", "", "The node to connect to through SSH instead of this node")
+		command.Flags().StringVarP(&identityFile, "identity-file", "i", path.Join(os.Getenv("HOME"), ".ssh/id_rsa"), "SSH identity file")
+		nodeCmd.AddCommand(command)
+	}
+
+	nodeStatusCmd.Flags().BoolVar(&nodeStatusJSON, "json", false, "Print the status as JSON")
+	RootCmd.AddCommand(nodeCmd)
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"os"
+	"path"
+
+	"github.com/darxkies/k8s-tew/generate"
+	"github.com/darxkies/k8s-tew/utils"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var oidcClientSecret string
+var oidcIDToken string
+var oidcRefreshToken string
+var oidcExtraScopes string
+var oidcOutput string
+
+var oidcCmd = &cobra.Command{
+	Use:   "oidc",
+	Short: "OpenID Connect authentication",
+}
+
+var oidcKubeconfigCmd = &cobra.Command{
+	Use:   "kubeconfig [name]",
+	Short: "Generate a kubeconfig using the oidc auth provider",
+	Long:  "Generate a kubeconfig for the user that authenticates with the ID token of the configured OIDC provider. kubectl refreshes the ID token using the refresh token and the client secret.",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if error := bootstrap(false); error != nil {
+			log.WithFields(log.Fields{"error": error}).Error("Failed initializing")
+
+			os.Exit(-1)
+		}
+
+		filename := oidcOutput
+
+		if len(filename) == 0 {
+			directory := _config.GetFullLocalAssetDirectory(utils.DirectoryUsers)
+
+			if error := utils.CreateDirectoryIfMissing(directory); error != nil {
+				log.WithFields(log.Fields{"error": error}).Error("Failed generating kubeconfig")
+
+				os.Exit(-2)
+			}
+
+			filename = path.Join(directory, args[0]+"-oidc.kubeconfig")
+		}
+
+		if error := generate.NewGenerator(_config).GenerateOIDCKubeconfig(filename, args[0], oidcClientSecret, oidcIDToken, oidcRefreshToken, oidcExtraScopes); error != nil {
+			log.WithFields(log.Fields{"error": error}).Error("Failed generating kubeconfig")
+
+			os.Exit(-2)
+		}
+
+		log.WithFields(log.Fields{"user": args[0], "kubeconfig": filename}).Info("Kubeconfig generated")
+	},
+}
+
+func init() {
+	oidcKubeconfigCmd.Flags().StringVar(&oidcClientSecret, "client-secret", "", "Client secret used to refresh the ID token")
+	oidcKubeconfigCmd.Flags().StringVar(&oidcIDToken, "id-token", "", "ID token")
+	oidcKubeconfigCmd.Flags().StringVar(&oidcRefreshToken, "refresh-token", "", "Refresh token")
+	oidcKubeconfigCmd.Flags().StringVar(&oidcExtraScopes, "extra-scopes", "", "Comma separated scopes requested when the ID token is refreshed")
+	oidcKubeconfigCmd.Flags().StringVarP(&oidcOutput, "output", "o", "", "The kubeconfig file. If omitted, it is written to the users directory")
+	oidcCmd.AddCommand(oidcKubeconfigCmd)
+	RootCmd.AddCommand(oidcCmd)
+}
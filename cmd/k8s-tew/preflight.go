@@ -0,0 +1,55 @@
+package main
+
+import (
+	"os"
+	"path"
+
+	"github.com/darxkies/k8s-tew/config"
+	"github.com/darxkies/k8s-tew/deployment"
+	"github.com/darxkies/k8s-tew/utils"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var preflightCmd = &cobra.Command{
+	Use:   "preflight",
+	Short: "Check the remote nodes before deploying",
+	Long:  "Collect facts from the remote nodes over SSH and check them against the requirements of their labels and of the enabled features",
+	Run: func(cmd *cobra.Command, args []string) {
+		if error := bootstrap(false); error != nil {
+			log.WithFields(log.Fields{"error": error}).Error("Failed initializing")
+
+			os.Exit(-1)
+		}
+
+		skipFeatures := config.Features{}
+
+		if skipStorageSetup {
+			skipFeatures = append(skipFeatures, utils.FeatureStorage)
+		}
+
+		preflight := deployment.NewPreflight(_config, identityFile, skipFeatures, parallel)
+
+		utils.SetProgressSteps(preflight.Steps() + 1)
+
+		utils.ShowProgress()
+
+		if error := preflight.Run(); error != nil {
+			log.WithFields(log.Fields{"error": error}).Error("Failed preflight")
+
+			os.Exit(-2)
+		}
+
+		utils.HideProgress()
+
+		log.Info("Done")
+	},
+}
+
+func init() {
+	preflightCmd.Flags().StringVarP(&identityFile, "identity-file", "i", path.Join(os.Getenv("HOME"), ".ssh/id_rsa"), "SSH identity file")
+	preflightCmd.Flags().BoolVar(&skipStorageSetup, "skip-storage-setup", false, "Skip the checks required by the storage setup")
+	preflightCmd.Flags().BoolVar(&parallel, "parallel", false, "Check the nodes in parallel")
+	RootCmd.AddCommand(preflightCmd)
+}
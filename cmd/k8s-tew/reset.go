@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/darxkies/k8s-tew/deployment"
+	"github.com/darxkies/k8s-tew/pkg/reset"
+	"github.com/darxkies/k8s-tew/utils"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	yaml "gopkg.in/yaml.v2"
+)
+
+var resetNodes []string
+var resetAll bool
+var resetAssets bool
+var resetYes bool
+
+// confirmResetAssets asks the user to confirm the removal of the assets on stdin
+func confirmResetAssets() error {
+	if resetYes {
+		return nil
+	}
+
+	fmt.Fprintf(os.Stderr, "This removes the assets in '%s' including the certificate authorities and the config. Type 'yes' to continue: ", _config.BaseDirectory)
+
+	answer, error := bufio.NewReader(os.Stdin).ReadString('\n')
+	if error != nil && len(answer) == 0 {
+		return errors.New("no confirmation")
+	}
+
+	if strings.TrimSpace(answer) != "yes" {
+		return errors.New("not confirmed")
+	}
+
+	return nil
+}
+
+// resetLocal removes k8s-tew from this machine and prints the report to stdout
+func resetLocal() error {
+	if error := bootstrap(true); error != nil {
+		return error
+	}
+
+	if resetAssets {
+		if error := confirmResetAssets(); error != nil {
+			return error
+		}
+	}
+
+	_reset := reset.NewReset(_config, resetAssets)
+
+	utils.SetProgressSteps(_reset.Steps())
+
+	utils.ShowProgress()
+
+	report := _reset.Run()
+
+	utils.HideProgress()
+
+	report.Dump()
+
+	fmt.Print(report.String())
+
+	return nil
+}
+
+// resetRemote removes k8s-tew from the remote nodes and saves the reports locally
+func resetRemote() error {
+	if error := bootstrap(false); error != nil {
+		return error
+	}
+
+	names := resetNodes
+
+	if resetAll {
+		names = _config.GetSortedNodeKeys()
+	}
+
+	clusterReset, error := deployment.NewClusterReset(_config, identityFile, names)
+	if error != nil {
+		return error
+	}
+
+	utils.SetProgressSteps(clusterReset.Steps())
+
+	utils.ShowProgress()
+
+	reports := clusterReset.Run()
+
+	utils.HideProgress()
+
+	for _, report := range reports {
+		report.Dump()
+	}
+
+	content, error := yaml.Marshal(reports)
+	if error != nil {
+		return error
+	}
+
+	filename := _config.GetFullLocalAssetFilename(utils.ResetReport)
+
+	if error := ioutil.WriteFile(filename, content, 0644); error != nil {
+		return error
+	}
+
+	utils.LogFilename("Saved", filename)
+
+	return nil
+}
+
+var resetCmd = &cobra.Command{
+	Use:   "reset",
+	Short: "Remove k8s-tew from nodes",
+	Long:  "Stop the service, kill the containers, remove the network interfaces, the iptables rules and the deployed files. Without --node or --all the local machine is reset. The assets of the bootstrapper are only removed with --assets.",
+	Run: func(cmd *cobra.Command, args []string) {
+		var error error
+
+		if resetAll || len(resetNodes) > 0 {
+			if resetAssets {
+				log.WithFields(log.Fields{"error": "--assets only applies to the local machine"}).Error("Failed to reset")
+
+				os.Exit(-1)
+			}
+
+			error = resetRemote()
+		} else {
+			error = resetLocal()
+		}
+
+		if error != nil {
+			log.WithFields(log.Fields{"error": error}).Error("Failed to reset")
+
+			os.Exit(-1)
+		}
+
+		log.Info("Done")
+	},
+}
+
+func init() {
+	resetCmd.Flags().StringSliceVarP(&resetNodes, "node", "n", []string{}, "Names of the remote nodes to reset")
+	resetCmd.Flags().BoolVarP(&resetAll, "all", "a", false, "Reset all remote nodes")
+	resetCmd.Flags().BoolVar(&resetAssets, "assets", false, "Remove the assets in the base directory too, including the certificate authorities and the config")
+	resetCmd.Flags().BoolVarP(&resetYes, "yes", "y", false, "Do not ask for confirmation before removing the assets")
+	resetCmd.Flags().StringVarP(&identityFile, "identity-file", "i", path.Join(os.Getenv("HOME"), ".ssh/id_rsa"), "SSH identity file")
+	RootCmd.AddCommand(resetCmd)
+}
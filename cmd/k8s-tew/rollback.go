@@ -0,0 +1,88 @@
+package main
+
+import (
+	"os"
+	"path"
+	"sort"
+
+	"github.com/darxkies/k8s-tew/deployment"
+	"github.com/darxkies/k8s-tew/utils"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var rollbackTo string
+var rollbackList bool
+
+func listDeployments() error {
+	history, error := deployment.LoadHistory(_config.GetFullLocalAssetFilename(utils.DeploymentHistory))
+	if error != nil {
+		return error
+	}
+
+	for _, revision := range history.Revisions {
+		nodes := []string{}
+
+		for nodeName := range revision.Nodes {
+			nodes = append(nodes, nodeName)
+		}
+
+		sort.Strings(nodes)
+
+		log.WithFields(log.Fields{"deployment-id": revision.ID, "date": revision.Date, "nodes": nodes}).Info("Deployment")
+	}
+
+	return nil
+}
+
+var rollbackCmd = &cobra.Command{
+	Use:   "rollback",
+	Short: "Roll back the assets of a remote cluster",
+	Long:  "Restore the remote files replaced by the last deployment or by all deployments following the one passed with --to and restart the service",
+	Run: func(cmd *cobra.Command, args []string) {
+		if error := bootstrap(false); error != nil {
+			log.WithFields(log.Fields{"error": error}).Error("Failed initializing")
+
+			os.Exit(-1)
+		}
+
+		if rollbackList {
+			if error := listDeployments(); error != nil {
+				log.WithFields(log.Fields{"error": error}).Error("Failed listing deployments")
+
+				os.Exit(-2)
+			}
+
+			return
+		}
+
+		rollback, error := deployment.NewRollback(_config, identityFile, rollbackTo)
+		if error != nil {
+			log.WithFields(log.Fields{"error": error}).Error("Failed rolling back")
+
+			os.Exit(-2)
+		}
+
+		utils.SetProgressSteps(rollback.Steps() + 1)
+
+		utils.ShowProgress()
+
+		if error := rollback.Run(); error != nil {
+			log.WithFields(log.Fields{"error": error}).Error("Failed rolling back")
+
+			os.Exit(-3)
+		}
+
+		utils.HideProgress()
+
+		log.Info("Done")
+	},
+}
+
+func init() {
+	rollbackCmd.Flags().StringVarP(&identityFile, "identity-file", "i", path.Join(os.Getenv("HOME"), ".ssh/id_rsa"), "SSH identity file")
+	rollbackCmd.Flags().BoolVarP(&rollbackList, "list", "l", false, "List the deployments that can be rolled back")
+	rollbackCmd.Flags().StringVar(&rollbackTo, "to", "", "The id of the deployment to roll back to. If omitted, the last deployment is rolled back")
+	RootCmd.AddCommand(rollbackCmd)
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"time"
+
+	"github.com/darxkies/k8s-tew/deployment"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var clusterStatusJSON bool
+var clusterStatusWatch bool
+var clusterStatusInterval uint
+
+func showClusterStatus(collector *deployment.StatusCollector) (bool, error) {
+	status, error := collector.Collect()
+	if error != nil {
+		return false, error
+	}
+
+	if clusterStatusJSON {
+		content, error := json.MarshalIndent(status, "", "  ")
+		if error != nil {
+			return false, error
+		}
+
+		fmt.Println(string(content))
+
+		return status.Healthy(), nil
+	}
+
+	if clusterStatusWatch {
+		// Clear the terminal
+		fmt.Print("\033[H\033[2J")
+
+		fmt.Printf("Updated at %s, every %ds\n\n", status.UpdatedAt.Local().Format("15:04:05"), clusterStatusInterval)
+	}
+
+	status.WriteTable(os.Stdout)
+
+	return status.Healthy(), nil
+}
+
+var statusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show the health of the cluster",
+	Long:  "Show for every node whether it is reachable, the state of the k8s-tew service, the supervised servers, the Ready condition and the deployed asset revision compared to the local one. For the cluster, the health of the etcd members, of the control plane and of the pods grouped by feature is shown. The exit code is 1 if anything is unhealthy. The servers of a single node are shown by 'k8s-tew node status'.",
+	Run: func(cmd *cobra.Command, args []string) {
+		if error := bootstrap(false); error != nil {
+			log.WithFields(log.Fields{"error": error}).Error("Failed initializing")
+
+			os.Exit(-1)
+		}
+
+		if clusterStatusInterval == 0 {
+			log.WithFields(log.Fields{"error": "the interval has to be at least one second"}).Error("Failed showing status")
+
+			os.Exit(-2)
+		}
+
+		collector := deployment.NewStatusCollector(_config, identityFile)
+
+		for {
+			healthy, error := showClusterStatus(collector)
+			if error != nil {
+				log.WithFields(log.Fields{"error": error}).Error("Failed showing status")
+
+				os.Exit(-3)
+			}
+
+			if !clusterStatusWatch {
+				if !healthy {
+					os.Exit(1)
+				}
+
+				return
+			}
+
+			time.Sleep(time.Duration(clusterStatusInterval) * time.Second)
+		}
+	},
+}
+
+func init() {
+	statusCmd.Flags().StringVarP(&identityFile, "identity-file", "i", path.Join(os.Getenv("HOME"), ".ssh/id_rsa"), "SSH identity file")
+	statusCmd.Flags().BoolVar(&clusterStatusJSON, "json", false, "Print the status as JSON")
+	statusCmd.Flags().BoolVarP(&clusterStatusWatch, "watch", "w", false, "Show the status again every interval")
+	statusCmd.Flags().UintVar(&clusterStatusInterval, "interval", 5, "The count of seconds between the updates in watch mode")
+	RootCmd.AddCommand(statusCmd)
+}
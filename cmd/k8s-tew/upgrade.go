@@ -0,0 +1,68 @@
+package main
+
+import (
+	"os"
+	"path"
+
+	"github.com/darxkies/k8s-tew/deployment"
+	"github.com/darxkies/k8s-tew/utils"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var upgradeBatchSize uint
+
+var upgradeCmd = &cobra.Command{
+	Use:   "upgrade",
+	Short: "Upgrade a remote cluster to the configured Kubernetes version",
+	Long:  "Take an etcd snapshot, upgrade the controllers one at a time, the workers in batches and then the addons. An interrupted upgrade is continued when the command is run again.",
+	Run: func(cmd *cobra.Command, args []string) {
+		if error := bootstrap(false); error != nil {
+			log.WithFields(log.Fields{"error": error}).Error("Failed initializing")
+
+			os.Exit(-1)
+		}
+
+		_deployment := deployment.NewDeployment(_config, identityFile, importImages, false, parallel, commandRetries, skipPreflight, skipSetup, skipStorageSetup, skipMonitoringSetup, skipLoggingSetup, skipBackupSetup, skipShowcaseSetup, skipIngressSetup, skipPackagingSetup)
+
+		upgrade, error := deployment.NewUpgrade(_config, _deployment, upgradeBatchSize, commandRetries)
+		if error != nil {
+			log.WithFields(log.Fields{"error": error}).Error("Failed upgrading")
+
+			os.Exit(-2)
+		}
+
+		utils.SetProgressSteps(upgrade.Steps() + 1)
+
+		utils.ShowProgress()
+
+		if error := upgrade.Run(); error != nil {
+			log.WithFields(log.Fields{"error": error}).Error("Failed upgrading")
+
+			os.Exit(-3)
+		}
+
+		utils.HideProgress()
+
+		log.Info("Done")
+	},
+}
+
+func init() {
+	upgradeCmd.Flags().StringVarP(&identityFile, "identity-file", "i", path.Join(os.Getenv("HOME"), ".ssh/id_rsa"), "SSH identity file")
+	upgradeCmd.Flags().UintVarP(&commandRetries, "command-retries", "r", 300, "The count of command retries during the setup and the count of seconds to wait for a node to be upgraded")
+	upgradeCmd.Flags().UintVar(&upgradeBatchSize, "batch-size", 1, "The count of workers upgraded at the same time")
+	upgradeCmd.Flags().BoolVar(&skipPreflight, "skip-preflight", false, "Skip the preflight checks")
+	upgradeCmd.Flags().BoolVar(&skipSetup, "skip-setup", false, "Skip setup steps")
+	upgradeCmd.Flags().BoolVar(&skipStorageSetup, "skip-storage-setup", false, "Skip storage setup and all other feature setup steps")
+	upgradeCmd.Flags().BoolVar(&skipMonitoringSetup, "skip-monitoring-setup", false, "Skip monitoring setup")
+	upgradeCmd.Flags().BoolVar(&skipLoggingSetup, "skip-logging-setup", false, "Skip logging setup")
+	upgradeCmd.Flags().BoolVar(&skipBackupSetup, "skip-backup-setup", false, "Skip backup setup")
+	upgradeCmd.Flags().BoolVar(&skipShowcaseSetup, "skip-showcase-setup", false, "Skip showcase setup")
+	upgradeCmd.Flags().BoolVar(&skipIngressSetup, "skip-ingress-setup", false, "Skip ingress setup")
+	upgradeCmd.Flags().BoolVar(&skipPackagingSetup, "skip-packaging-setup", false, "Skip packaging setup")
+	upgradeCmd.Flags().BoolVar(&importImages, "import-images", false, "Install images")
+	upgradeCmd.Flags().BoolVar(&parallel, "parallel", false, "Run steps in parallel")
+	RootCmd.AddCommand(upgradeCmd)
+}
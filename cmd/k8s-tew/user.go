@@ -0,0 +1,160 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"time"
+
+	"github.com/darxkies/k8s-tew/config"
+	"github.com/darxkies/k8s-tew/deployment"
+	"github.com/darxkies/k8s-tew/generate"
+	"github.com/darxkies/k8s-tew/utils"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var userGroups []string
+var userTTL time.Duration
+var userBindings []string
+var userSkipBindings bool
+var userForce bool
+
+var userCmd = &cobra.Command{
+	Use:   "user",
+	Short: "Manage the client certificates of the users",
+}
+
+var userAddCmd = &cobra.Command{
+	Use:   "add [name]",
+	Short: "Issue a client certificate and a kubeconfig for a user",
+	Long:  "Issue a client certificate for a user with the given groups and lifetime, write a kubeconfig using the load balancer and bind the selected roles (view, edit, admin or cluster-admin) to the user. Adding an existing user issues a new certificate and replaces the role bindings. The name of a revoked user whose certificate is still valid is only reused with --force.",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if error := bootstrap(false); error != nil {
+			log.WithFields(log.Fields{"error": error}).Error("Failed initializing")
+
+			os.Exit(-1)
+		}
+
+		bindings := []config.UserBinding{}
+
+		for _, value := range userBindings {
+			binding, error := config.ParseUserBinding(value)
+			if error != nil {
+				log.WithFields(log.Fields{"error": error}).Error("Failed adding user")
+
+				os.Exit(-2)
+			}
+
+			bindings = append(bindings, binding)
+		}
+
+		generator := generate.NewGenerator(_config)
+
+		user, error := generator.AddUser(args[0], userGroups, userTTL, bindings, userForce)
+		if error != nil {
+			log.WithFields(log.Fields{"error": error}).Error("Failed adding user")
+
+			os.Exit(-2)
+		}
+
+		if !userSkipBindings {
+			if error := deployment.ApplyUserBindings(_config, user); error != nil {
+				log.WithFields(log.Fields{"error": error}).Error("Failed adding user")
+
+				os.Exit(-3)
+			}
+		}
+
+		_, _, kubeconfig := generator.GetUserFilenames(user.Name)
+
+		log.WithFields(log.Fields{"user": user.Name, "serial": user.Serial, "expires-at": user.ExpiresAt, "kubeconfig": kubeconfig}).Info("User added")
+	},
+}
+
+var userListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the users",
+	Run: func(cmd *cobra.Command, args []string) {
+		if error := bootstrap(false); error != nil {
+			log.WithFields(log.Fields{"error": error}).Error("Failed initializing")
+
+			os.Exit(-1)
+		}
+
+		users, error := config.LoadUsers(_config.GetFullLocalAssetFilename(utils.Users))
+		if error != nil {
+			log.WithFields(log.Fields{"error": error}).Error("Failed listing users")
+
+			os.Exit(-2)
+		}
+
+		for _, user := range users.Users {
+			bindings := []string{}
+
+			for _, binding := range user.Bindings {
+				bindings = append(bindings, binding.String())
+			}
+
+			state := "active"
+
+			if user.IsRevoked() {
+				state = "revoked"
+
+			} else if user.IsExpired() {
+				state = "expired"
+			}
+
+			log.WithFields(log.Fields{"name": user.Name, "groups": strings.Join(user.Groups, ","), "bindings": strings.Join(bindings, ","), "serial": user.Serial, "expires-at": user.ExpiresAt, "state": state}).Info("User")
+		}
+	},
+}
+
+var userRevokeCmd = &cobra.Command{
+	Use:   "revoke [name]",
+	Short: "Revoke the access of a user",
+	Long:  "Delete the role bindings of the user, remove the certificate and the kubeconfig and mark the user as revoked. Kubernetes does not check revoked client certificates, the permissions granted to the groups of the user remain until the certificate expires.",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if error := bootstrap(false); error != nil {
+			log.WithFields(log.Fields{"error": error}).Error("Failed initializing")
+
+			os.Exit(-1)
+		}
+
+		if !userSkipBindings {
+			if error := deployment.DeleteUserBindings(_config, args[0]); error != nil {
+				log.WithFields(log.Fields{"error": error}).Error("Failed revoking user")
+
+				os.Exit(-2)
+			}
+		}
+
+		user, error := generate.NewGenerator(_config).RevokeUser(args[0])
+		if error != nil {
+			log.WithFields(log.Fields{"error": error}).Error("Failed revoking user")
+
+			os.Exit(-3)
+		}
+
+		if len(user.Groups) > 0 && !user.IsExpired() {
+			log.WithFields(log.Fields{"user": user.Name, "groups": strings.Join(user.Groups, ","), "expires-at": user.ExpiresAt}).Warn("The certificate keeps the permissions of its groups until it expires")
+		}
+
+		log.WithFields(log.Fields{"user": user.Name}).Info("User revoked")
+	},
+}
+
+func init() {
+	userAddCmd.Flags().StringSliceVarP(&userGroups, "group", "g", []string{}, "Group of the user, can be repeated")
+	userAddCmd.Flags().DurationVar(&userTTL, "ttl", 7*24*time.Hour, "Lifetime of the certificate")
+	userAddCmd.Flags().StringSliceVarP(&userBindings, "bind", "b", []string{}, "Bind a role to the user as role[:namespace], roles are view, edit, admin and cluster-admin, can be repeated")
+	userAddCmd.Flags().BoolVar(&userSkipBindings, "skip-bindings", false, "Do not apply the role bindings")
+	userAddCmd.Flags().BoolVar(&userForce, "force", false, "Reuse the name of a revoked user whose certificate is still valid")
+	userCmd.AddCommand(userAddCmd)
+	userCmd.AddCommand(userListCmd)
+	userRevokeCmd.Flags().BoolVar(&userSkipBindings, "skip-bindings", false, "Do not delete the role bindings")
+	userCmd.AddCommand(userRevokeCmd)
+	RootCmd.AddCommand(userCmd)
+}
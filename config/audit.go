@@ -0,0 +1,46 @@
+package config
+
+import (
+	"fmt"
+	"path"
+
+	"github.com/darxkies/k8s-tew/utils"
+)
+
+// Audit configures the audit logging of the API servers. The policy is either one of the presets or, if set, the
+// custom policy file.
+type Audit struct {
+	Policy        string `yaml:"policy"`
+	PolicyFile    string `yaml:"policy-file,omitempty"`
+	LogPath       string `yaml:"log-path,omitempty"`
+	MaxAge        uint   `yaml:"max-age"`
+	MaxSize       uint   `yaml:"max-size"`
+	MaxBackups    uint   `yaml:"max-backups"`
+	WebhookURL    string `yaml:"webhook-url,omitempty"`
+	WebhookCAFile string `yaml:"webhook-ca-file,omitempty"`
+}
+
+func NewAudit() Audit {
+	return Audit{
+		Policy:     utils.AuditPolicyMetadata,
+		MaxAge:     utils.AuditMaxAge,
+		MaxSize:    utils.AuditMaxSize,
+		MaxBackups: utils.AuditMaxBackups,
+	}
+}
+
+func (audit Audit) Validate() error {
+	if len(audit.PolicyFile) == 0 && audit.Policy != utils.AuditPolicyMinimal && audit.Policy != utils.AuditPolicyMetadata && audit.Policy != utils.AuditPolicyRequestResponse {
+		return fmt.Errorf("unsupported audit policy '%s', use %s, %s, %s or a policy file", audit.Policy, utils.AuditPolicyMinimal, utils.AuditPolicyMetadata, utils.AuditPolicyRequestResponse)
+	}
+
+	if len(audit.LogPath) > 0 && !path.IsAbs(audit.LogPath) {
+		return fmt.Errorf("the audit log path '%s' has to be absolute", audit.LogPath)
+	}
+
+	if len(audit.WebhookCAFile) > 0 && len(audit.WebhookURL) == 0 {
+		return fmt.Errorf("the audit webhook CA is set without a webhook URL")
+	}
+
+	return nil
+}
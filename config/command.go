@@ -1,8 +1,17 @@
 package config
 
+import (
+	"time"
+
+	"github.com/darxkies/k8s-tew/utils"
+)
+
+// Command is either a shell command or, if Manifest is set, the name of a rendered manifest asset that is applied to the cluster. Timeout limits the time in seconds spent applying a manifest and waiting for it to become ready.
 type Command struct {
 	Name     string   `yaml:"name"`
-	Command  string   `yaml:"command"`
+	Command  string   `yaml:"command,omitempty"`
+	Manifest string   `yaml:"manifest,omitempty"`
+	Timeout  uint     `yaml:"timeout,omitempty"`
 	Labels   Labels   `yaml:"labels,omitempty"`
 	Features Features `yaml:"features,omitempty"`
 	OS       OS       `yaml:"os,omitempty"`
@@ -14,3 +23,24 @@ type OS []string
 func NewCommand(name string, labels Labels, features Features, os OS, command string) *Command {
 	return &Command{Name: name, Labels: labels, Features: features, OS: os, Command: command}
 }
+
+func NewManifestCommand(name string, labels Labels, features Features, manifest string) *Command {
+	return &Command{Name: name, Labels: labels, Features: features, OS: OS{}, Manifest: manifest}
+}
+
+func (command *Command) GetTimeout() time.Duration {
+	if command.Timeout == 0 {
+		return utils.AddonTimeout * time.Second
+	}
+
+	return time.Duration(command.Timeout) * time.Second
+}
+
+// GetFeature returns the feature the command belongs to, which is the first one listed
+func (command *Command) GetFeature() string {
+	if len(command.Features) == 0 {
+		return ""
+	}
+
+	return command.Features[0]
+}
@@ -1,6 +1,8 @@
 package config
 
 import (
+	"strings"
+
 	"github.com/darxkies/k8s-tew/utils"
 	uuid "github.com/satori/go.uuid"
 )
@@ -25,17 +27,29 @@ type Config struct {
 	ClusterIPRange               string      `yaml:"cluster-ip-range"`
 	ClusterDNSIP                 string      `yaml:"cluster-dns-ip"`
 	ClusterCIDR                  string      `yaml:"cluster-cidr"`
+	ExtraSANs                    []string    `yaml:"extra-sans,omitempty"`
 	CalicoTyphaIP                string      `yaml:"calico-typha-ip"`
 	MetalLBAddresses             string      `yaml:"metallb-addresses"`
 	ResolvConf                   string      `yaml:"resolv-conf"`
 	DeploymentDirectory          string      `yaml:"deployment-directory,omitempty"`
 	RSASize                      uint16      `yaml:"rsa-size"`
+	KeyAlgorithm                 string      `yaml:"key-algorithm,omitempty"`
 	CAValidityPeriod             uint        `yaml:"ca-validity-period"`
 	ClientValidityPeriod         uint        `yaml:"client-validity-period"`
+	Revisions                    uint        `yaml:"revisions"`
+	EtcdSnapshotInterval         uint        `yaml:"etcd-snapshot-interval,omitempty"`
+	EtcdSnapshotRetention        uint        `yaml:"etcd-snapshot-retention"`
+	EtcdSnapshotStorage          string      `yaml:"etcd-snapshot-storage"`
+	MinioAccessKey               string      `yaml:"minio-access-key"`
+	MinioSecretKey               string      `yaml:"minio-secret-key"`
+	OIDC                         OIDC        `yaml:"oidc,omitempty"`
+	Audit                        Audit       `yaml:"audit"`
+	EncryptionKMS                KMS         `yaml:"encryption-kms,omitempty"`
 	Versions                     Versions    `yaml:"versions"`
 	Assets                       AssetConfig `yaml:"assets,omitempty"`
 	Nodes                        Nodes       `yaml:"nodes"`
 	Commands                     Commands    `yaml:"commands,omitempty"`
+	Hooks                        Hooks       `yaml:"hooks,omitempty"`
 	Servers                      Servers     `yaml:"servers,omitempty"`
 }
 
@@ -61,13 +75,24 @@ func NewConfig() *Config {
 	config.ResolvConf = utils.ResolvConf
 	config.DeploymentDirectory = utils.DeploymentDirectory
 	config.RSASize = utils.RsaSize
+	config.KeyAlgorithm = utils.KeyAlgorithmRSA
 	config.CAValidityPeriod = utils.CaValidityPeriod
 	config.ClientValidityPeriod = utils.ClientValidityPeriod
+	config.Revisions = utils.Revisions
+	config.EtcdSnapshotRetention = utils.EtcdSnapshotRetention
+	config.EtcdSnapshotStorage = utils.EtcdSnapshotStorageLocal
+	config.Audit = NewAudit()
 	config.Versions = NewVersions()
 	config.Assets = AssetConfig{Directories: map[string]*AssetDirectory{}, Files: map[string]*AssetFile{}}
 	config.Nodes = Nodes{}
 	config.Commands = Commands{}
+	config.Hooks = Hooks{}
 	config.Servers = Servers{}
 
 	return config
 }
+
+// newMinioKey returns a random key of hex digits, minio limits the length of the access key to 20 characters
+func newMinioKey(length int) string {
+	return strings.Replace(uuid.NewV4().String()+uuid.NewV4().String(), "-", "", -1)[:length]
+}
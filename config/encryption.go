@@ -0,0 +1,47 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// KMS configures a KMS v1 plugin listening on a local socket as the primary encryption provider of the secrets. The
+// aescbc keys are kept to read the secrets written before.
+type KMS struct {
+	Name      string `yaml:"name,omitempty"`
+	Endpoint  string `yaml:"endpoint,omitempty"`
+	CacheSize uint   `yaml:"cache-size,omitempty"`
+	Timeout   string `yaml:"timeout,omitempty"`
+}
+
+func (kms KMS) Enabled() bool {
+	return len(kms.Endpoint) > 0
+}
+
+// GetSocket returns the path of the socket of the plugin
+func (kms KMS) GetSocket() string {
+	return strings.TrimPrefix(kms.Endpoint, "unix://")
+}
+
+func (kms KMS) Validate() error {
+	if !kms.Enabled() {
+		return nil
+	}
+
+	if !strings.HasPrefix(kms.Endpoint, "unix:///") {
+		return fmt.Errorf("the KMS endpoint '%s' has to be an absolute unix socket like unix:///var/run/kms-plugin/socket.sock", kms.Endpoint)
+	}
+
+	if len(kms.Name) == 0 {
+		return fmt.Errorf("the KMS name is missing")
+	}
+
+	if len(kms.Timeout) > 0 {
+		if _, error := time.ParseDuration(kms.Timeout); error != nil {
+			return fmt.Errorf("invalid KMS timeout '%s' (%s)", kms.Timeout, error.Error())
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,80 @@
+package config
+
+import (
+	"io/ioutil"
+	"strings"
+
+	"github.com/darxkies/k8s-tew/utils"
+)
+
+// GetEtcdCAMigrationStage returns the last stage generated while moving etcd from the cluster CA to its own CA. Clusters
+// generated with the etcd CA have no stage, older clusters start with the legacy stage which keeps using the cluster CA.
+func (config *InternalConfig) GetEtcdCAMigrationStage() string {
+	content, error := ioutil.ReadFile(config.GetFullLocalAssetFilename(utils.EtcdCaMigration))
+	if error != nil {
+		return ""
+	}
+
+	return strings.TrimSpace(string(content))
+}
+
+// SetEtcdCAMigrationStage records the stage. The file is also deployed to the controllers, so that the etcd clients on
+// the nodes use the same certificates.
+func (config *InternalConfig) SetEtcdCAMigrationStage(stage string) error {
+	filename := config.GetFullLocalAssetFilename(utils.EtcdCaMigration)
+
+	if error := ioutil.WriteFile(filename, []byte(stage+"\n"), 0644); error != nil {
+		return error
+	}
+
+	utils.LogFilename("Generated", filename)
+
+	return nil
+}
+
+// IsEtcdCAMigrating returns true while etcd trusts both the cluster CA and its own CA
+func (config *InternalConfig) IsEtcdCAMigrating() bool {
+	stage := config.GetEtcdCAMigrationStage()
+
+	return stage == utils.CARotationTrust || stage == utils.CARotationSwitch
+}
+
+// usesClusterCertificates returns true until etcd was switched to the certificates of its own CA
+func (config *InternalConfig) usesClusterCertificates() bool {
+	stage := config.GetEtcdCAMigrationStage()
+
+	return stage == utils.CARotationLegacy || stage == utils.CARotationTrust
+}
+
+// GetEtcdTrustedCA returns the CA bundle trusted by etcd and its clients
+func (config *InternalConfig) GetEtcdTrustedCA() string {
+	if config.GetEtcdCAMigrationStage() == utils.CARotationLegacy {
+		return utils.PemCa
+	}
+
+	if config.IsEtcdCAMigrating() {
+		return utils.PemEtcdCaBundle
+	}
+
+	return utils.PemEtcdCa
+}
+
+// GetEtcdClientCertificate returns the certificate and the key used by the etcd clients. Until the switch stage they
+// keep using the certificate of the cluster CA.
+func (config *InternalConfig) GetEtcdClientCertificate() (string, string) {
+	if config.usesClusterCertificates() {
+		return utils.PemKubernetes, utils.PemKubernetesKey
+	}
+
+	return utils.PemEtcdClient, utils.PemEtcdClientKey
+}
+
+// GetEtcdServerCertificates returns the server and the peer certificates and keys of etcd. Until the switch stage the
+// certificate of the cluster CA is used for both.
+func (config *InternalConfig) GetEtcdServerCertificates() (string, string, string, string) {
+	if config.usesClusterCertificates() {
+		return utils.PemKubernetes, utils.PemKubernetesKey, utils.PemKubernetes, utils.PemKubernetesKey
+	}
+
+	return utils.PemEtcdServer, utils.PemEtcdServerKey, utils.PemEtcdPeer, utils.PemEtcdPeerKey
+}
@@ -0,0 +1,128 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+
+	"github.com/darxkies/k8s-tew/utils"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// EtcdMembers records the controllers that are known to be members of the etcd cluster. Controllers that are not recorded
+// join the existing cluster instead of bootstrapping a new one.
+type EtcdMembers struct {
+	filename string
+	Names    []string `yaml:"names"`
+}
+
+func LoadEtcdMembers(filename string) (*EtcdMembers, error) {
+	members := &EtcdMembers{filename: filename, Names: []string{}}
+
+	if !utils.FileExists(filename) {
+		return members, nil
+	}
+
+	content, error := ioutil.ReadFile(filename)
+	if error != nil {
+		return nil, error
+	}
+
+	if error := yaml.Unmarshal(content, members); error != nil {
+		return nil, fmt.Errorf("Could not parse etcd members '%s' (%s)", filename, error.Error())
+	}
+
+	return members, nil
+}
+
+func (members *EtcdMembers) Save() error {
+	sort.Strings(members.Names)
+
+	content, error := yaml.Marshal(members)
+	if error != nil {
+		return error
+	}
+
+	return ioutil.WriteFile(members.filename, content, 0644)
+}
+
+func (members *EtcdMembers) Empty() bool {
+	return len(members.Names) == 0
+}
+
+func (members *EtcdMembers) Has(name string) bool {
+	for _, _name := range members.Names {
+		if _name == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (members *EtcdMembers) Add(name string) {
+	if members.Has(name) {
+		return
+	}
+
+	members.Names = append(members.Names, name)
+}
+
+func (members *EtcdMembers) Remove(name string) {
+	names := []string{}
+
+	for _, _name := range members.Names {
+		if _name != name {
+			names = append(names, _name)
+		}
+	}
+
+	members.Names = names
+}
+
+// GetEtcdJoiners returns the controllers that are not members yet in the order they are deployed
+func (config *InternalConfig) GetEtcdJoiners(members *EtcdMembers) []string {
+	result := []string{}
+
+	if members.Empty() {
+		return result
+	}
+
+	for _, nodeName := range config.GetSortedNodeKeys() {
+		if config.Config.Nodes[nodeName].IsController() && !members.Has(nodeName) {
+			result = append(result, nodeName)
+		}
+	}
+
+	return result
+}
+
+// GetEtcdInitialCluster returns the initial cluster and the initial cluster state of the named controller. A joiner has
+// to list the members it will find, which are the recorded members, the joiners deployed before it and itself.
+func (config *InternalConfig) GetEtcdInitialCluster(name string, members *EtcdMembers) (string, string) {
+	if members.Has(name) || members.Empty() {
+		return config.GetEtcdCluster(), utils.EtcdClusterStateNew
+	}
+
+	result := ""
+
+	for _, nodeName := range config.GetSortedNodeKeys() {
+		node := config.Config.Nodes[nodeName]
+
+		if !node.IsController() {
+			continue
+		}
+
+		if !members.Has(nodeName) && nodeName > name {
+			continue
+		}
+
+		if len(result) > 0 {
+			result += ","
+		}
+
+		result += fmt.Sprintf("%s=https://%s:%d", nodeName, node.IP, utils.PortEtcdPeer)
+	}
+
+	return result, utils.EtcdClusterStateExisting
+}
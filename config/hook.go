@@ -0,0 +1,33 @@
+package config
+
+import (
+	"fmt"
+
+	"github.com/darxkies/k8s-tew/utils"
+)
+
+// Hook is a site specific command executed around a deployment phase. Local hooks run on the machine executing the deployment, the others on the nodes.
+type Hook struct {
+	Name    string `yaml:"name"`
+	Phase   string `yaml:"phase"`
+	Command string `yaml:"command"`
+	Local   bool   `yaml:"local,omitempty"`
+	Labels  Labels `yaml:"labels,omitempty"`
+}
+
+type Hooks []*Hook
+
+func (hook *Hook) Validate() error {
+	for _, phase := range []string{utils.HookPreUpload, utils.HookPostUpload, utils.HookPreSetup, utils.HookPostSetup} {
+		if hook.Phase == phase {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("hook '%s' has the unknown phase '%s'", hook.Name, hook.Phase)
+}
+
+// Matches returns true if the hook belongs to the phase and to the node. Hooks without labels match all nodes.
+func (hook *Hook) Matches(phase string, node *Node) bool {
+	return hook.Phase == phase && (len(hook.Labels) == 0 || hook.Labels.HasLabels(node.Labels))
+}
@@ -2,6 +2,7 @@ package config
 
 import (
 	"bytes"
+	"crypto/sha256"
 	"errors"
 	"fmt"
 	"html/template"
@@ -137,6 +138,7 @@ func (config *InternalConfig) registerAssetDirectories() {
 	// K8S Config
 	config.addAssetDirectory(utils.DirectoryK8sConfig, Labels{}, path.Join(config.GetRelativeAssetDirectory(utils.DirectoryConfig), utils.SubdirectoryK8s), false)
 	config.addAssetDirectory(utils.DirectoryK8sKubeConfig, Labels{}, path.Join(config.GetRelativeAssetDirectory(utils.DirectoryK8sConfig), utils.SubdirectoryKubeconfig), false)
+	config.addAssetDirectory(utils.DirectoryUsers, Labels{}, path.Join(config.GetRelativeAssetDirectory(utils.DirectoryConfig), utils.SubdirectoryUsers), false)
 	config.addAssetDirectory(utils.DirectoryK8sSecurityConfig, Labels{}, path.Join(config.GetRelativeAssetDirectory(utils.DirectoryK8sConfig), utils.SubdirectorySecurity), false)
 	config.addAssetDirectory(utils.DirectoryK8sSetupConfig, Labels{}, path.Join(config.GetRelativeAssetDirectory(utils.DirectoryK8sConfig), utils.SubdirectorySetup), false)
 	config.addAssetDirectory(utils.DirectoryK8sManifests, Labels{utils.NodeController, utils.NodeWorker}, path.Join(config.GetRelativeAssetDirectory(utils.DirectoryK8sConfig), utils.SubdirectoryManifests), false)
@@ -171,6 +173,9 @@ func (config *InternalConfig) registerAssetDirectories() {
 	config.addAssetDirectory(utils.DirectoryImages, Labels{utils.NodeController, utils.NodeWorker}, path.Join(utils.SubdirectoryVariable, utils.SubdirectoryK8sTew, utils.SubdirectoryImages), false)
 	config.addAssetDirectory(utils.DirectoryRun, Labels{utils.NodeController, utils.NodeWorker}, path.Join(utils.SubdirectoryRun, utils.SubdirectoryK8sTew), false)
 	config.addAssetDirectory(utils.DirectoryVarRun, Labels{utils.NodeController, utils.NodeWorker}, path.Join(utils.SubdirectoryVariable, utils.SubdirectoryRun, utils.SubdirectoryK8sTew), false)
+	config.addAssetDirectory(utils.DirectoryRevisions, Labels{}, path.Join(config.GetRelativeAssetDirectory(utils.DirectoryDynamicData), utils.SubdirectoryRevisions), false)
+	config.addAssetDirectory(utils.DirectoryStaging, Labels{}, path.Join(config.GetRelativeAssetDirectory(utils.DirectoryDynamicData), utils.SubdirectoryStaging), false)
+	config.addAssetDirectory(utils.DirectoryEtcdSnapshots, Labels{}, path.Join(config.GetRelativeAssetDirectory(utils.DirectoryDynamicData), utils.SubdirectoryEtcdSnapshots), false)
 
 	// Ceph
 	config.addAssetDirectory(utils.DirectoryCephConfig, Labels{utils.NodeWorker}, path.Join(config.GetRelativeAssetDirectory(utils.DirectoryConfig), utils.SubdirectoryCeph), false)
@@ -185,6 +190,19 @@ func (config *InternalConfig) registerAssetDirectories() {
 func (config *InternalConfig) registerAssetFiles() {
 	// Config
 	config.addAssetFile(utils.ConfigFilename, Labels{utils.NodeController, utils.NodeWorker}, "", utils.DirectoryConfig)
+	config.addAssetFile(utils.DeploymentHistory, Labels{}, "", utils.DirectoryConfig)
+	config.addAssetFile(utils.DeploymentChecksums, Labels{}, "", utils.DirectoryConfig)
+	config.addAssetFile(utils.DeploymentManifest, Labels{}, "", utils.DirectoryConfig)
+	config.addAssetFile(utils.ResetReport, Labels{}, "", utils.DirectoryConfig)
+	config.addAssetFile(utils.DeploymentReport, Labels{}, "", utils.DirectoryConfig)
+	config.addAssetFile(utils.UpgradeState, Labels{}, "", utils.DirectoryConfig)
+	config.addAssetFile(utils.EncryptionRotationState, Labels{}, "", utils.DirectoryConfig)
+	config.addAssetFile(utils.CARotationState, Labels{}, "", utils.DirectoryConfig)
+	config.addAssetFile(utils.EtcdMembers, Labels{}, "", utils.DirectoryConfig)
+	config.addAssetFile(utils.EtcdCaMigration, Labels{utils.NodeController}, "", utils.DirectoryConfig)
+	config.addAssetFile(utils.Users, Labels{}, "", utils.DirectoryConfig)
+	config.addAssetFile(utils.ServersStatus, Labels{}, "", utils.DirectoryVarRun)
+	config.addAssetFile(utils.ControlSocket, Labels{}, "", utils.DirectoryVarRun)
 
 	// Binaries
 	config.addAssetFile(utils.BinaryK8sTew, Labels{utils.NodeController, utils.NodeWorker}, "", utils.DirectoryBinaries)
@@ -212,6 +230,9 @@ func (config *InternalConfig) registerAssetFiles() {
 	// Certificates
 	config.addAssetFile(utils.PemCa, Labels{utils.NodeController, utils.NodeWorker}, "", utils.DirectoryCertificates)
 	config.addAssetFile(utils.PemCaKey, Labels{utils.NodeController}, "", utils.DirectoryCertificates)
+	config.addAssetFile(utils.PemCaNext, Labels{}, "", utils.DirectoryCertificates)
+	config.addAssetFile(utils.PemCaNextKey, Labels{}, "", utils.DirectoryCertificates)
+	config.addAssetFile(utils.PemCaPrevious, Labels{}, "", utils.DirectoryCertificates)
 	config.addAssetFile(utils.PemKubernetes, Labels{utils.NodeController}, "", utils.DirectoryCertificates)
 	config.addAssetFile(utils.PemKubernetesKey, Labels{utils.NodeController}, "", utils.DirectoryCertificates)
 	config.addAssetFile(utils.PemServiceAccount, Labels{utils.NodeController}, "", utils.DirectoryCertificates)
@@ -228,6 +249,24 @@ func (config *InternalConfig) registerAssetFiles() {
 	config.addAssetFile(utils.PemKubeletKey, Labels{utils.NodeController, utils.NodeWorker}, "", utils.DirectoryCertificates)
 	config.addAssetFile(utils.PemAggregator, Labels{utils.NodeController}, "", utils.DirectoryCertificates)
 	config.addAssetFile(utils.PemAggregatorKey, Labels{utils.NodeController}, "", utils.DirectoryCertificates)
+	config.addAssetFile(utils.PemEtcdCa, Labels{utils.NodeController}, "", utils.DirectoryCertificates)
+	config.addAssetFile(utils.PemEtcdCaKey, Labels{}, "", utils.DirectoryCertificates)
+	config.addAssetFile(utils.PemEtcdCaNext, Labels{}, "", utils.DirectoryCertificates)
+	config.addAssetFile(utils.PemEtcdCaNextKey, Labels{}, "", utils.DirectoryCertificates)
+	config.addAssetFile(utils.PemEtcdCaPrevious, Labels{}, "", utils.DirectoryCertificates)
+	config.addAssetFile(utils.PemEtcdCaBundle, Labels{utils.NodeController}, "", utils.DirectoryCertificates)
+	config.addAssetFile(utils.PemEtcdServer, Labels{utils.NodeController}, "", utils.DirectoryCertificates)
+	config.addAssetFile(utils.PemEtcdServerKey, Labels{utils.NodeController}, "", utils.DirectoryCertificates)
+	config.addAssetFile(utils.PemEtcdPeer, Labels{utils.NodeController}, "", utils.DirectoryCertificates)
+	config.addAssetFile(utils.PemEtcdPeerKey, Labels{utils.NodeController}, "", utils.DirectoryCertificates)
+	config.addAssetFile(utils.PemEtcdClient, Labels{utils.NodeController}, "", utils.DirectoryCertificates)
+	config.addAssetFile(utils.PemEtcdClientKey, Labels{utils.NodeController}, "", utils.DirectoryCertificates)
+	config.addAssetFile(utils.PemFrontProxyCa, Labels{utils.NodeController}, "", utils.DirectoryCertificates)
+	config.addAssetFile(utils.PemFrontProxyCaKey, Labels{}, "", utils.DirectoryCertificates)
+	config.addAssetFile(utils.PemFrontProxyCaNext, Labels{}, "", utils.DirectoryCertificates)
+	config.addAssetFile(utils.PemFrontProxyCaNextKey, Labels{}, "", utils.DirectoryCertificates)
+	config.addAssetFile(utils.PemFrontProxyCaPrevious, Labels{}, "", utils.DirectoryCertificates)
+	config.addAssetFile(utils.PemOIDCCa, Labels{utils.NodeController}, "", utils.DirectoryCertificates)
 
 	// Kubeconfig
 	config.addAssetFile(utils.KubeconfigAdmin, Labels{}, "", utils.DirectoryK8sKubeConfig)
@@ -238,6 +277,8 @@ func (config *InternalConfig) registerAssetFiles() {
 
 	// Security
 	config.addAssetFile(utils.EncryptionConfig, Labels{utils.NodeController}, "", utils.DirectoryK8sSecurityConfig)
+	config.addAssetFile(utils.AuditPolicy, Labels{utils.NodeController}, "", utils.DirectoryK8sSecurityConfig)
+	config.addAssetFile(utils.AuditWebhookConfig, Labels{utils.NodeController}, "", utils.DirectoryK8sSecurityConfig)
 
 	// CRI
 	config.addAssetFile(utils.ContainerdConfig, Labels{utils.NodeController, utils.NodeWorker}, "", utils.DirectoryCriConfig)
@@ -352,49 +393,60 @@ func (config *InternalConfig) registerCommands() {
 	config.addCommand("load-br_netfilter", Labels{utils.NodeController, utils.NodeWorker}, Features{}, OS{}, "modprobe br_netfilter")
 	config.addCommand("enable-br_netfilter", Labels{utils.NodeController, utils.NodeWorker}, Features{}, OS{}, "echo '1' > /proc/sys/net/bridge/bridge-nf-call-iptables")
 	config.addCommand("enable-net-forwarding", Labels{utils.NodeController, utils.NodeWorker}, Features{}, OS{}, "sysctl net.ipv4.conf.all.forwarding=1")
-	config.addCommand("kubelet-setup", Labels{utils.NodeBootstrapper}, Features{}, OS{}, fmt.Sprintf("%s apply -f %s", kubectlCommand, config.GetFullLocalAssetFilename(utils.K8sKubeletSetup)))
-	config.addCommand("admin-user-setup", Labels{utils.NodeBootstrapper}, Features{}, OS{}, fmt.Sprintf("%s apply -f %s", kubectlCommand, config.GetFullLocalAssetFilename(utils.K8sAdminUserSetup)))
-	config.addCommand("calico-setup", Labels{utils.NodeBootstrapper}, Features{}, OS{}, fmt.Sprintf("%s apply -f %s", kubectlCommand, config.GetFullLocalAssetFilename(utils.K8sCalicoSetup)))
-	config.addCommand("metallb-setup", Labels{utils.NodeBootstrapper}, Features{}, OS{}, fmt.Sprintf("%s apply -f %s", kubectlCommand, config.GetFullLocalAssetFilename(utils.K8sMetalLBSetup)))
-	config.addCommand("coredns-setup", Labels{utils.NodeBootstrapper}, Features{}, OS{}, fmt.Sprintf("%s apply -f %s", kubectlCommand, config.GetFullLocalAssetFilename(utils.K8sCorednsSetup)))
-	config.addCommand("helm-user-setup", Labels{utils.NodeBootstrapper}, Features{utils.FeaturePackaging}, OS{}, fmt.Sprintf("%s apply -f %s", kubectlCommand, config.GetFullLocalAssetFilename(utils.K8sHelmUserSetup)))
-	config.addCommand("ceph-secrets", Labels{utils.NodeBootstrapper}, Features{utils.FeatureStorage}, OS{}, fmt.Sprintf("%s apply -f %s", kubectlCommand, config.GetFullLocalAssetFilename(utils.CephSecrets)))
-	config.addCommand("ceph-setup", Labels{utils.NodeBootstrapper}, Features{utils.FeatureStorage}, OS{}, fmt.Sprintf("%s apply -f %s", kubectlCommand, config.GetFullLocalAssetFilename(utils.CephSetup)))
-	config.addCommand("ceph-csi", Labels{utils.NodeBootstrapper}, Features{utils.FeatureStorage}, OS{}, fmt.Sprintf("%s apply -f %s", kubectlCommand, config.GetFullLocalAssetFilename(utils.CephCsi)))
+	config.addManifest("kubelet-setup", Labels{utils.NodeBootstrapper}, Features{}, utils.K8sKubeletSetup, kubectlCommand)
+	config.addManifest("admin-user-setup", Labels{utils.NodeBootstrapper}, Features{}, utils.K8sAdminUserSetup, kubectlCommand)
+	config.addManifest("calico-setup", Labels{utils.NodeBootstrapper}, Features{}, utils.K8sCalicoSetup, kubectlCommand)
+	config.addManifest("metallb-setup", Labels{utils.NodeBootstrapper}, Features{}, utils.K8sMetalLBSetup, kubectlCommand)
+	config.addManifest("coredns-setup", Labels{utils.NodeBootstrapper}, Features{}, utils.K8sCorednsSetup, kubectlCommand)
+	config.addManifest("helm-user-setup", Labels{utils.NodeBootstrapper}, Features{utils.FeaturePackaging}, utils.K8sHelmUserSetup, kubectlCommand)
+	config.addManifest("ceph-secrets", Labels{utils.NodeBootstrapper}, Features{utils.FeatureStorage}, utils.CephSecrets, kubectlCommand)
+	config.addManifest("ceph-setup", Labels{utils.NodeBootstrapper}, Features{utils.FeatureStorage}, utils.CephSetup, kubectlCommand)
+	config.addManifest("ceph-csi", Labels{utils.NodeBootstrapper}, Features{utils.FeatureStorage}, utils.CephCsi, kubectlCommand)
 	config.addCommand("helm-init", Labels{utils.NodeBootstrapper}, Features{utils.FeaturePackaging}, OS{}, fmt.Sprintf("%s init --service-account %s --upgrade", helmCommand, utils.HelmServiceAccount))
-	config.addCommand("kubernetes-dashboard-setup", Labels{utils.NodeBootstrapper}, Features{}, OS{}, fmt.Sprintf("%s apply -f %s", kubectlCommand, config.GetFullLocalAssetFilename(utils.K8sKubernetesDashboardSetup)))
-	config.addCommand("cert-manager-setup", Labels{utils.NodeBootstrapper}, Features{utils.FeatureIngress}, OS{}, fmt.Sprintf("%s apply -f %s", kubectlCommand, config.GetFullLocalAssetFilename(utils.K8sCertManagerSetup)))
-	config.addCommand("nginx-ingress-setup", Labels{utils.NodeBootstrapper}, Features{utils.FeatureIngress}, OS{}, fmt.Sprintf("%s apply -f %s", kubectlCommand, config.GetFullLocalAssetFilename(utils.K8sNginxIngressSetup)))
-	config.addCommand("letsencrypt-cluster-issuer-setup", Labels{utils.NodeBootstrapper}, Features{utils.FeatureIngress}, OS{}, fmt.Sprintf("%s apply -f %s", kubectlCommand, config.GetFullLocalAssetFilename(utils.LetsencryptClusterIssuer)))
-	config.addCommand("heapster-setup", Labels{utils.NodeBootstrapper}, Features{utils.FeatureMonitoring, utils.FeatureStorage}, OS{}, fmt.Sprintf("%s apply -f %s", kubectlCommand, config.GetFullLocalAssetFilename(utils.K8sHeapsterSetup)))
-	config.addCommand("metrics-server-setup", Labels{utils.NodeBootstrapper}, Features{utils.FeatureMonitoring, utils.FeatureStorage}, OS{}, fmt.Sprintf("%s apply -f %s", kubectlCommand, config.GetFullLocalAssetFilename(utils.K8sMetricsServerSetup)))
-	config.addCommand("prometheus-operator-setup", Labels{utils.NodeBootstrapper}, Features{utils.FeatureMonitoring, utils.FeatureStorage}, OS{}, fmt.Sprintf("%s apply -f %s", kubectlCommand, config.GetFullLocalAssetFilename(utils.K8sPrometheusOperatorSetup)))
-	config.addCommand("kube-prometheus-datasource-setup", Labels{utils.NodeBootstrapper}, Features{utils.FeatureMonitoring, utils.FeatureStorage}, OS{}, fmt.Sprintf("%s apply -f %s", kubectlCommand, config.GetFullLocalAssetFilename(utils.K8sKubePrometheusDatasourceSetup)))
-	config.addCommand("kube-prometheus-kuberntes-cluster-status-dashboard-setup", Labels{utils.NodeBootstrapper}, Features{utils.FeatureMonitoring, utils.FeatureStorage}, OS{}, fmt.Sprintf("%s apply -f %s", kubectlCommand, config.GetFullLocalAssetFilename(utils.K8sKubePrometheusKubernetesClusterStatusDashboardSetup)))
-	config.addCommand("kube-prometheus-kuberntes-cluster-health-dashboard-setup", Labels{utils.NodeBootstrapper}, Features{utils.FeatureMonitoring, utils.FeatureStorage}, OS{}, fmt.Sprintf("%s apply -f %s", kubectlCommand, config.GetFullLocalAssetFilename(utils.K8sKubePrometheusKubernetesClusterHealthDashboardSetup)))
-	config.addCommand("kube-prometheus-kuberntes-control-plane-status-dashboard-setup", Labels{utils.NodeBootstrapper}, Features{utils.FeatureMonitoring, utils.FeatureStorage}, OS{}, fmt.Sprintf("%s apply -f %s", kubectlCommand, config.GetFullLocalAssetFilename(utils.K8sKubePrometheusKubernetesControlPlaneStatusDashboardSetup)))
-	config.addCommand("kube-prometheus-kuberntes-capacity-planning-dashboard-setup", Labels{utils.NodeBootstrapper}, Features{utils.FeatureMonitoring, utils.FeatureStorage}, OS{}, fmt.Sprintf("%s apply -f %s", kubectlCommand, config.GetFullLocalAssetFilename(utils.K8sKubePrometheusKubernetesCapacityPlanningDashboardSetup)))
-	config.addCommand("kube-prometheus-kuberntes-resource-requests-dashboard-setup", Labels{utils.NodeBootstrapper}, Features{utils.FeatureMonitoring, utils.FeatureStorage}, OS{}, fmt.Sprintf("%s apply -f %s", kubectlCommand, config.GetFullLocalAssetFilename(utils.K8sKubePrometheusKubernetesResourceRequestsDashboardSetup)))
-	config.addCommand("kube-prometheus-nodes-dashboard-setup", Labels{utils.NodeBootstrapper}, Features{utils.FeatureMonitoring, utils.FeatureStorage}, OS{}, fmt.Sprintf("%s apply -f %s", kubectlCommand, config.GetFullLocalAssetFilename(utils.K8sKubePrometheusNodesDashboardSetup)))
-	config.addCommand("kube-prometheus-deployment-dashboard-setup", Labels{utils.NodeBootstrapper}, Features{utils.FeatureMonitoring, utils.FeatureStorage}, OS{}, fmt.Sprintf("%s apply -f %s", kubectlCommand, config.GetFullLocalAssetFilename(utils.K8sKubePrometheusDeploymentDashboardSetup)))
-	config.addCommand("kube-prometheus-statefulset-dashboard-setup", Labels{utils.NodeBootstrapper}, Features{utils.FeatureMonitoring, utils.FeatureStorage}, OS{}, fmt.Sprintf("%s apply -f %s", kubectlCommand, config.GetFullLocalAssetFilename(utils.K8sKubePrometheusStatefulsetDashboardSetup)))
-	config.addCommand("kube-prometheus-pods-dashboard-setup", Labels{utils.NodeBootstrapper}, Features{utils.FeatureMonitoring, utils.FeatureStorage}, OS{}, fmt.Sprintf("%s apply -f %s", kubectlCommand, config.GetFullLocalAssetFilename(utils.K8sKubePrometheusPodsDashboardSetup)))
-	config.addCommand("kube-prometheus-setup", Labels{utils.NodeBootstrapper}, Features{utils.FeatureMonitoring, utils.FeatureStorage}, OS{}, fmt.Sprintf("%s apply -f %s", kubectlCommand, config.GetFullLocalAssetFilename(utils.K8sKubePrometheusSetup)))
-	config.addCommand("elasticsearch-operator-setup", Labels{utils.NodeBootstrapper}, Features{utils.FeatureLogging, utils.FeatureStorage}, OS{}, fmt.Sprintf("%s apply -f %s", kubectlCommand, config.GetFullLocalAssetFilename(utils.K8sElasticsearchOperatorSetup)))
-	config.addCommand("efk-setup", Labels{utils.NodeBootstrapper}, Features{utils.FeatureLogging, utils.FeatureStorage}, OS{}, fmt.Sprintf("%s apply -f %s", kubectlCommand, config.GetFullLocalAssetFilename(utils.K8sEfkSetup)))
+	config.addManifest("kubernetes-dashboard-setup", Labels{utils.NodeBootstrapper}, Features{}, utils.K8sKubernetesDashboardSetup, kubectlCommand)
+	config.addManifest("cert-manager-setup", Labels{utils.NodeBootstrapper}, Features{utils.FeatureIngress}, utils.K8sCertManagerSetup, kubectlCommand)
+	config.addManifest("nginx-ingress-setup", Labels{utils.NodeBootstrapper}, Features{utils.FeatureIngress}, utils.K8sNginxIngressSetup, kubectlCommand)
+	config.addManifest("letsencrypt-cluster-issuer-setup", Labels{utils.NodeBootstrapper}, Features{utils.FeatureIngress}, utils.LetsencryptClusterIssuer, kubectlCommand)
+	config.addManifest("heapster-setup", Labels{utils.NodeBootstrapper}, Features{utils.FeatureMonitoring, utils.FeatureStorage}, utils.K8sHeapsterSetup, kubectlCommand)
+	config.addManifest("metrics-server-setup", Labels{utils.NodeBootstrapper}, Features{utils.FeatureMonitoring, utils.FeatureStorage}, utils.K8sMetricsServerSetup, kubectlCommand)
+	config.addManifest("prometheus-operator-setup", Labels{utils.NodeBootstrapper}, Features{utils.FeatureMonitoring, utils.FeatureStorage}, utils.K8sPrometheusOperatorSetup, kubectlCommand)
+	config.addManifest("kube-prometheus-datasource-setup", Labels{utils.NodeBootstrapper}, Features{utils.FeatureMonitoring, utils.FeatureStorage}, utils.K8sKubePrometheusDatasourceSetup, kubectlCommand)
+	config.addManifest("kube-prometheus-kuberntes-cluster-status-dashboard-setup", Labels{utils.NodeBootstrapper}, Features{utils.FeatureMonitoring, utils.FeatureStorage}, utils.K8sKubePrometheusKubernetesClusterStatusDashboardSetup, kubectlCommand)
+	config.addManifest("kube-prometheus-kuberntes-cluster-health-dashboard-setup", Labels{utils.NodeBootstrapper}, Features{utils.FeatureMonitoring, utils.FeatureStorage}, utils.K8sKubePrometheusKubernetesClusterHealthDashboardSetup, kubectlCommand)
+	config.addManifest("kube-prometheus-kuberntes-control-plane-status-dashboard-setup", Labels{utils.NodeBootstrapper}, Features{utils.FeatureMonitoring, utils.FeatureStorage}, utils.K8sKubePrometheusKubernetesControlPlaneStatusDashboardSetup, kubectlCommand)
+	config.addManifest("kube-prometheus-kuberntes-capacity-planning-dashboard-setup", Labels{utils.NodeBootstrapper}, Features{utils.FeatureMonitoring, utils.FeatureStorage}, utils.K8sKubePrometheusKubernetesCapacityPlanningDashboardSetup, kubectlCommand)
+	config.addManifest("kube-prometheus-kuberntes-resource-requests-dashboard-setup", Labels{utils.NodeBootstrapper}, Features{utils.FeatureMonitoring, utils.FeatureStorage}, utils.K8sKubePrometheusKubernetesResourceRequestsDashboardSetup, kubectlCommand)
+	config.addManifest("kube-prometheus-nodes-dashboard-setup", Labels{utils.NodeBootstrapper}, Features{utils.FeatureMonitoring, utils.FeatureStorage}, utils.K8sKubePrometheusNodesDashboardSetup, kubectlCommand)
+	config.addManifest("kube-prometheus-deployment-dashboard-setup", Labels{utils.NodeBootstrapper}, Features{utils.FeatureMonitoring, utils.FeatureStorage}, utils.K8sKubePrometheusDeploymentDashboardSetup, kubectlCommand)
+	config.addManifest("kube-prometheus-statefulset-dashboard-setup", Labels{utils.NodeBootstrapper}, Features{utils.FeatureMonitoring, utils.FeatureStorage}, utils.K8sKubePrometheusStatefulsetDashboardSetup, kubectlCommand)
+	config.addManifest("kube-prometheus-pods-dashboard-setup", Labels{utils.NodeBootstrapper}, Features{utils.FeatureMonitoring, utils.FeatureStorage}, utils.K8sKubePrometheusPodsDashboardSetup, kubectlCommand)
+	config.addManifest("kube-prometheus-setup", Labels{utils.NodeBootstrapper}, Features{utils.FeatureMonitoring, utils.FeatureStorage}, utils.K8sKubePrometheusSetup, kubectlCommand)
+	config.addManifest("elasticsearch-operator-setup", Labels{utils.NodeBootstrapper}, Features{utils.FeatureLogging, utils.FeatureStorage}, utils.K8sElasticsearchOperatorSetup, kubectlCommand)
+	config.addManifest("efk-setup", Labels{utils.NodeBootstrapper}, Features{utils.FeatureLogging, utils.FeatureStorage}, utils.K8sEfkSetup, kubectlCommand)
 	config.addCommand("patch-kibana-service", Labels{utils.NodeBootstrapper}, Features{utils.FeatureLogging, utils.FeatureStorage}, OS{}, fmt.Sprintf(`%s get svc kibana-elasticsearch-cluster -n logging --output=jsonpath={.spec..nodePort} | grep %d || %s patch service kibana-elasticsearch-cluster -n logging -p '{"spec":{"type":"NodePort","ports":[{"port":80,"nodePort":%d}]}}'`, kubectlCommand, utils.PortKibana, kubectlCommand, utils.PortKibana))
 	config.addCommand("patch-cerebro-service", Labels{utils.NodeBootstrapper}, Features{utils.FeatureLogging, utils.FeatureStorage}, OS{}, fmt.Sprintf(`%s get svc cerebro-elasticsearch-cluster -n logging --output=jsonpath={.spec..nodePort} | grep %d || %s patch service cerebro-elasticsearch-cluster -n logging -p '{"spec":{"type":"NodePort","ports":[{"port":80,"nodePort":%d}]}}'`, kubectlCommand, utils.PortCerebro, kubectlCommand, utils.PortCerebro))
-	config.addCommand("velero-setup", Labels{utils.NodeBootstrapper}, Features{utils.FeatureBackup, utils.FeatureStorage}, OS{}, fmt.Sprintf("%s apply -f %s", kubectlCommand, config.GetFullLocalAssetFilename(utils.K8sVeleroSetup)))
-	config.addCommand("wordpress-setup", Labels{utils.NodeBootstrapper}, Features{utils.FeatureShowcase, utils.FeatureStorage}, OS{}, fmt.Sprintf("%s apply -f %s", kubectlCommand, config.GetFullLocalAssetFilename(utils.WordpressSetup)))
+	config.addManifest("velero-setup", Labels{utils.NodeBootstrapper}, Features{utils.FeatureBackup, utils.FeatureStorage}, utils.K8sVeleroSetup, kubectlCommand)
+	config.addManifest("wordpress-setup", Labels{utils.NodeBootstrapper}, Features{utils.FeatureShowcase, utils.FeatureStorage}, utils.WordpressSetup, kubectlCommand)
 }
 
 func (config *InternalConfig) Generate() {
+	config.GenerateMinioKeys()
 	config.registerAssetDirectories()
 	config.registerAssetFiles()
 	config.registerCommands()
 	config.registerServers()
 }
 
+// GenerateMinioKeys creates the credentials of minio once, existing credentials are kept
+func (config *InternalConfig) GenerateMinioKeys() {
+	if len(config.Config.MinioAccessKey) > 0 && len(config.Config.MinioSecretKey) > 0 {
+		return
+	}
+
+	config.Config.MinioAccessKey = newMinioKey(utils.MinioAccessKeyLength)
+	config.Config.MinioSecretKey = newMinioKey(utils.MinioSecretKeyLength)
+}
+
 func (config *InternalConfig) addServer(name string, labels []string, command string, arguments map[string]string) {
 	// Do not add if already in the list
 	for _, server := range config.Config.Servers {
@@ -403,7 +455,7 @@ func (config *InternalConfig) addServer(name string, labels []string, command st
 		}
 	}
 
-	config.Config.Servers = append(config.Config.Servers, ServerConfig{Name: name, Enabled: true, Labels: labels, Command: command, Arguments: arguments, Logger: LoggerConfig{Enabled: true, Filename: path.Join(config.GetTemplateAssetDirectory(utils.DirectoryLogging), name+".log")}})
+	config.Config.Servers = append(config.Config.Servers, ServerConfig{Name: name, Enabled: true, Labels: labels, Command: command, Arguments: arguments, Logger: LoggerConfig{Enabled: true, Filename: path.Join(config.GetTemplateAssetDirectory(utils.DirectoryLogging), name+".log"), MaxSize: utils.LoggerMaxSize, MaxBackups: utils.LoggerMaxBackups, Compress: true}})
 }
 
 func (config *InternalConfig) addCommand(name string, labels Labels, features Features, os OS, command string) {
@@ -417,6 +469,25 @@ func (config *InternalConfig) addCommand(name string, labels Labels, features Fe
 	config.Config.Commands = append(config.Config.Commands, NewCommand(name, labels, features, os, command))
 }
 
+// addManifest registers a manifest to be applied natively. Commands generated by previous versions, which applied the same manifest with kubectl, are converted unless they were modified.
+func (config *InternalConfig) addManifest(name string, labels Labels, features Features, manifest string, kubectlCommand string) {
+	legacyCommand := fmt.Sprintf("%s apply -f %s", kubectlCommand, config.GetFullLocalAssetFilename(manifest))
+
+	for index, command := range config.Config.Commands {
+		if command.Name != name {
+			continue
+		}
+
+		if command.Command == legacyCommand {
+			config.Config.Commands[index] = NewManifestCommand(name, labels, features, manifest)
+		}
+
+		return
+	}
+
+	config.Config.Commands = append(config.Config.Commands, NewManifestCommand(name, labels, features, manifest))
+}
+
 func (config *InternalConfig) addAssetFile(name string, labels Labels, filename, directory string) {
 	config.Config.Assets.Files[name] = NewAssetFile(labels, filename, directory)
 }
@@ -444,7 +515,7 @@ func (config *InternalConfig) Dump() {
 	}
 
 	for name, command := range config.Config.Commands {
-		log.WithFields(log.Fields{"name": name, "command": command.Command, "labels": command.Labels}).Info("Config command")
+		log.WithFields(log.Fields{"name": name, "command": command.Command, "manifest": command.Manifest, "labels": command.Labels}).Info("Config command")
 	}
 
 	for _, serverConfig := range config.Config.Servers {
@@ -532,6 +603,16 @@ func (config *InternalConfig) Load() error {
 	return nil
 }
 
+// GetConfigVersion returns the checksum of the config file. Nodes running an older config report a different version.
+func (config *InternalConfig) GetConfigVersion() (string, error) {
+	content, error := ioutil.ReadFile(config.getConfigFilename())
+	if error != nil {
+		return "", error
+	}
+
+	return fmt.Sprintf("%x", sha256.Sum256(content))[:12], nil
+}
+
 func (config *InternalConfig) RemoveNode(name string) error {
 	if _, ok := config.Config.Nodes[name]; !ok {
 		return errors.New("node not found")
@@ -558,12 +639,49 @@ func (config *InternalConfig) AddNode(name string, ip string, index uint, labels
 	return config.Config.Nodes[name], nil
 }
 
+// GetOwnedPaths returns the files deployed to a node with the given labels and the directories that belong exclusively to k8s-tew
+func (config *InternalConfig) GetOwnedPaths(baseDirectory string, labels Labels) []string {
+	paths := map[string]bool{}
+
+	for name, file := range config.Config.Assets.Files {
+		if !CompareLabels(labels, file.Labels) {
+			continue
+		}
+
+		paths[config.GetFullAssetFilename(baseDirectory, name)] = true
+	}
+
+	for name, directory := range config.Config.Assets.Directories {
+		for _, component := range strings.Split(directory.Directory, "/") {
+			if component == utils.SubdirectoryK8sTew {
+				paths[config.GetFullAssetDirectory(baseDirectory, name)] = true
+
+				break
+			}
+		}
+	}
+
+	if path.Clean(baseDirectory) != "/" {
+		paths[baseDirectory] = true
+	}
+
+	result := []string{}
+
+	for filename := range paths {
+		result = append(result, filename)
+	}
+
+	sort.Strings(result)
+
+	return result
+}
+
 func (config *InternalConfig) GetETCDClientEndpoints() []string {
 	result := []string{}
 
 	for _, node := range config.Config.Nodes {
 		if node.IsController() {
-			result = append(result, fmt.Sprintf("https://%s:2379", node.IP))
+			result = append(result, fmt.Sprintf("https://%s:%d", node.IP, utils.PortEtcdClient))
 		}
 	}
 
@@ -582,7 +700,7 @@ func (config *InternalConfig) GetEtcdCluster() string {
 			result += ","
 		}
 
-		result += fmt.Sprintf("%s=https://%s:2380", name, node.IP)
+		result += fmt.Sprintf("%s=https://%s:%d", name, node.IP, utils.PortEtcdPeer)
 	}
 
 	return result
@@ -661,6 +779,32 @@ func (config *InternalConfig) GetAPIServerIP() (string, error) {
 	return "", errors.New("No API Server IP found")
 }
 
+// GetKubernetesServiceIP returns the first IP of the cluster IP range, which is assigned to the kubernetes service
+func (config *InternalConfig) GetKubernetesServiceIP() (string, error) {
+	_, network, error := net.ParseCIDR(config.Config.ClusterIPRange)
+	if error != nil {
+		return "", fmt.Errorf("Invalid cluster IP range '%s' (%s)", config.Config.ClusterIPRange, error.Error())
+	}
+
+	ip := make(net.IP, len(network.IP))
+
+	copy(ip, network.IP)
+
+	for i := len(ip) - 1; i >= 0; i-- {
+		ip[i]++
+
+		if ip[i] != 0 {
+			break
+		}
+	}
+
+	if !network.Contains(ip) {
+		return "", fmt.Errorf("The cluster IP range '%s' is too small", config.Config.ClusterIPRange)
+	}
+
+	return ip.String(), nil
+}
+
 func (config *InternalConfig) GetWorkerIP() (string, error) {
 	if len(config.Config.WorkerVirtualIP) > 0 {
 		return config.Config.WorkerVirtualIP, nil
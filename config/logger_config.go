@@ -1,6 +1,45 @@
 package config
 
+import (
+	"fmt"
+
+	"github.com/darxkies/k8s-tew/utils"
+)
+
+// LoggerConfig sets where the output of a server is written to. The log file is rotated when it reaches the maximum
+// size or, if an interval is set, when it gets older than the interval.
 type LoggerConfig struct {
-	Enabled  bool   `yaml:"enabled"`
-	Filename string `yaml:"filename"`
+	Enabled    bool   `yaml:"enabled"`
+	Filename   string `yaml:"filename"`
+	MaxSize    uint   `yaml:"max-size,omitempty"`
+	Interval   uint   `yaml:"interval,omitempty"`
+	MaxBackups uint   `yaml:"max-backups,omitempty"`
+	Compress   bool   `yaml:"compress,omitempty"`
+	Forward    string `yaml:"forward,omitempty"`
+}
+
+// GetMaxSize returns the maximum size of the log file in megabytes
+func (config LoggerConfig) GetMaxSize() uint {
+	if config.MaxSize == 0 {
+		return utils.LoggerMaxSize
+	}
+
+	return config.MaxSize
+}
+
+// GetMaxBackups returns the count of rotated log files kept
+func (config LoggerConfig) GetMaxBackups() uint {
+	if config.MaxBackups == 0 {
+		return utils.LoggerMaxBackups
+	}
+
+	return config.MaxBackups
+}
+
+func (config LoggerConfig) Validate() error {
+	if len(config.Forward) > 0 && config.Forward != utils.LoggerForwardJournald && config.Forward != utils.LoggerForwardSyslog {
+		return fmt.Errorf("unsupported log forwarding '%s', use %s or %s", config.Forward, utils.LoggerForwardJournald, utils.LoggerForwardSyslog)
+	}
+
+	return nil
 }
@@ -0,0 +1,37 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// OIDC configures the API servers to authenticate users with the ID tokens of an OpenID Connect provider
+type OIDC struct {
+	IssuerURL      string `yaml:"issuer-url,omitempty"`
+	ClientID       string `yaml:"client-id,omitempty"`
+	UsernameClaim  string `yaml:"username-claim,omitempty"`
+	UsernamePrefix string `yaml:"username-prefix,omitempty"`
+	GroupsClaim    string `yaml:"groups-claim,omitempty"`
+	GroupsPrefix   string `yaml:"groups-prefix,omitempty"`
+	CAFile         string `yaml:"ca-file,omitempty"`
+}
+
+func (oidc OIDC) Enabled() bool {
+	return len(oidc.IssuerURL) > 0
+}
+
+func (oidc OIDC) Validate() error {
+	if !oidc.Enabled() {
+		return nil
+	}
+
+	if !strings.HasPrefix(oidc.IssuerURL, "https://") {
+		return fmt.Errorf("the OIDC issuer URL '%s' has to use https", oidc.IssuerURL)
+	}
+
+	if len(oidc.ClientID) == 0 {
+		return fmt.Errorf("the OIDC client id is missing")
+	}
+
+	return nil
+}
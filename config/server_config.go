@@ -1,22 +1,48 @@
 package config
 
 import (
+	"fmt"
+
+	"github.com/darxkies/k8s-tew/utils"
 	log "github.com/sirupsen/logrus"
 )
 
 type ServerConfig struct {
-	Name      string            `yaml:"name"`
-	Enabled   bool              `yaml:"enabled"`
-	Labels    Labels            `yaml:"labels"`
-	Logger    LoggerConfig      `yaml:"logger"`
-	Command   string            `yaml:"command"`
-	Arguments map[string]string `yaml:"arguments"`
+	Name          string            `yaml:"name"`
+	Enabled       bool              `yaml:"enabled"`
+	Labels        Labels            `yaml:"labels"`
+	Logger        LoggerConfig      `yaml:"logger"`
+	RestartPolicy string            `yaml:"restart-policy,omitempty"`
+	Command       string            `yaml:"command"`
+	Arguments     map[string]string `yaml:"arguments"`
 }
 
 type Servers []ServerConfig
 
+// GetRestartPolicy returns the restart policy, servers are always restarted unless configured otherwise
+func (config ServerConfig) GetRestartPolicy() string {
+	if len(config.RestartPolicy) == 0 {
+		return utils.RestartPolicyAlways
+	}
+
+	return config.RestartPolicy
+}
+
+func (config ServerConfig) Validate() error {
+	if error := config.Logger.Validate(); error != nil {
+		return fmt.Errorf("invalid logger of server '%s' (%s)", config.Name, error.Error())
+	}
+
+	switch config.GetRestartPolicy() {
+	case utils.RestartPolicyAlways, utils.RestartPolicyOnFailure, utils.RestartPolicyNever:
+		return nil
+	}
+
+	return fmt.Errorf("unsupported restart policy '%s' of server '%s', use %s, %s or %s", config.RestartPolicy, config.Name, utils.RestartPolicyAlways, utils.RestartPolicyOnFailure, utils.RestartPolicyNever)
+}
+
 func (config ServerConfig) Dump() {
-	log.WithFields(log.Fields{"name": config.Name, "labels": config.Labels, "command": config.Command}).Info("Config server")
+	log.WithFields(log.Fields{"name": config.Name, "labels": config.Labels, "command": config.Command, "restart-policy": config.GetRestartPolicy()}).Info("Config server")
 
 	for key, value := range config.Arguments {
 		log.WithFields(log.Fields{"name": config.Name, "argument": key, "value": value}).Info("Config server argument")
@@ -0,0 +1,137 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"syscall"
+	"time"
+
+	"github.com/darxkies/k8s-tew/utils"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// ServerStatus is the state of a server supervised by 'k8s-tew run'
+type ServerStatus struct {
+	Name          string     `yaml:"name" json:"name"`
+	State         string     `yaml:"state" json:"state"`
+	RestartPolicy string     `yaml:"restart-policy" json:"restart-policy"`
+	Degraded      bool       `yaml:"degraded,omitempty" json:"degraded,omitempty"`
+	PID           int        `yaml:"pid,omitempty" json:"pid,omitempty"`
+	Restarts      uint       `yaml:"restarts" json:"restarts"`
+	StartedAt     *time.Time `yaml:"started-at,omitempty" json:"started-at,omitempty"`
+	ExitedAt      *time.Time `yaml:"exited-at,omitempty" json:"exited-at,omitempty"`
+	ExitCode      *int       `yaml:"exit-code,omitempty" json:"exit-code,omitempty"`
+	Signal        string     `yaml:"signal,omitempty" json:"signal,omitempty"`
+	Error         string     `yaml:"error,omitempty" json:"error,omitempty"`
+	Uptime        string     `yaml:"-" json:"uptime,omitempty"`
+}
+
+// Failed returns true if the server exited unsuccessfully and is not restarted anymore
+func (status ServerStatus) Failed() bool {
+	return status.State == utils.ServerStateExited && (status.ExitCode == nil || *status.ExitCode != 0)
+}
+
+// CommandStatus is the state of a command executed by 'k8s-tew run'
+type CommandStatus struct {
+	Name       string     `yaml:"name" json:"name"`
+	State      string     `yaml:"state" json:"state"`
+	StartedAt  *time.Time `yaml:"started-at,omitempty" json:"started-at,omitempty"`
+	FinishedAt *time.Time `yaml:"finished-at,omitempty" json:"finished-at,omitempty"`
+	Error      string     `yaml:"error,omitempty" json:"error,omitempty"`
+}
+
+// ServersStatus is written by 'k8s-tew run' whenever the state of a server changes
+type ServersStatus struct {
+	filename      string
+	Node          string          `yaml:"node" json:"node"`
+	PID           int             `yaml:"pid" json:"pid"`
+	Running       bool            `yaml:"-" json:"running"`
+	ConfigVersion string          `yaml:"config-version" json:"config-version"`
+	UpdatedAt     time.Time       `yaml:"updated-at" json:"updated-at"`
+	Servers       []ServerStatus  `yaml:"servers" json:"servers"`
+	Commands      []CommandStatus `yaml:"commands" json:"commands"`
+}
+
+func NewServersStatus(filename, node string) *ServersStatus {
+	return &ServersStatus{filename: filename, Node: node, PID: os.Getpid(), Servers: []ServerStatus{}, Commands: []CommandStatus{}}
+}
+
+func LoadServersStatus(filename string) (*ServersStatus, error) {
+	if !utils.FileExists(filename) {
+		return nil, fmt.Errorf("No status found in '%s', is 'k8s-tew run' running?", filename)
+	}
+
+	content, error := ioutil.ReadFile(filename)
+	if error != nil {
+		return nil, error
+	}
+
+	status := &ServersStatus{filename: filename}
+
+	if error := yaml.Unmarshal(content, status); error != nil {
+		return nil, fmt.Errorf("Could not parse servers status '%s' (%s)", filename, error.Error())
+	}
+
+	return status, nil
+}
+
+// Save replaces the file at once, so that readers never see a partial status
+func (status *ServersStatus) Save() error {
+	sort.Slice(status.Servers, func(i, j int) bool {
+		return status.Servers[i].Name < status.Servers[j].Name
+	})
+
+	status.UpdatedAt = time.Now().UTC().Truncate(time.Second)
+
+	content, error := yaml.Marshal(status)
+	if error != nil {
+		return error
+	}
+
+	temporaryFilename := status.filename + ".tmp"
+
+	if error := ioutil.WriteFile(temporaryFilename, content, 0644); error != nil {
+		return error
+	}
+
+	return os.Rename(temporaryFilename, status.filename)
+}
+
+// IsRunning returns true if the process that wrote the status is still alive
+func (status *ServersStatus) IsRunning() bool {
+	error := syscall.Kill(status.PID, 0)
+
+	return error == nil || error == syscall.EPERM
+}
+
+// SetUptimes sets the uptime of the running servers
+func (status *ServersStatus) SetUptimes() {
+	for index := range status.Servers {
+		server := &status.Servers[index]
+
+		if server.State != utils.ServerStateRunning || server.StartedAt == nil {
+			continue
+		}
+
+		server.Uptime = time.Since(*server.StartedAt).Truncate(time.Second).String()
+	}
+}
+
+// Degraded returns true if a server is crash looping or failed, or if a command failed
+func (status *ServersStatus) Degraded() bool {
+	for _, server := range status.Servers {
+		if server.Degraded || server.Failed() {
+			return true
+		}
+	}
+
+	for _, command := range status.Commands {
+		if command.State == utils.CommandStateFailed {
+			return true
+		}
+	}
+
+	return false
+}
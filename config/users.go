@@ -0,0 +1,126 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/darxkies/k8s-tew/utils"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// UserBinding grants a cluster role to a user, in a namespace or cluster-wide if no namespace is set
+type UserBinding struct {
+	Role      string `yaml:"role"`
+	Namespace string `yaml:"namespace,omitempty"`
+}
+
+// ParseUserBinding parses bindings in the format role[:namespace]
+func ParseUserBinding(value string) (UserBinding, error) {
+	parts := strings.SplitN(value, ":", 2)
+
+	binding := UserBinding{Role: parts[0]}
+
+	if len(parts) > 1 {
+		binding.Namespace = parts[1]
+	}
+
+	if binding.Role != utils.UserRoleView && binding.Role != utils.UserRoleEdit && binding.Role != utils.UserRoleAdmin && binding.Role != utils.UserRoleClusterAdmin {
+		return binding, fmt.Errorf("unsupported role '%s'", binding.Role)
+	}
+
+	if binding.Role == utils.UserRoleClusterAdmin && len(binding.Namespace) > 0 {
+		return binding, fmt.Errorf("role '%s' cannot be bound to a namespace", binding.Role)
+	}
+
+	return binding, nil
+}
+
+func (binding UserBinding) String() string {
+	if len(binding.Namespace) == 0 {
+		return binding.Role
+	}
+
+	return fmt.Sprintf("%s:%s", binding.Role, binding.Namespace)
+}
+
+// User is a certificate issued for a person
+type User struct {
+	Name      string        `yaml:"name"`
+	Groups    []string      `yaml:"groups,omitempty"`
+	Serial    string        `yaml:"serial"`
+	IssuedAt  time.Time     `yaml:"issued-at"`
+	ExpiresAt time.Time     `yaml:"expires-at"`
+	Bindings  []UserBinding `yaml:"bindings,omitempty"`
+	RevokedAt *time.Time    `yaml:"revoked-at,omitempty"`
+}
+
+func (user *User) IsRevoked() bool {
+	return user.RevokedAt != nil
+}
+
+func (user *User) IsExpired() bool {
+	return time.Now().After(user.ExpiresAt)
+}
+
+// Users records the certificates issued with 'user add'. A user issued again replaces the older entry.
+type Users struct {
+	filename string
+	Users    []*User `yaml:"users"`
+}
+
+func LoadUsers(filename string) (*Users, error) {
+	users := &Users{filename: filename, Users: []*User{}}
+
+	if !utils.FileExists(filename) {
+		return users, nil
+	}
+
+	content, error := ioutil.ReadFile(filename)
+	if error != nil {
+		return nil, error
+	}
+
+	if error := yaml.Unmarshal(content, users); error != nil {
+		return nil, fmt.Errorf("Could not parse users '%s' (%s)", filename, error.Error())
+	}
+
+	return users, nil
+}
+
+func (users *Users) Save() error {
+	sort.Slice(users.Users, func(i, j int) bool {
+		return users.Users[i].Name < users.Users[j].Name
+	})
+
+	content, error := yaml.Marshal(users)
+	if error != nil {
+		return error
+	}
+
+	return ioutil.WriteFile(users.filename, content, 0644)
+}
+
+func (users *Users) Get(name string) *User {
+	for _, user := range users.Users {
+		if user.Name == name {
+			return user
+		}
+	}
+
+	return nil
+}
+
+func (users *Users) Set(user *User) {
+	for i, _user := range users.Users {
+		if _user.Name == user.Name {
+			users.Users[i] = user
+
+			return
+		}
+	}
+
+	users.Users = append(users.Users, user)
+}
@@ -0,0 +1,112 @@
+package deployment
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+
+	"github.com/darxkies/k8s-tew/utils"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Checksum is the SHA-256 value of a local file together with the attributes it was computed for
+type Checksum struct {
+	Size     int64  `yaml:"size"`
+	Modified int64  `yaml:"modified"`
+	Value    string `yaml:"value"`
+}
+
+// Checksums caches the checksums of the local assets so that unchanged files are not hashed on every deployment
+type Checksums struct {
+	filename string
+	mutex    sync.Mutex
+	changed  bool
+	Files    map[string]*Checksum `yaml:"files"`
+}
+
+func LoadChecksums(filename string) (*Checksums, error) {
+	checksums := &Checksums{filename: filename, Files: map[string]*Checksum{}}
+
+	if !utils.FileExists(filename) {
+		return checksums, nil
+	}
+
+	content, error := ioutil.ReadFile(filename)
+	if error != nil {
+		return nil, error
+	}
+
+	if error := yaml.Unmarshal(content, checksums); error != nil {
+		return nil, fmt.Errorf("Could not parse checksums '%s' (%s)", filename, error.Error())
+	}
+
+	if checksums.Files == nil {
+		checksums.Files = map[string]*Checksum{}
+	}
+
+	return checksums, nil
+}
+
+func (checksums *Checksums) Save() error {
+	checksums.mutex.Lock()
+	defer checksums.mutex.Unlock()
+
+	if !checksums.changed {
+		return nil
+	}
+
+	content, error := yaml.Marshal(checksums)
+	if error != nil {
+		return error
+	}
+
+	if error := ioutil.WriteFile(checksums.filename, content, 0644); error != nil {
+		return error
+	}
+
+	checksums.changed = false
+
+	return nil
+}
+
+// Get returns the checksum of a local file and only reads the file if its size or modification time changed
+func (checksums *Checksums) Get(filename string) (string, error) {
+	info, error := os.Stat(filename)
+	if error != nil {
+		return "", error
+	}
+
+	checksums.mutex.Lock()
+	checksum, ok := checksums.Files[filename]
+	checksums.mutex.Unlock()
+
+	if ok && checksum.Size == info.Size() && checksum.Modified == info.ModTime().UnixNano() {
+		return checksum.Value, nil
+	}
+
+	file, error := os.Open(filename)
+	if error != nil {
+		return "", error
+	}
+
+	defer file.Close()
+
+	hash := sha256.New()
+
+	if _, error := io.Copy(hash, file); error != nil {
+		return "", error
+	}
+
+	value := hex.EncodeToString(hash.Sum(nil))
+
+	checksums.mutex.Lock()
+	checksums.Files[filename] = &Checksum{Size: info.Size(), Modified: info.ModTime().UnixNano(), Value: value}
+	checksums.changed = true
+	checksums.mutex.Unlock()
+
+	return value, nil
+}
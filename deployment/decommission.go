@@ -0,0 +1,282 @@
+package deployment
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/darxkies/k8s-tew/config"
+	"github.com/darxkies/k8s-tew/pkg/etcd"
+	"github.com/darxkies/k8s-tew/utils"
+	log "github.com/sirupsen/logrus"
+	"k8s.io/api/core/v1"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Decommission removes every trace of a node from the cluster and from the node itself
+type Decommission struct {
+	config         *config.InternalConfig
+	name           string
+	node           *config.Node
+	nodeDeployment *NodeDeployment
+	commandRetries uint
+	dryRun         bool
+}
+
+func NewDecommission(_config *config.InternalConfig, identityFile string, name string, commandRetries uint, dryRun bool) (*Decommission, error) {
+	node, ok := _config.Config.Nodes[name]
+	if !ok {
+		return nil, fmt.Errorf("node '%s' not found", name)
+	}
+
+	if node.IsController() && len(getEtcdEndpointsWithout(_config, name)) == 0 {
+		return nil, fmt.Errorf("node '%s' is the last controller", name)
+	}
+
+	return &Decommission{config: _config, name: name, node: node, nodeDeployment: NewNodeDeployment(identityFile, name, node, _config, false), commandRetries: commandRetries, dryRun: dryRun}, nil
+}
+
+// getEtcdEndpointsWithout returns the client endpoints of all controllers except the named one
+func getEtcdEndpointsWithout(_config *config.InternalConfig, name string) []string {
+	result := []string{}
+
+	for nodeName, node := range _config.Config.Nodes {
+		if nodeName == name || !node.IsController() {
+			continue
+		}
+
+		result = append(result, fmt.Sprintf("https://%s:%d", node.IP, utils.PortEtcdClient))
+	}
+
+	return result
+}
+
+func (decommission *Decommission) Steps() int {
+	// Drain, remove etcd member, clean up node, delete node
+	return 4
+}
+
+func (decommission *Decommission) Run() error {
+	steps := []func() error{
+		decommission.drainNode,
+		decommission.removeEtcdMember,
+		decommission.cleanupNode,
+		decommission.deleteNode,
+	}
+
+	for _, step := range steps {
+		if error := step(); error != nil {
+			return error
+		}
+
+		utils.IncreaseProgressStep()
+	}
+
+	return nil
+}
+
+// drainNode cordons the node and evicts all pods that are not managed by daemon sets
+func (decommission *Decommission) drainNode() error {
+	clientset, error := getClientset(decommission.config)
+	if error != nil {
+		return error
+	}
+
+	node, error := clientset.CoreV1().Nodes().Get(decommission.name, metav1.GetOptions{})
+	if apierrors.IsNotFound(error) {
+		log.WithFields(log.Fields{"node": decommission.name}).Info("Node not registered")
+
+		return nil
+	}
+
+	if error != nil {
+		return error
+	}
+
+	pods, error := decommission.getEvictablePods(clientset)
+	if error != nil {
+		return error
+	}
+
+	if decommission.dryRun {
+		log.WithFields(log.Fields{"node": decommission.name}).Info("Would cordon node")
+
+		for _, pod := range pods {
+			log.WithFields(log.Fields{"node": decommission.name, "pod": pod.Name, "namespace": pod.Namespace}).Info("Would evict pod")
+		}
+
+		return nil
+	}
+
+	if !node.Spec.Unschedulable {
+		node.Spec.Unschedulable = true
+
+		if _, error := clientset.CoreV1().Nodes().Update(node); error != nil {
+			return error
+		}
+
+		log.WithFields(log.Fields{"node": decommission.name}).Info("Cordoned node")
+	}
+
+	for _, pod := range pods {
+		if error := decommission.evictPod(clientset, pod); error != nil {
+			return error
+		}
+	}
+
+	return decommission.waitForPods(clientset, pods)
+}
+
+func (decommission *Decommission) getEvictablePods(clientset *kubernetes.Clientset) ([]v1.Pod, error) {
+	podList, error := clientset.CoreV1().Pods(metav1.NamespaceAll).List(metav1.ListOptions{FieldSelector: fmt.Sprintf("spec.nodeName=%s", decommission.name)})
+	if error != nil {
+		return nil, error
+	}
+
+	result := []v1.Pod{}
+
+	for _, pod := range podList.Items {
+		// Static pods cannot be evicted
+		if _, ok := pod.Annotations[v1.MirrorPodAnnotationKey]; ok {
+			continue
+		}
+
+		if pod.Status.Phase == v1.PodSucceeded || pod.Status.Phase == v1.PodFailed {
+			continue
+		}
+
+		daemonSet := false
+
+		for _, owner := range pod.OwnerReferences {
+			if owner.Kind == "DaemonSet" {
+				daemonSet = true
+
+				break
+			}
+		}
+
+		if daemonSet {
+			continue
+		}
+
+		result = append(result, pod)
+	}
+
+	return result, nil
+}
+
+func (decommission *Decommission) evictPod(clientset *kubernetes.Clientset, pod v1.Pod) error {
+	var error error
+
+	eviction := &policyv1beta1.Eviction{ObjectMeta: metav1.ObjectMeta{Name: pod.Name, Namespace: pod.Namespace}}
+
+	for retries := uint(0); retries < decommission.commandRetries; retries++ {
+		error = clientset.CoreV1().Pods(pod.Namespace).Evict(eviction)
+
+		if error == nil || apierrors.IsNotFound(error) {
+			log.WithFields(log.Fields{"node": decommission.name, "pod": pod.Name, "namespace": pod.Namespace}).Info("Evicted pod")
+
+			return nil
+		}
+
+		// The eviction is refused as long as it would violate a disruption budget
+		log.WithFields(log.Fields{"node": decommission.name, "pod": pod.Name, "namespace": pod.Namespace, "error": error}).Debug("Eviction failed")
+
+		time.Sleep(time.Second)
+	}
+
+	return fmt.Errorf("Could not evict pod '%s/%s' (%s)", pod.Namespace, pod.Name, error.Error())
+}
+
+func (decommission *Decommission) waitForPods(clientset *kubernetes.Clientset, pods []v1.Pod) error {
+	for retries := uint(0); retries < decommission.commandRetries; retries++ {
+		pending := 0
+
+		for _, pod := range pods {
+			current, error := clientset.CoreV1().Pods(pod.Namespace).Get(pod.Name, metav1.GetOptions{})
+
+			if apierrors.IsNotFound(error) || (error == nil && current.UID != pod.UID) {
+				continue
+			}
+
+			pending++
+		}
+
+		if pending == 0 {
+			log.WithFields(log.Fields{"node": decommission.name}).Info("Drained node")
+
+			return nil
+		}
+
+		time.Sleep(time.Second)
+	}
+
+	return fmt.Errorf("Timed out draining node '%s'", decommission.name)
+}
+
+func (decommission *Decommission) removeEtcdMember() error {
+	if !decommission.node.IsController() {
+		return nil
+	}
+
+	if decommission.dryRun {
+		log.WithFields(log.Fields{"node": decommission.name}).Info("Would remove etcd member")
+
+		return nil
+	}
+
+	if error := etcd.RemoveMember(decommission.config, getEtcdEndpointsWithout(decommission.config, decommission.name), decommission.name); error != nil {
+		return error
+	}
+
+	members, error := config.LoadEtcdMembers(decommission.config.GetFullLocalAssetFilename(utils.EtcdMembers))
+	if error != nil {
+		return error
+	}
+
+	members.Remove(decommission.name)
+
+	return members.Save()
+}
+
+func (decommission *Decommission) cleanupNode() error {
+	if decommission.dryRun {
+		log.WithFields(log.Fields{"node": decommission.name}).Info("Would reset node")
+
+		return nil
+	}
+
+	decommission.config.SetNode(decommission.name, decommission.node)
+
+	report, error := decommission.nodeDeployment.Reset()
+	if error != nil {
+		return error
+	}
+
+	report.Dump()
+
+	return nil
+}
+
+func (decommission *Decommission) deleteNode() error {
+	if decommission.dryRun {
+		log.WithFields(log.Fields{"node": decommission.name}).Info("Would delete node")
+
+		return nil
+	}
+
+	clientset, error := getClientset(decommission.config)
+	if error != nil {
+		return error
+	}
+
+	if error := clientset.CoreV1().Nodes().Delete(decommission.name, &metav1.DeleteOptions{}); error != nil && !apierrors.IsNotFound(error) {
+		return error
+	}
+
+	log.WithFields(log.Fields{"node": decommission.name}).Info("Deleted node")
+
+	return nil
+}
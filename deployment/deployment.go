@@ -4,6 +4,7 @@ import (
 	"time"
 
 	"github.com/darxkies/k8s-tew/config"
+	"github.com/darxkies/k8s-tew/pkg/manifest"
 	"github.com/darxkies/k8s-tew/utils"
 
 	log "github.com/sirupsen/logrus"
@@ -20,9 +21,14 @@ type Deployment struct {
 	images            config.Images
 	parallel          bool
 	importImages      bool
+	skipPreflight     bool
+	preflight         *Preflight
+	report            *Report
+	applier           *manifest.Applier
+	etcdMembers       *config.EtcdMembers
 }
 
-func NewDeployment(_config *config.InternalConfig, identityFile string, importImages, forceUpload bool, parallel bool, commandRetries uint, skipSetup, skipStorageSetup, skipMonitoringSetup, skipLoggingSetup, skipBackupSetup, skipShowcaseSetup, skipIngressSetup, skipPackagingSetup bool) *Deployment {
+func NewDeployment(_config *config.InternalConfig, identityFile string, importImages, forceUpload bool, parallel bool, commandRetries uint, skipPreflight, skipSetup, skipStorageSetup, skipMonitoringSetup, skipLoggingSetup, skipBackupSetup, skipShowcaseSetup, skipIngressSetup, skipPackagingSetup bool) *Deployment {
 	nodes := map[string]*NodeDeployment{}
 
 	for nodeName, node := range _config.Config.Nodes {
@@ -59,7 +65,10 @@ func NewDeployment(_config *config.InternalConfig, identityFile string, importIm
 		skipSetupFeatures = append(skipSetupFeatures, utils.FeaturePackaging)
 	}
 
-	deployment := &Deployment{config: _config, identityFile: identityFile, importImages: importImages, forceUpload: forceUpload, parallel: parallel, commandRetries: commandRetries, nodes: nodes, skipSetup: skipSetup, skipSetupFeatures: skipSetupFeatures}
+	deployment := &Deployment{config: _config, identityFile: identityFile, importImages: importImages, forceUpload: forceUpload, parallel: parallel, commandRetries: commandRetries, nodes: nodes, skipPreflight: skipPreflight, skipSetup: skipSetup, skipSetupFeatures: skipSetupFeatures}
+
+	deployment.preflight = NewPreflight(_config, identityFile, skipSetupFeatures, parallel)
+	deployment.report = NewReport(_config.GetFullLocalAssetFilename(utils.DeploymentReport))
 
 	deployment.images = deployment.config.Config.Versions.GetImages()
 
@@ -69,6 +78,10 @@ func NewDeployment(_config *config.InternalConfig, identityFile string, importIm
 func (deployment *Deployment) Steps() int {
 	result := 0
 
+	if !deployment.skipPreflight {
+		result += deployment.preflight.Steps()
+	}
+
 	// Files deployment
 	for _, node := range deployment.nodes {
 		result += node.Steps()
@@ -92,20 +105,132 @@ func (deployment *Deployment) Steps() int {
 }
 
 // Deploy all files to the nodes over SSH
-func (deployment *Deployment) Deploy() error {
-	sortedNodeKeys := deployment.config.GetSortedNodeKeys()
+func (deployment *Deployment) Deploy() (_error error) {
+	if _error = deployment.prepare(); _error != nil {
+		return
+	}
 
-	for _, nodeName := range sortedNodeKeys {
+	defer deployment.saveReport(&_error)
+
+	if _error = deployment.uploadFiles(deployment.config.GetSortedNodeKeys()); _error != nil {
+		return
+	}
+
+	return deployment.setup()
+}
+
+// Validate the hooks, check the etcd membership and run the preflight checks
+func (deployment *Deployment) prepare() error {
+	for _, hook := range deployment.config.Config.Hooks {
+		if error := hook.Validate(); error != nil {
+			return error
+		}
+	}
+
+	if error := deployment.loadEtcdMembers(); error != nil {
+		return error
+	}
+
+	if deployment.skipPreflight {
+		return nil
+	}
+
+	return deployment.preflight.Run()
+}
+
+// Keep the output of the hooks and the status of the objects even if the deployment fails
+func (deployment *Deployment) saveReport(_error *error) {
+	if deployment.report.Empty() {
+		return
+	}
+
+	if error := deployment.report.Save(); error != nil && *_error == nil {
+		*_error = error
+	}
+}
+
+// Upload the files to the nodes and record the replaced files in the deployment history
+func (deployment *Deployment) uploadFiles(nodeNames []string) (_error error) {
+	revisionID := ""
+	keepRevisions := []string{}
+
+	history, _error := LoadHistory(deployment.config.GetFullLocalAssetFilename(utils.DeploymentHistory))
+	if _error != nil {
+		return
+	}
+
+	revision := NewRevision(NewRevisionID())
+
+	if deployment.config.Config.Revisions > 0 {
+		revisionID = revision.ID
+
+		// Keep the newest revisions including the current one
+		keepRevisions = history.IDs()
+
+		if uint(len(keepRevisions)) >= deployment.config.Config.Revisions {
+			keepRevisions = keepRevisions[uint(len(keepRevisions))-deployment.config.Config.Revisions+1:]
+		}
+
+		// Save whatever was replaced even if the deployment fails midway
+		defer func() {
+			if len(revision.Nodes) == 0 {
+				return
+			}
+
+			history.Add(revision, deployment.config.Config.Revisions)
+
+			if error := history.Save(); error != nil && _error == nil {
+				_error = error
+			}
+
+			log.WithFields(log.Fields{"deployment-id": revision.ID}).Info("Recorded deployment")
+		}()
+	}
+
+	checksums, _error := LoadChecksums(deployment.config.GetFullLocalAssetFilename(utils.DeploymentChecksums))
+	if _error != nil {
+		return
+	}
+
+	defer func() {
+		if error := checksums.Save(); error != nil && _error == nil {
+			_error = error
+		}
+	}()
+
+	for _, nodeName := range nodeNames {
 		nodeDeployment := deployment.nodes[nodeName]
 
+		if error := deployment.runHooks(utils.HookPreUpload, nodeDeployment); error != nil {
+			return error
+		}
+
+		if error := deployment.addEtcdMember(nodeName); error != nil {
+			return error
+		}
+
 		deployment.config.SetNode(nodeName, nodeDeployment.node)
 
-		if error := nodeDeployment.UploadFiles(deployment.forceUpload); error != nil {
+		changedFiles, error := nodeDeployment.UploadFiles(checksums, deployment.forceUpload, revisionID, keepRevisions)
+
+		if len(changedFiles) > 0 {
+			revision.Nodes[nodeName] = changedFiles
+		}
+
+		if error != nil {
+			return error
+		}
+
+		if error := deployment.waitForEtcdMember(nodeName); error != nil {
+			return error
+		}
+
+		if error := deployment.runHooks(utils.HookPostUpload, nodeDeployment); error != nil {
 			return error
 		}
 	}
 
-	return deployment.setup()
+	return nil
 }
 
 func (deployment *Deployment) runCommand(name, command string) error {
@@ -219,6 +344,16 @@ func (deployment *Deployment) runBoostrapperCommands() error {
 			continue
 		}
 
+		if len(command.Manifest) > 0 {
+			if error := deployment.applyManifest(command); error != nil {
+				return error
+			}
+
+			utils.IncreaseProgressStep()
+
+			continue
+		}
+
 		newCommand, error := deployment.config.ApplyTemplate(command.Name, command.Command)
 		if error != nil {
 			return error
@@ -234,12 +369,98 @@ func (deployment *Deployment) runBoostrapperCommands() error {
 	return nil
 }
 
+func (deployment *Deployment) getApplier() (*manifest.Applier, error) {
+	if deployment.applier != nil {
+		return deployment.applier, nil
+	}
+
+	applier, error := manifest.NewApplier(deployment.config)
+	if error != nil {
+		return nil, error
+	}
+
+	deployment.applier = applier
+
+	return applier, nil
+}
+
+// Apply a rendered manifest and wait for its objects to become ready
+func (deployment *Deployment) applyManifest(command *config.Command) error {
+	applier, error := deployment.getApplier()
+	if error != nil {
+		return error
+	}
+
+	statuses, error := applier.Apply(command.Name, command.GetFeature(), deployment.config.GetFullLocalAssetFilename(command.Manifest), command.GetTimeout())
+
+	deployment.report.AddObjects(statuses)
+
+	if error != nil {
+		statuses.Dump()
+
+		log.WithFields(log.Fields{"name": command.Name, "error": error}).Error("Manifest failed")
+	}
+
+	return error
+}
+
+// Uninstall the addons that are no longer part of the configuration and the addons of the skipped features. The persistent volume claims are kept.
+// Addons whose command does not apply a manifest anymore are left alone.
+func (deployment *Deployment) pruneAddons() error {
+	applier, error := deployment.getApplier()
+	if error != nil {
+		return error
+	}
+
+	applySets, error := applier.ListAddons()
+	if error != nil {
+		return error
+	}
+
+	for _, applySet := range applySets {
+		var addon *config.Command
+
+		for _, command := range deployment.config.Config.Commands {
+			if command.Name == applySet.Name {
+				addon = command
+
+				break
+			}
+		}
+
+		if addon == nil {
+			log.WithFields(log.Fields{"addon": applySet.Name}).Info("Uninstalling removed addon")
+
+		} else if len(addon.Manifest) == 0 {
+			log.WithFields(log.Fields{"addon": applySet.Name}).Debug("Addon without manifest left alone")
+
+			continue
+
+		} else if addon.Features.HasFeatures(deployment.skipSetupFeatures) {
+			log.WithFields(log.Fields{"addon": applySet.Name, "feature": applySet.Feature}).Info("Uninstalling addon of skipped feature")
+
+		} else {
+			continue
+		}
+
+		if error := applier.Uninstall(applySet.Name, true); error != nil {
+			return error
+		}
+	}
+
+	return nil
+}
+
 // Setup nodes
 func (deployment *Deployment) setup() error {
 	if deployment.skipSetup {
 		return nil
 	}
 
+	if error := deployment.runPhaseHooks(utils.HookPreSetup); error != nil {
+		return error
+	}
+
 	if error := deployment.runImportImages(); error != nil {
 		return error
 	}
@@ -248,5 +469,13 @@ func (deployment *Deployment) setup() error {
 		return error
 	}
 
-	return deployment.runBoostrapperCommands()
+	if error := deployment.runBoostrapperCommands(); error != nil {
+		return error
+	}
+
+	if error := deployment.pruneAddons(); error != nil {
+		return error
+	}
+
+	return deployment.runPhaseHooks(utils.HookPostSetup)
 }
@@ -0,0 +1,46 @@
+package deployment
+
+import (
+	"fmt"
+
+	"github.com/darxkies/k8s-tew/config"
+	log "github.com/sirupsen/logrus"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// RewriteSecrets updates all secrets unchanged, so that the API servers store them encrypted with the primary key.
+// Secrets deleted or changed in the meantime were already written with the primary key and are skipped.
+func RewriteSecrets(_config *config.InternalConfig) (int, error) {
+	clientset, error := getClientset(_config)
+	if error != nil {
+		return 0, error
+	}
+
+	secrets, error := clientset.CoreV1().Secrets(metav1.NamespaceAll).List(metav1.ListOptions{})
+	if error != nil {
+		return 0, error
+	}
+
+	count := 0
+
+	for i := range secrets.Items {
+		secret := &secrets.Items[i]
+
+		if _, error := clientset.CoreV1().Secrets(secret.Namespace).Update(secret); error != nil {
+			if apierrors.IsNotFound(error) || apierrors.IsConflict(error) {
+				continue
+			}
+
+			return count, fmt.Errorf("Could not rewrite secret '%s/%s' (%s)", secret.Namespace, secret.Name, error.Error())
+		}
+
+		count++
+
+		log.WithFields(log.Fields{"namespace": secret.Namespace, "name": secret.Name}).Debug("Rewrote secret")
+	}
+
+	log.WithFields(log.Fields{"count": count}).Info("Rewrote secrets")
+
+	return count, nil
+}
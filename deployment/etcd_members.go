@@ -0,0 +1,128 @@
+package deployment
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/darxkies/k8s-tew/config"
+	"github.com/darxkies/k8s-tew/pkg/etcd"
+	"github.com/darxkies/k8s-tew/utils"
+
+	log "github.com/sirupsen/logrus"
+)
+
+func getEtcdClientEndpoint(node *config.Node) string {
+	return fmt.Sprintf("https://%s:%d", node.IP, utils.PortEtcdClient)
+}
+
+func getEtcdPeerURL(node *config.Node) string {
+	return fmt.Sprintf("https://%s:%d", node.IP, utils.PortEtcdPeer)
+}
+
+// getEtcdMemberEndpoints returns the client endpoints of the recorded members that are still controllers
+func getEtcdMemberEndpoints(_config *config.InternalConfig, members *config.EtcdMembers) []string {
+	result := []string{}
+
+	for _, name := range members.Names {
+		node, ok := _config.Config.Nodes[name]
+		if !ok || !node.IsController() {
+			continue
+		}
+
+		result = append(result, getEtcdClientEndpoint(node))
+	}
+
+	return result
+}
+
+// loadEtcdMembers compares the recorded members with the running cluster. A recorded member that is not part of the
+// cluster means that the assets of the joiners were generated with the wrong initial cluster.
+func (deployment *Deployment) loadEtcdMembers() error {
+	members, error := config.LoadEtcdMembers(deployment.config.GetFullLocalAssetFilename(utils.EtcdMembers))
+	if error != nil {
+		return error
+	}
+
+	deployment.etcdMembers = members
+
+	joiners := deployment.config.GetEtcdJoiners(members)
+
+	names, _, error := etcd.ListMembers(deployment.config, getEtcdMemberEndpoints(deployment.config, members))
+	if error != nil {
+		if len(joiners) > 0 {
+			return fmt.Errorf("Etcd is not reachable, controllers %v cannot join (%s)", joiners, error.Error())
+		}
+
+		// The cluster is deployed for the first time
+		log.WithFields(log.Fields{"error": error}).Debug("Etcd membership not checked")
+
+		return nil
+	}
+
+	for _, name := range names {
+		if node, ok := deployment.config.Config.Nodes[name]; !ok || !node.IsController() {
+			log.WithFields(log.Fields{"name": name}).Warn("Etcd member is not a controller anymore, use 'node-remove --decommission' to remove it")
+		}
+	}
+
+	for _, name := range members.Names {
+		if node, ok := deployment.config.Config.Nodes[name]; !ok || !node.IsController() {
+			continue
+		}
+
+		if contains(names, name) {
+			continue
+		}
+
+		if len(joiners) > 0 {
+			return fmt.Errorf("Node '%s' is recorded in '%s' but is not an etcd member, remove it from the file and run generate again", name, deployment.config.GetFullLocalAssetFilename(utils.EtcdMembers))
+		}
+
+		log.WithFields(log.Fields{"name": name}).Warn("Controller is not an etcd member")
+	}
+
+	return nil
+}
+
+func (deployment *Deployment) isEtcdJoiner(nodeName string) bool {
+	return deployment.etcdMembers != nil && contains(deployment.config.GetEtcdJoiners(deployment.etcdMembers), nodeName)
+}
+
+// addEtcdMember announces the controller to the cluster before its files, and with them the etcd manifest, are uploaded
+func (deployment *Deployment) addEtcdMember(nodeName string) error {
+	if !deployment.isEtcdJoiner(nodeName) {
+		return nil
+	}
+
+	return etcd.AddMember(deployment.config, getEtcdMemberEndpoints(deployment.config, deployment.etcdMembers), nodeName, getEtcdPeerURL(deployment.config.Config.Nodes[nodeName]))
+}
+
+// waitForEtcdMember waits for the etcd of the joined controller and records it as a member. The next joiner can only be
+// added once this one is healthy, otherwise the cluster could lose its quorum.
+func (deployment *Deployment) waitForEtcdMember(nodeName string) error {
+	var error error
+
+	if !deployment.isEtcdJoiner(nodeName) {
+		return nil
+	}
+
+	log.WithFields(log.Fields{"node": nodeName}).Info("Waiting for etcd member")
+
+	endpoints := []string{getEtcdClientEndpoint(deployment.config.Config.Nodes[nodeName])}
+
+	for retries := uint(0); retries < deployment.commandRetries; retries++ {
+		if error = etcd.CheckHealth(deployment.config, endpoints); error == nil {
+			break
+		}
+
+		time.Sleep(time.Second)
+	}
+
+	if error != nil {
+		return fmt.Errorf("Etcd member '%s' did not become healthy (%s)", nodeName, error.Error())
+	}
+
+	deployment.etcdMembers.Add(nodeName)
+
+	return deployment.etcdMembers.Save()
+}
@@ -0,0 +1,215 @@
+package deployment
+
+import (
+	"fmt"
+	"path"
+	"time"
+
+	"github.com/darxkies/k8s-tew/config"
+	"github.com/darxkies/k8s-tew/pkg/etcd"
+	"github.com/darxkies/k8s-tew/utils"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const restoreSubdirectory = "restore"
+const restoreSnapshot = "snapshot.db"
+
+// EtcdRestore replaces the data directories of all etcd members with the content of a snapshot. The whole cluster is
+// stopped first, because members that still run with the old data would otherwise replicate it back.
+type EtcdRestore struct {
+	config         *config.InternalConfig
+	snapshot       string
+	commandRetries uint
+	controllers    []string
+	nodes          map[string]*NodeDeployment
+}
+
+func NewEtcdRestore(_config *config.InternalConfig, identityFile string, snapshot string, commandRetries uint) (*EtcdRestore, error) {
+	controllers := []string{}
+	nodes := map[string]*NodeDeployment{}
+
+	for _, nodeName := range _config.GetSortedNodeKeys() {
+		node := _config.Config.Nodes[nodeName]
+
+		if !node.IsController() {
+			continue
+		}
+
+		controllers = append(controllers, nodeName)
+		nodes[nodeName] = NewNodeDeployment(identityFile, nodeName, node, _config, false)
+	}
+
+	if len(controllers) == 0 {
+		return nil, fmt.Errorf("no controllers found")
+	}
+
+	return &EtcdRestore{config: _config, snapshot: snapshot, commandRetries: commandRetries, controllers: controllers, nodes: nodes}, nil
+}
+
+func (restore *EtcdRestore) Steps() int {
+	// Fetch snapshot, stop members, restore data, start etcd, start api servers
+	return 5
+}
+
+func (restore *EtcdRestore) Run() error {
+	steps := []func(string) error{
+		restore.stopMember,
+		restore.restoreMember,
+		restore.startEtcd,
+		restore.startApiServer,
+	}
+
+	filename, error := etcd.FetchSnapshot(restore.config, restore.snapshot)
+	if error != nil {
+		return error
+	}
+
+	utils.IncreaseProgressStep()
+
+	for index, step := range steps {
+		for _, nodeName := range restore.controllers {
+			restore.config.SetNode(nodeName, restore.config.Config.Nodes[nodeName])
+
+			if error := step(nodeName); error != nil {
+				return error
+			}
+
+			// Upload the snapshot right after the member was stopped
+			if index == 0 {
+				if error := restore.uploadSnapshot(nodeName, filename); error != nil {
+					return error
+				}
+			}
+		}
+
+		// All members have to be up before the api servers are started again
+		if index == 2 {
+			if error := restore.waitForEtcd(); error != nil {
+				return error
+			}
+		}
+
+		utils.IncreaseProgressStep()
+	}
+
+	// The restored cluster was bootstrapped by all controllers
+	members, error := config.LoadEtcdMembers(restore.config.GetFullLocalAssetFilename(utils.EtcdMembers))
+	if error != nil {
+		return error
+	}
+
+	for _, nodeName := range restore.controllers {
+		members.Add(nodeName)
+	}
+
+	if error := members.Save(); error != nil {
+		return error
+	}
+
+	log.WithFields(log.Fields{"snapshot": restore.snapshot}).Info("Restored etcd snapshot")
+
+	return nil
+}
+
+func (restore *EtcdRestore) getRestoreDirectory() string {
+	return path.Join(restore.config.GetFullTargetAssetDirectory(utils.DirectoryEtcdSnapshots), restoreSubdirectory)
+}
+
+func (restore *EtcdRestore) moveManifest(nodeName, name, from, to string) error {
+	command := fmt.Sprintf("mkdir -p %[2]s && if [ -f %[1]s ]; then mv -f %[1]s %[2]s/; fi", path.Join(from, name), to)
+
+	if output, error := restore.nodes[nodeName].ExecuteWithCombinedOutput("move-manifest", command); error != nil {
+		return fmt.Errorf("Could not move manifest '%s' on node '%s' (%s: %s)", name, nodeName, error.Error(), output)
+	}
+
+	return nil
+}
+
+// stopMember removes the static pods of etcd and of the api server from the kubelet and waits for etcd to exit
+func (restore *EtcdRestore) stopMember(nodeName string) error {
+	manifestsDirectory := restore.config.GetFullTargetAssetDirectory(utils.DirectoryK8sManifests)
+
+	for _, manifest := range []string{utils.ManifestKubeApiserver, utils.ManifestEtcd} {
+		if error := restore.moveManifest(nodeName, path.Base(restore.config.GetFullTargetAssetFilename(manifest)), manifestsDirectory, restore.getRestoreDirectory()); error != nil {
+			return error
+		}
+	}
+
+	log.WithFields(log.Fields{"node": nodeName}).Info("Waiting for etcd to stop")
+
+	for retries := uint(0); retries < restore.commandRetries; retries++ {
+		// pgrep fails if no process matches
+		if _, error := restore.nodes[nodeName].Execute("check-etcd", "pgrep -x etcd"); error != nil {
+			return nil
+		}
+
+		time.Sleep(time.Second)
+	}
+
+	return fmt.Errorf("Etcd did not stop on node '%s'", nodeName)
+}
+
+func (restore *EtcdRestore) uploadSnapshot(nodeName, filename string) error {
+	files := map[string]string{filename: path.Join(restore.getRestoreDirectory(), restoreSnapshot)}
+
+	return restore.nodes[nodeName].uploadBundle(files, nil)
+}
+
+// restoreMember rebuilds the data directory of the member from the snapshot and keeps the previous one next to it
+func (restore *EtcdRestore) restoreMember(nodeName string) error {
+	node := restore.config.Config.Nodes[nodeName]
+	dataDirectory := restore.config.GetFullTargetAssetDirectory(utils.DirectoryEtcdData)
+	restoredDirectory := dataDirectory + ".restore"
+	backupDirectory := fmt.Sprintf("%s.%s", dataDirectory, time.Now().Format("20060102150405"))
+
+	command := fmt.Sprintf("rm -Rf %[4]s && ETCDCTL_API=3 %[1]s snapshot restore %[2]s --name %[6]s --initial-cluster %[7]s --initial-cluster-token etcd-cluster --initial-advertise-peer-urls https://%[8]s:%[9]d --data-dir %[4]s && if [ -d %[3]s ]; then mv %[3]s %[5]s; fi && mv %[4]s %[3]s",
+		restore.config.GetFullTargetAssetFilename(utils.BinaryEtcdctl),
+		path.Join(restore.getRestoreDirectory(), restoreSnapshot),
+		dataDirectory,
+		restoredDirectory,
+		backupDirectory,
+		nodeName,
+		restore.config.GetEtcdCluster(),
+		node.IP,
+		utils.PortEtcdPeer,
+	)
+
+	if output, error := restore.nodes[nodeName].ExecuteWithCombinedOutput("restore-snapshot", command); error != nil {
+		return fmt.Errorf("Could not restore snapshot on node '%s' (%s: %s)", nodeName, error.Error(), output)
+	}
+
+	log.WithFields(log.Fields{"node": nodeName, "backup": backupDirectory}).Info("Restored etcd data directory")
+
+	return nil
+}
+
+func (restore *EtcdRestore) startEtcd(nodeName string) error {
+	return restore.moveManifest(nodeName, path.Base(restore.config.GetFullTargetAssetFilename(utils.ManifestEtcd)), restore.getRestoreDirectory(), restore.config.GetFullTargetAssetDirectory(utils.DirectoryK8sManifests))
+}
+
+func (restore *EtcdRestore) startApiServer(nodeName string) error {
+	if error := restore.moveManifest(nodeName, path.Base(restore.config.GetFullTargetAssetFilename(utils.ManifestKubeApiserver)), restore.getRestoreDirectory(), restore.config.GetFullTargetAssetDirectory(utils.DirectoryK8sManifests)); error != nil {
+		return error
+	}
+
+	_, error := restore.nodes[nodeName].Execute("cleanup-restore", fmt.Sprintf("rm -Rf %s", restore.getRestoreDirectory()))
+
+	return error
+}
+
+func (restore *EtcdRestore) waitForEtcd() error {
+	var error error
+
+	log.Info("Waiting for etcd")
+
+	for retries := uint(0); retries < restore.commandRetries; retries++ {
+		if error = etcd.CheckHealth(restore.config, restore.config.GetETCDClientEndpoints()); error == nil {
+			return nil
+		}
+
+		time.Sleep(time.Second)
+	}
+
+	return error
+}
@@ -0,0 +1,137 @@
+package deployment
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"time"
+
+	"github.com/darxkies/k8s-tew/utils"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Revision records the files which were changed on each node by one deployment
+type Revision struct {
+	ID    string              `yaml:"id"`
+	Date  string              `yaml:"date"`
+	Nodes map[string][]string `yaml:"nodes,omitempty"`
+}
+
+type Revisions []*Revision
+
+// History keeps track of the deployments which can be rolled back
+type History struct {
+	filename  string
+	Revisions Revisions `yaml:"revisions"`
+}
+
+// NewRevisionID returns an id which sorts by the time of the deployment. The nanoseconds keep deployments started within
+// the same second apart.
+func NewRevisionID() string {
+	return time.Now().UTC().Format("20060102150405.000000000")
+}
+
+func NewRevision(id string) *Revision {
+	return &Revision{ID: id, Date: time.Now().Format(time.RFC3339), Nodes: map[string][]string{}}
+}
+
+func LoadHistory(filename string) (*History, error) {
+	history := &History{filename: filename, Revisions: Revisions{}}
+
+	if !utils.FileExists(filename) {
+		return history, nil
+	}
+
+	content, error := ioutil.ReadFile(filename)
+	if error != nil {
+		return nil, error
+	}
+
+	if error := yaml.Unmarshal(content, history); error != nil {
+		return nil, fmt.Errorf("Could not parse deployment history '%s' (%s)", filename, error.Error())
+	}
+
+	sort.Slice(history.Revisions, func(i, j int) bool {
+		return history.Revisions[i].ID < history.Revisions[j].ID
+	})
+
+	return history, nil
+}
+
+func (history *History) Save() error {
+	content, error := yaml.Marshal(history)
+	if error != nil {
+		return error
+	}
+
+	if error := ioutil.WriteFile(history.filename, content, 0644); error != nil {
+		return error
+	}
+
+	utils.LogFilename("Saved", history.filename)
+
+	return nil
+}
+
+// Add appends a revision and drops the oldest ones so that at most count revisions are kept
+func (history *History) Add(revision *Revision, count uint) {
+	history.Revisions = append(history.Revisions, revision)
+
+	if uint(len(history.Revisions)) > count {
+		history.Revisions = history.Revisions[uint(len(history.Revisions))-count:]
+	}
+}
+
+// IDs returns the ids of all known revisions
+func (history *History) IDs() []string {
+	result := []string{}
+
+	for _, revision := range history.Revisions {
+		result = append(result, revision.ID)
+	}
+
+	return result
+}
+
+// Latest returns the most recent revision
+func (history *History) Latest() *Revision {
+	if len(history.Revisions) == 0 {
+		return nil
+	}
+
+	return history.Revisions[len(history.Revisions)-1]
+}
+
+// After returns the revisions, newest first, which were deployed after the revision with the given id
+func (history *History) After(id string) (Revisions, error) {
+	for index, revision := range history.Revisions {
+		if revision.ID != id {
+			continue
+		}
+
+		result := Revisions{}
+
+		for i := len(history.Revisions) - 1; i > index; i-- {
+			result = append(result, history.Revisions[i])
+		}
+
+		return result, nil
+	}
+
+	return nil, fmt.Errorf("deployment '%s' not found", id)
+}
+
+// Remove deletes the revision with the given id from the history
+func (history *History) Remove(id string) {
+	revisions := Revisions{}
+
+	for _, revision := range history.Revisions {
+		if revision.ID == id {
+			continue
+		}
+
+		revisions = append(revisions, revision)
+	}
+
+	history.Revisions = revisions
+}
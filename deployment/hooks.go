@@ -0,0 +1,136 @@
+package deployment
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"github.com/darxkies/k8s-tew/config"
+	"github.com/darxkies/k8s-tew/pkg/manifest"
+	"github.com/darxkies/k8s-tew/utils"
+	log "github.com/sirupsen/logrus"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// HookResult records the execution of a hook on a node
+type HookResult struct {
+	Name     string `yaml:"name"`
+	Phase    string `yaml:"phase"`
+	Node     string `yaml:"node"`
+	Local    bool   `yaml:"local,omitempty"`
+	Duration string `yaml:"duration"`
+	Output   string `yaml:"output"`
+	Error    string `yaml:"error,omitempty"`
+}
+
+// Report collects the output of the hooks and the status of the applied objects of a deployment
+type Report struct {
+	filename string
+	mutex    sync.Mutex
+	Date     string                  `yaml:"date"`
+	Hooks    []*HookResult           `yaml:"hooks"`
+	Objects  manifest.ObjectStatuses `yaml:"objects"`
+}
+
+func NewReport(filename string) *Report {
+	return &Report{filename: filename, Date: time.Now().Format(time.RFC3339), Hooks: []*HookResult{}, Objects: manifest.ObjectStatuses{}}
+}
+
+func (report *Report) Add(result *HookResult) {
+	report.mutex.Lock()
+	defer report.mutex.Unlock()
+
+	report.Hooks = append(report.Hooks, result)
+}
+
+func (report *Report) AddObjects(statuses manifest.ObjectStatuses) {
+	report.mutex.Lock()
+	defer report.mutex.Unlock()
+
+	report.Objects = append(report.Objects, statuses...)
+}
+
+func (report *Report) Empty() bool {
+	return len(report.Hooks) == 0 && len(report.Objects) == 0
+}
+
+func (report *Report) Save() error {
+	report.mutex.Lock()
+	defer report.mutex.Unlock()
+
+	content, error := yaml.Marshal(report)
+	if error != nil {
+		return error
+	}
+
+	if error := ioutil.WriteFile(report.filename, content, 0644); error != nil {
+		return error
+	}
+
+	utils.LogFilename("Saved", report.filename)
+
+	return nil
+}
+
+// runHooks executes the hooks of a phase that match the node and stops at the first failing one
+func (deployment *Deployment) runHooks(phase string, nodeDeployment *NodeDeployment) error {
+	for _, hook := range deployment.config.Config.Hooks {
+		if !hook.Matches(phase, nodeDeployment.node) {
+			continue
+		}
+
+		if error := deployment.runHook(hook, nodeDeployment); error != nil {
+			return error
+		}
+	}
+
+	return nil
+}
+
+// runPhaseHooks executes the hooks of a phase on all nodes
+func (deployment *Deployment) runPhaseHooks(phase string) error {
+	for _, nodeName := range deployment.config.GetSortedNodeKeys() {
+		if error := deployment.runHooks(phase, deployment.nodes[nodeName]); error != nil {
+			return error
+		}
+	}
+
+	return nil
+}
+
+func (deployment *Deployment) runHook(hook *config.Hook, nodeDeployment *NodeDeployment) error {
+	deployment.config.SetNode(nodeDeployment.name, nodeDeployment.node)
+
+	command, error := deployment.config.ApplyTemplate(hook.Name, hook.Command)
+	if error != nil {
+		return error
+	}
+
+	log.WithFields(log.Fields{"name": hook.Name, "phase": hook.Phase, "node": nodeDeployment.name, "local": hook.Local, "_command": command}).Info("Executing hook")
+
+	start := time.Now()
+
+	var output string
+
+	if hook.Local {
+		output, error = utils.RunCommandWithOutput(command)
+
+	} else {
+		output, error = nodeDeployment.ExecuteWithCombinedOutput(hook.Name, command)
+	}
+
+	result := &HookResult{Name: hook.Name, Phase: hook.Phase, Node: nodeDeployment.name, Local: hook.Local, Duration: time.Since(start).String(), Output: output}
+
+	if error != nil {
+		result.Error = error.Error()
+	}
+
+	deployment.report.Add(result)
+
+	if error != nil {
+		return fmt.Errorf("Hook '%s' failed on node '%s' (%s)", hook.Name, nodeDeployment.name, error.Error())
+	}
+
+	return nil
+}
@@ -0,0 +1,22 @@
+package deployment
+
+import (
+	"github.com/darxkies/k8s-tew/config"
+	"github.com/darxkies/k8s-tew/utils"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// getClientset connects to the cluster using the admin kubeconfig
+func getClientset(_config *config.InternalConfig) (*kubernetes.Clientset, error) {
+	kubeconfig := _config.GetFullLocalAssetFilename(utils.KubeconfigAdmin)
+
+	// Configure connection
+	config, error := clientcmd.BuildConfigFromFlags("", kubeconfig)
+	if error != nil {
+		return nil, error
+	}
+
+	// Create client
+	return kubernetes.NewForConfig(config)
+}
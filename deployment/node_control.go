@@ -0,0 +1,71 @@
+package deployment
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/darxkies/k8s-tew/config"
+	"github.com/darxkies/k8s-tew/utils"
+)
+
+// NodeControl runs 'k8s-tew node' on a node through SSH, which talks to the control API of 'k8s-tew run' there
+type NodeControl struct {
+	name       string
+	config     *config.InternalConfig
+	deployment *NodeDeployment
+}
+
+func NewNodeControl(identityFile, name string, node *config.Node, _config *config.InternalConfig) *NodeControl {
+	return newNodeControl(name, _config, NewNodeDeployment(identityFile, name, node, _config, false))
+}
+
+// newNodeControl runs the commands through the given node deployment, sharing its connection
+func newNodeControl(name string, _config *config.InternalConfig, deployment *NodeDeployment) *NodeControl {
+	return &NodeControl{name: name, config: _config, deployment: deployment}
+}
+
+func (control *NodeControl) getCommand(arguments ...string) string {
+	binary := control.config.GetFullTargetAssetFilename(utils.BinaryK8sTew)
+
+	return fmt.Sprintf("%s node %s --base-directory=%s --hide-progress", binary, strings.Join(arguments, " "), control.config.Config.DeploymentDirectory)
+}
+
+// Status returns the status of the servers and the commands of the node
+func (control *NodeControl) Status() (*config.ServersStatus, error) {
+	output, error := control.deployment.Execute("node-status", control.getCommand("status", "--json"))
+
+	// The command fails for degraded nodes but it still prints the status
+	status := &config.ServersStatus{}
+
+	if _error := json.Unmarshal([]byte(output), status); _error != nil {
+		if error != nil {
+			return nil, fmt.Errorf("Could not get the status of node '%s' (%s)", control.name, error.Error())
+		}
+
+		return nil, fmt.Errorf("Could not parse the status of node '%s' (%s)", control.name, _error.Error())
+	}
+
+	return status, nil
+}
+
+func (control *NodeControl) RestartServer(name string) error {
+	return control.execute("node-restart-server", "restart-server", name)
+}
+
+func (control *NodeControl) RerunCommand(name string) error {
+	return control.execute("node-rerun-command", "rerun-command", name)
+}
+
+func (control *NodeControl) Reload() error {
+	return control.execute("node-reload", "reload")
+}
+
+func (control *NodeControl) execute(name string, arguments ...string) error {
+	output, error := control.deployment.ExecuteWithCombinedOutput(name, control.getCommand(arguments...))
+	if error != nil {
+		return fmt.Errorf("Failed on node '%s' (%s: %s)", control.name, error.Error(), strings.TrimSpace(output))
+	}
+
+	return nil
+}
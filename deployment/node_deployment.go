@@ -1,25 +1,27 @@
 package deployment
 
 import (
+	"archive/tar"
 	"bytes"
-	"crypto/md5"
-	"encoding/hex"
+	"compress/gzip"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
 	"path"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/darxkies/k8s-tew/config"
+	"github.com/darxkies/k8s-tew/pkg/reset"
 	"github.com/darxkies/k8s-tew/utils"
+	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
-	"github.com/tmc/scp"
 	"golang.org/x/crypto/ssh"
 	"k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/tools/clientcmd"
 )
 
 type NodeDeployment struct {
@@ -29,6 +31,8 @@ type NodeDeployment struct {
 	config       *config.InternalConfig
 	sshLimiter   *utils.Limiter
 	parallel     bool
+	client       *ssh.Client
+	clientMutex  sync.Mutex
 }
 
 func NewNodeDeployment(identityFile string, name string, node *config.Node, config *config.InternalConfig, parallel bool) *NodeDeployment {
@@ -56,26 +60,6 @@ func (deployment *NodeDeployment) Steps() (result int) {
 	return
 }
 
-func (deployment *NodeDeployment) md5sum(filename string) (result string, error error) {
-	file, error := os.Open(filename)
-
-	if error != nil {
-		return
-	}
-
-	defer file.Close()
-
-	hash := md5.New()
-
-	if _, error = io.Copy(hash, file); error != nil {
-		return
-	}
-
-	result = hex.EncodeToString(hash.Sum(nil)[:16])
-
-	return
-}
-
 func (deployment *NodeDeployment) createDirectories() error {
 	defer utils.IncreaseProgressStep()
 
@@ -125,51 +109,88 @@ func (deployment *NodeDeployment) getFiles() map[string]string {
 		fromFile := deployment.config.GetFullLocalAssetFilename(name)
 		toFile := deployment.config.GetFullTargetAssetFilename(name)
 
+		if !utils.FileExists(fromFile) {
+			continue
+		}
+
 		files[fromFile] = toFile
 	}
 
 	return files
 }
 
-func (deployment *NodeDeployment) getRemoteFileChecksums() map[string]string {
-	// Calculate checksums of remote files
-	checksumCommand := "md5sum"
+// getLocalFileChecksums returns the checksums of the files to be deployed indexed by their remote filenames
+func (deployment *NodeDeployment) getLocalFileChecksums(checksums *Checksums) (map[string]string, error) {
+	result := map[string]string{}
+	mutex := sync.Mutex{}
+	tasks := utils.Tasks{}
+
+	for fromFile, toFile := range deployment.getFiles() {
+		fromFile := fromFile
+		toFile := toFile
+
+		tasks = append(tasks, func() error {
+			checksum, error := checksums.Get(fromFile)
+			if error != nil {
+				return error
+			}
 
-	for _, toFile := range deployment.getFiles() {
-		checksumCommand += " " + toFile
+			mutex.Lock()
+			result[toFile] = checksum
+			mutex.Unlock()
+
+			return nil
+		})
 	}
 
-	output, _ := deployment.Execute("get-checksums", checksumCommand)
+	if errors := utils.RunParallelTasks(tasks, deployment.parallel); len(errors) > 0 {
+		return nil, errors[0]
+	}
+
+	return result, nil
+}
+
+// getRemoteFileChecksums reads the manifest written by the previous deployment. Nodes without a manifest have their files hashed instead.
+func (deployment *NodeDeployment) getRemoteFileChecksums() (checksums map[string]string, manifestFound bool) {
+	manifest := deployment.config.GetFullTargetAssetFilename(utils.DeploymentManifest)
+
+	output, error := deployment.Execute("get-manifest", fmt.Sprintf("cat %s", manifest))
+
+	manifestFound = error == nil
+
+	if !manifestFound {
+		checksumCommand := "sha256sum"
+
+		for _, toFile := range deployment.getFiles() {
+			checksumCommand += " " + toFile
+		}
+
+		output, _ = deployment.Execute("get-checksums", checksumCommand)
+	}
 
 	// Parse remote checksum values
-	checksums := map[string]string{}
+	checksums = map[string]string{}
 	lines := strings.Split(output, "\n")
 
 	for _, line := range lines {
-		if len(line) == 0 {
+		tokens := strings.Fields(line)
+
+		if len(tokens) < 2 {
 			continue
 		}
 
-		tokens := strings.Split(line, " ")
-
 		checksums[tokens[len(tokens)-1]] = tokens[0]
 	}
 
-	return checksums
+	return
 }
 
-func (deployment *NodeDeployment) getChangedFiles() map[string]string {
-	remoteFileChecksums := deployment.getRemoteFileChecksums()
-
+func (deployment *NodeDeployment) getChangedFiles(localFileChecksums map[string]string, remoteFileChecksums map[string]string) map[string]string {
 	files := map[string]string{}
 
 	for fromFile, toFile := range deployment.getFiles() {
-		if remoteChecksum, ok := remoteFileChecksums[toFile]; ok {
-			localChecksum, error := deployment.md5sum(fromFile)
-
-			if error == nil && localChecksum == remoteChecksum {
-				continue
-			}
+		if remoteChecksum, ok := remoteFileChecksums[toFile]; ok && remoteChecksum == localFileChecksums[toFile] {
+			continue
 		}
 
 		files[fromFile] = toFile
@@ -178,28 +199,153 @@ func (deployment *NodeDeployment) getChangedFiles() map[string]string {
 	return files
 }
 
-func (deployment *NodeDeployment) UploadFiles(forceUpload bool) (_error error) {
+// getManifest renders the checksums in the format of sha256sum
+func (deployment *NodeDeployment) getManifest(localFileChecksums map[string]string) []byte {
+	toFiles := []string{}
+
+	for toFile := range localFileChecksums {
+		toFiles = append(toFiles, toFile)
+	}
+
+	sort.Strings(toFiles)
+
+	var buffer bytes.Buffer
+
+	for _, toFile := range toFiles {
+		buffer.WriteString(fmt.Sprintf("%s  %s\n", localFileChecksums[toFile], toFile))
+	}
+
+	return buffer.Bytes()
+}
+
+func (deployment *NodeDeployment) stopService() {
+	_, _ = deployment.Execute("stop-service", fmt.Sprintf("systemctl stop %s", utils.ServiceName))
+}
+
+func (deployment *NodeDeployment) startService() error {
+	_, error := deployment.Execute("start-service", fmt.Sprintf("systemctl daemon-reload && systemctl enable %s && systemctl start %s", utils.ServiceName, utils.ServiceName))
+
+	return error
+}
+
+func (deployment *NodeDeployment) getRevisionDirectory(revision string) string {
+	return path.Join(deployment.config.GetFullTargetAssetDirectory(utils.DirectoryRevisions), revision)
+}
+
+// backupFiles copies the remote files that are about to be overwritten into the revision directory
+// and removes the revisions that are not listed in keep
+func (deployment *NodeDeployment) backupFiles(revision string, keep []string, files map[string]string) ([]string, error) {
+	targetFiles := []string{}
+
+	for _, toFile := range files {
+		targetFiles = append(targetFiles, toFile)
+	}
+
+	// The manifest has to describe the restored files after a rollback
+	targetFiles = append(targetFiles, deployment.config.GetFullTargetAssetFilename(utils.DeploymentManifest))
+
+	sort.Strings(targetFiles)
+
+	revisionsDirectory := deployment.config.GetFullTargetAssetDirectory(utils.DirectoryRevisions)
+	revisionDirectory := deployment.getRevisionDirectory(revision)
+
+	addedFiles := path.Join(revisionDirectory, utils.RevisionAddedFiles)
+
+	// Files without a backup are listed as added, only those are removed by a rollback
+	command := fmt.Sprintf("mkdir -p %s && : > %s", revisionDirectory, addedFiles)
+
+	for _, toFile := range targetFiles {
+		backupFile := path.Join(revisionDirectory, toFile)
+
+		command += fmt.Sprintf(" && (if [ -f %s ]; then mkdir -p %s && cp -a %s %s; else echo %s >> %s; fi)", toFile, path.Dir(backupFile), toFile, backupFile, toFile, addedFiles)
+	}
+
+	if _, error := deployment.Execute("backup-files", command); error != nil {
+		return nil, error
+	}
+
+	// Remove revisions that are not tracked anymore
+	filter := fmt.Sprintf("-e %s", revision)
+
+	for _, id := range keep {
+		filter += fmt.Sprintf(" -e %s", id)
+	}
+
+	command = fmt.Sprintf("(ls -1 %s | grep -v -x %s | while read name; do rm -Rf %s/$name; done) || true", revisionsDirectory, filter, revisionsDirectory)
+
+	if _, error := deployment.Execute("remove-old-revisions", command); error != nil {
+		return nil, error
+	}
+
+	return targetFiles, nil
+}
+
+// RestoreFiles puts the files saved in a revision back in place. Files recorded as added by that revision are removed,
+// all other files without a backup are kept.
+func (deployment *NodeDeployment) RestoreFiles(revision string, files []string) error {
+	revisionDirectory := deployment.getRevisionDirectory(revision)
+	addedFiles := path.Join(revisionDirectory, utils.RevisionAddedFiles)
+
+	command := ""
+
+	for _, toFile := range files {
+		backupFile := path.Join(revisionDirectory, toFile)
+
+		if len(command) > 0 {
+			command += " && "
+		}
+
+		command += fmt.Sprintf("(if [ -f %s ]; then cp -a %s %s; elif grep -q -x -F %s %s 2>/dev/null; then rm -f %s; fi)", backupFile, backupFile, toFile, toFile, addedFiles, toFile)
+	}
+
+	if len(command) == 0 {
+		return nil
+	}
+
+	log.WithFields(log.Fields{"node": deployment.name, "revision": revision, "files": len(files)}).Info("Restoring files")
+
+	if _, error := deployment.Execute("restore-files", command); error != nil {
+		return error
+	}
+
+	_, error := deployment.Execute("remove-revision", fmt.Sprintf("rm -Rf %s", revisionDirectory))
+
+	return error
+}
+
+// UploadFiles copies the changed files to the node and returns the list of the remote files that were replaced
+func (deployment *NodeDeployment) UploadFiles(checksums *Checksums, forceUpload bool, revision string, keepRevisions []string) (changedFiles []string, _error error) {
 	if _error = deployment.createDirectories(); _error != nil {
 		return
 	}
 
+	localFileChecksums, _error := deployment.getLocalFileChecksums(checksums)
+	if _error != nil {
+		return
+	}
+
+	remoteFileChecksums, manifestFound := deployment.getRemoteFileChecksums()
+
 	var files map[string]string
 
 	if forceUpload {
 		files = deployment.getFiles()
 	} else {
-		files = deployment.getChangedFiles()
+		files = deployment.getChangedFiles(localFileChecksums, remoteFileChecksums)
 	}
 
 	if len(files) > 0 {
-		// Stop service
-		_, _ = deployment.Execute("stop-service", fmt.Sprintf("systemctl stop %s", utils.ServiceName))
+		if len(revision) > 0 {
+			if changedFiles, _error = deployment.backupFiles(revision, keepRevisions, files); _error != nil {
+				return
+			}
+		}
+
+		deployment.stopService()
 	}
 
 	utils.IncreaseProgressStep()
 
-	tasks := utils.Tasks{}
-
 	for name, file := range deployment.config.Config.Assets.Files {
 		fromFile := deployment.config.GetFullLocalAssetFilename(name)
 		toFile := deployment.config.GetFullTargetAssetFilename(name)
@@ -210,22 +356,21 @@ func (deployment *NodeDeployment) UploadFiles(forceUpload bool) (_error error) {
 			continue
 		}
 
+		if !utils.FileExists(fromFile) {
+			log.WithFields(log.Fields{"name": path.Base(toFile), "node": deployment.name, "_target": deployment.node.IP, "_source-filename": fromFile, "_destination-filename": toFile}).Info("Skipping")
+		}
+
+		// The progress of the uploaded files is reported while they are bundled
 		if _, ok := files[fromFile]; !ok {
 			utils.IncreaseProgressStep()
-
-			continue
 		}
-
-		tasks = append(tasks, func() error {
-			defer utils.IncreaseProgressStep()
-
-			return deployment.UploadFile(fromFile, toFile)
-		})
 	}
 
-	// Upload files
-	if errors := utils.RunParallelTasks(tasks, deployment.parallel); len(errors) > 0 {
-		return errors[0]
+	// Upload the changed files or at least the manifest if the node was deployed without one
+	if len(files) > 0 || !manifestFound {
+		if _error = deployment.uploadBundle(files, deployment.getManifest(localFileChecksums)); _error != nil {
+			return
+		}
 	}
 
 	cleanupFiles := []string{}
@@ -255,7 +400,7 @@ func (deployment *NodeDeployment) UploadFiles(forceUpload bool) (_error error) {
 		_, _error = deployment.Execute("cleanup-files", fmt.Sprintf("rm -Rf %s", strings.Join(cleanupFiles, " ")))
 
 		if _error != nil {
-			return _error
+			return
 		}
 	}
 
@@ -263,7 +408,7 @@ func (deployment *NodeDeployment) UploadFiles(forceUpload bool) (_error error) {
 
 	if len(files) > 0 {
 		// Registrate and start service
-		_, _error = deployment.Execute("start-service", fmt.Sprintf("systemctl daemon-reload && systemctl enable %s && systemctl start %s", utils.ServiceName, utils.ServiceName))
+		_error = deployment.startService()
 	}
 
 	utils.IncreaseProgressStep()
@@ -271,7 +416,76 @@ func (deployment *NodeDeployment) UploadFiles(forceUpload bool) (_error error) {
 	return
 }
 
-func (deployment *NodeDeployment) getSession() (*ssh.Session, error) {
+// Connect keeps one SSH connection open for the following commands until Close is called
+func (deployment *NodeDeployment) Connect() error {
+	deployment.clientMutex.Lock()
+	defer deployment.clientMutex.Unlock()
+
+	if deployment.client != nil {
+		return nil
+	}
+
+	client, error := deployment.dial()
+	if error != nil {
+		return error
+	}
+
+	deployment.client = client
+
+	return nil
+}
+
+// Close closes the connection opened by Connect
+func (deployment *NodeDeployment) Close() error {
+	deployment.clientMutex.Lock()
+	defer deployment.clientMutex.Unlock()
+
+	if deployment.client == nil {
+		return nil
+	}
+
+	error := deployment.client.Close()
+
+	deployment.client = nil
+
+	return error
+}
+
+// getSession opens a session on the connection opened by Connect, or on a connection of its own. The returned function
+// closes the session and the connection of its own.
+func (deployment *NodeDeployment) getSession() (*ssh.Session, func(), error) {
+	deployment.clientMutex.Lock()
+	client := deployment.client
+	deployment.clientMutex.Unlock()
+
+	if client != nil {
+		session, error := client.NewSession()
+		if error != nil {
+			return nil, nil, error
+		}
+
+		return session, func() { session.Close() }, nil
+	}
+
+	client, error := deployment.dial()
+	if error != nil {
+		return nil, nil, error
+	}
+
+	session, error := client.NewSession()
+	if error != nil {
+		client.Close()
+
+		return nil, nil, error
+	}
+
+	return session, func() {
+		session.Close()
+		client.Close()
+	}, nil
+}
+
+func (deployment *NodeDeployment) dial() (*ssh.Client, error) {
 	privateKeyContent, error := ioutil.ReadFile(deployment.identityFile)
 	if error != nil {
 		return nil, error
@@ -288,12 +502,13 @@ func (deployment *NodeDeployment) getSession() (*ssh.Session, error) {
 			ssh.PublicKeys(privateKey),
 		},
 		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		Timeout:         utils.SshDialTimeout * time.Second,
 	})
 	if error != nil {
 		return nil, error
 	}
 
-	return client.NewSession()
+	return client, nil
 }
 
 func (deployment *NodeDeployment) pullImage(image string) error {
@@ -335,12 +550,12 @@ func (deployment *NodeDeployment) importImage(image string, filename string) err
 func (deployment *NodeDeployment) Execute(name, command string) (string, error) {
 	log.WithFields(log.Fields{"name": name, "node": deployment.name, "_target": deployment.node.IP, "_command": command}).Info("Executing remote command")
 
-	session, error := deployment.getSession()
+	session, closeSession, error := deployment.getSession()
 	if error != nil {
 		return "", error
 	}
 
-	defer session.Close()
+	defer closeSession()
 
 	var buffer bytes.Buffer
 
@@ -351,45 +566,177 @@ func (deployment *NodeDeployment) Execute(name, command string) (string, error)
 	return buffer.String(), error
 }
 
-func (deployment *NodeDeployment) UploadFile(from, to string) error {
-	deployment.sshLimiter.Lock()
-	defer deployment.sshLimiter.Unlock()
+// ExecuteWithCombinedOutput runs the command like Execute but also captures stderr
+func (deployment *NodeDeployment) ExecuteWithCombinedOutput(name, command string) (string, error) {
+	log.WithFields(log.Fields{"name": name, "node": deployment.name, "_target": deployment.node.IP, "_command": command}).Info("Executing remote command")
 
-	filename := path.Base(to)
+	session, closeSession, error := deployment.getSession()
+	if error != nil {
+		return "", error
+	}
 
-	if !utils.FileExists(from) {
-		log.WithFields(log.Fields{"name": filename, "node": deployment.name, "_target": deployment.node.IP, "_source-filename": from, "_destination-filename": to}).Info("Skipping")
+	defer closeSession()
 
-		return nil
+	output, error := session.CombinedOutput(command)
+
+	return string(output), error
+}
+
+// writeBundle packs the files and the manifest, if any, into a compressed tar stream. The entries are named after the remote filenames.
+func (deployment *NodeDeployment) writeBundle(writer io.Writer, files map[string]string, manifest []byte) error {
+	compressor, error := gzip.NewWriterLevel(writer, gzip.BestSpeed)
+	if error != nil {
+		return error
+	}
+
+	archive := tar.NewWriter(compressor)
+
+	fromFiles := []string{}
+
+	for fromFile := range files {
+		fromFiles = append(fromFiles, fromFile)
+	}
+
+	sort.Strings(fromFiles)
+
+	for _, fromFile := range fromFiles {
+		toFile := files[fromFile]
+
+		log.WithFields(log.Fields{"name": path.Base(toFile), "node": deployment.name, "_target": deployment.node.IP, "_source-filename": fromFile, "_destination-filename": toFile}).Info("Deploying")
+
+		if error := deployment.writeBundleFile(archive, fromFile, toFile); error != nil {
+			return errors.Wrapf(error, "Could not deploy file '%s'", fromFile)
+		}
+
+		utils.IncreaseProgressStep()
 	}
 
-	log.WithFields(log.Fields{"name": filename, "node": deployment.name, "_target": deployment.node.IP, "_source-filename": from, "_destination-filename": to}).Info("Deploying")
+	if manifest != nil {
+		manifestFile := deployment.config.GetFullTargetAssetFilename(utils.DeploymentManifest)
 
-	session, error := deployment.getSession()
+		header := &tar.Header{Typeflag: tar.TypeReg, Name: strings.TrimPrefix(manifestFile, "/"), Mode: 0644, Size: int64(len(manifest)), ModTime: time.Now()}
+
+		if error := archive.WriteHeader(header); error != nil {
+			return error
+		}
+
+		if _, error := archive.Write(manifest); error != nil {
+			return error
+		}
+	}
+
+	if error := archive.Close(); error != nil {
+		return error
+	}
+
+	return compressor.Close()
+}
+
+func (deployment *NodeDeployment) writeBundleFile(archive *tar.Writer, fromFile, toFile string) error {
+	file, error := os.Open(fromFile)
 	if error != nil {
 		return error
 	}
 
-	defer session.Close()
+	defer file.Close()
 
-	if error := scp.CopyPath(from, to, session); error != nil {
-		return fmt.Errorf("Could not deploy file '%s' (%s)", from, error.Error())
+	info, error := file.Stat()
+	if error != nil {
+		return error
 	}
 
-	return nil
+	header := &tar.Header{Typeflag: tar.TypeReg, Name: strings.TrimPrefix(toFile, "/"), Mode: int64(info.Mode().Perm()), Size: info.Size(), ModTime: info.ModTime()}
+
+	if error := archive.WriteHeader(header); error != nil {
+		return error
+	}
+
+	_, error = io.Copy(archive, file)
+
+	return error
 }
 
-func (deployment *NodeDeployment) configureTaint() error {
-	kubeconfig := deployment.config.GetFullLocalAssetFilename(utils.KubeconfigAdmin)
+// uploadBundle streams the files as one compressed tar archive to the node. The archive is unpacked into a staging directory
+// and the files are moved in place only after the whole archive was received, each one with an atomic rename. The manifest
+// is moved last, so that files left behind by an interrupted upload do not match it and are uploaded again.
+func (deployment *NodeDeployment) uploadBundle(files map[string]string, manifest []byte) error {
+	deployment.sshLimiter.Lock()
+	defer deployment.sshLimiter.Unlock()
+
+	bundleErrors := make(chan error, 1)
+	stagingDirectory := deployment.config.GetFullTargetAssetDirectory(utils.DirectoryStaging)
+	manifestFile := "." + deployment.config.GetFullTargetAssetFilename(utils.DeploymentManifest)
+	moveFile := "target=/${name#./}; mkdir -p $(dirname $target) && cp -a $name $target.k8s-tew && mv -f $target.k8s-tew $target"
+
+	command := fmt.Sprintf("rm -Rf %[1]s && mkdir -p %[1]s && tar -xzf - -C %[1]s && cd %[1]s && (find . -type f ! -path %[2]s | while read name; do (%[3]s) || exit 1; done) && (name=%[2]s; test ! -f $name || (%[3]s)) && cd / && rm -Rf %[1]s", stagingDirectory, manifestFile, moveFile)
+
+	log.WithFields(log.Fields{"name": "upload-bundle", "node": deployment.name, "_target": deployment.node.IP, "_command": command, "files": len(files)}).Info("Executing remote command")
 
-	// Configure connection
-	config, error := clientcmd.BuildConfigFromFlags("", kubeconfig)
+	session, closeSession, error := deployment.getSession()
 	if error != nil {
 		return error
 	}
 
-	// Create client
-	clientset, error := kubernetes.NewForConfig(config)
+	defer closeSession()
+
+	reader, writer := io.Pipe()
+
+	defer reader.Close()
+
+	var buffer bytes.Buffer
+
+	session.Stdin = reader
+	session.Stderr = &buffer
+
+	go func() {
+		error := deployment.writeBundle(writer, files, manifest)
+
+		writer.CloseWithError(error)
+
+		bundleErrors <- error
+	}()
+
+	error = session.Run(command)
+
+	// Unblock the writer in case the remote side stopped reading
+	reader.Close()
+
+	bundleError := <-bundleErrors
+
+	// The remote side explains why it stopped reading, the local error is only a consequence of it
+	if error != nil {
+		return fmt.Errorf("Could not deploy files to node '%s' (%s: %s)", deployment.name, error.Error(), strings.TrimSpace(buffer.String()))
+	}
+
+	if bundleError != nil && errors.Cause(bundleError) != io.ErrClosedPipe {
+		return bundleError
+	}
+
+	return nil
+}
+
+// Reset runs the reset command on the node and returns the report of what could not be cleaned up
+func (deployment *NodeDeployment) Reset() (*reset.Report, error) {
+	binary := deployment.config.GetFullTargetAssetFilename(utils.BinaryK8sTew)
+	command := fmt.Sprintf("%s reset --base-directory=%s --hide-progress", binary, deployment.config.Config.DeploymentDirectory)
+
+	output, error := deployment.Execute("reset", command)
+	if error != nil {
+		return nil, fmt.Errorf("Could not reset node '%s' (%s)", deployment.name, error.Error())
+	}
+
+	report, error := reset.ParseReport(output)
+	if error != nil {
+		return nil, error
+	}
+
+	report.Node = deployment.name
+
+	return report, nil
+}
+
+func (deployment *NodeDeployment) configureTaint() error {
+	clientset, error := getClientset(deployment.config)
 	if error != nil {
 		return error
 	}
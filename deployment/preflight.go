@@ -0,0 +1,382 @@
+package deployment
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/darxkies/k8s-tew/config"
+	"github.com/darxkies/k8s-tew/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+const SeverityError = "error"
+const SeverityWarning = "warning"
+
+// Modules that are checked on every node
+var preflightModules = []string{"overlay", "br_netfilter", "btrfs", "ip_tables", "ipip", "rbd", "ceph"}
+
+// Cgroup controllers required by containerd and the kubelet
+var preflightCgroupControllers = []string{"cpu", "cpuacct", "cpuset", "memory", "devices", "freezer", "pids"}
+
+// Sysctls that are collected from every node
+var preflightSysctls = []string{"net.ipv4.ip_forward", "net.bridge.bridge-nf-call-iptables"}
+
+// Facts describe the properties of a node that are relevant for running k8s-tew
+type Facts struct {
+	OS                string
+	Kernel            string
+	Modules           []string
+	Sysctls           map[string]string
+	Ports             []uint16
+	AvailableDisk     uint64
+	TimeOffset        time.Duration
+	Swap              bool
+	CgroupFilesystem  string
+	CgroupControllers []string
+	ServiceActive     bool
+}
+
+// Finding is the result of a failed check
+type Finding struct {
+	Node     string
+	Check    string
+	Severity string
+	Message  string
+}
+
+type Findings []*Finding
+
+// Preflight checks the nodes before the deployment
+type Preflight struct {
+	config       *config.InternalConfig
+	nodes        map[string]*NodeDeployment
+	skipFeatures config.Features
+	parallel     bool
+}
+
+func NewPreflight(_config *config.InternalConfig, identityFile string, skipFeatures config.Features, parallel bool) *Preflight {
+	nodes := map[string]*NodeDeployment{}
+
+	for nodeName, node := range _config.Config.Nodes {
+		nodes[nodeName] = NewNodeDeployment(identityFile, nodeName, node, _config, parallel)
+	}
+
+	return &Preflight{config: _config, nodes: nodes, skipFeatures: skipFeatures, parallel: parallel}
+}
+
+func (preflight *Preflight) Steps() int {
+	return len(preflight.nodes)
+}
+
+// Run collects the facts of all nodes and fails if any check reports an error
+func (preflight *Preflight) Run() error {
+	findings := Findings{}
+	mutex := sync.Mutex{}
+	tasks := utils.Tasks{}
+
+	for _, nodeName := range preflight.config.GetSortedNodeKeys() {
+		nodeDeployment := preflight.nodes[nodeName]
+
+		tasks = append(tasks, func() error {
+			defer utils.IncreaseProgressStep()
+
+			nodeFindings := preflight.checkNode(nodeDeployment)
+
+			mutex.Lock()
+			findings = append(findings, nodeFindings...)
+			mutex.Unlock()
+
+			return nil
+		})
+	}
+
+	_ = utils.RunParallelTasks(tasks, preflight.parallel)
+
+	sort.SliceStable(findings, func(i, j int) bool {
+		return findings[i].Node < findings[j].Node
+	})
+
+	errors := 0
+
+	for _, finding := range findings {
+		entry := log.WithFields(log.Fields{"node": finding.Node, "check": finding.Check, "message": finding.Message})
+
+		if finding.Severity == SeverityError {
+			entry.Error("Preflight check failed")
+
+			errors++
+
+		} else {
+			entry.Warn("Preflight check warning")
+		}
+	}
+
+	if errors > 0 {
+		return fmt.Errorf("%d preflight check(s) failed", errors)
+	}
+
+	log.Info("Preflight checks passed")
+
+	return nil
+}
+
+func (preflight *Preflight) checkNode(nodeDeployment *NodeDeployment) Findings {
+	findings := Findings{}
+
+	addFinding := func(check, severity, message string, arguments ...interface{}) {
+		findings = append(findings, &Finding{Node: nodeDeployment.name, Check: check, Severity: severity, Message: fmt.Sprintf(message, arguments...)})
+	}
+
+	facts, error := preflight.collectFacts(nodeDeployment)
+	if error != nil {
+		addFinding("connection", SeverityError, "could not collect facts (%s)", error.Error())
+
+		return findings
+	}
+
+	node := nodeDeployment.node
+
+	// Operating system
+	tokens := strings.Split(facts.OS, "/")
+
+	if len(tokens) != 2 || (tokens[0] != utils.OsUbuntu && tokens[0] != utils.OsCentos) {
+		addFinding("os", SeverityError, "unsupported operating system '%s'", facts.OS)
+
+	} else if facts.OS != utils.OsUbuntu1804 && !strings.HasPrefix(facts.OS, utils.OsCentos+"/7") {
+		addFinding("os", SeverityWarning, "untested operating system release '%s'", facts.OS)
+	}
+
+	// Kernel
+	if major, minor := parseKernelVersion(facts.Kernel); major < 3 || (major == 3 && minor < 10) {
+		addFinding("kernel", SeverityError, "kernel '%s' is older than 3.10", facts.Kernel)
+	}
+
+	// Modules
+	for _, module := range preflight.getRequiredModules(node) {
+		if !contains(facts.Modules, module) {
+			addFinding("modules", SeverityError, "kernel module '%s' is not available", module)
+		}
+	}
+
+	// Sysctls
+	for _, name := range preflightSysctls {
+		if value, ok := facts.Sysctls[name]; ok && value == "0" {
+			addFinding("sysctls", SeverityWarning, "'%s' is disabled and will be enabled by k8s-tew", name)
+		}
+	}
+
+	// Swap
+	if facts.Swap {
+		addFinding("swap", SeverityWarning, "swap is on and will be turned off by k8s-tew, remove it from /etc/fstab to keep it off after reboots")
+	}
+
+	// Ports are expected to be in use if k8s-tew is already running
+	if !facts.ServiceActive {
+		for _, port := range preflight.getRequiredPorts(node) {
+			if containsPort(facts.Ports, port) {
+				addFinding("ports", SeverityError, "port %d is already in use", port)
+			}
+		}
+	}
+
+	// Disk
+	if minimum := uint64(utils.PreflightMinimumDiskSpace) * 1024 * 1024 * 1024; facts.AvailableDisk < minimum {
+		addFinding("disk", SeverityError, "only %d MiB available under '%s', at least %d GiB are required", facts.AvailableDisk/1024/1024, preflight.config.Config.DeploymentDirectory, utils.PreflightMinimumDiskSpace)
+	}
+
+	// Time
+	if math.Abs(facts.TimeOffset.Seconds()) > utils.PreflightMaximumTimeOffset {
+		addFinding("time", SeverityError, "clock is off by %s compared to this machine", facts.TimeOffset.String())
+	}
+
+	// Cgroups
+	if facts.CgroupFilesystem == "cgroup2fs" {
+		addFinding("cgroups", SeverityError, "the unified cgroup hierarchy (cgroup v2) is not supported")
+	}
+
+	for _, controller := range preflightCgroupControllers {
+		if !contains(facts.CgroupControllers, controller) {
+			addFinding("cgroups", SeverityError, "cgroup controller '%s' is not enabled", controller)
+		}
+	}
+
+	return findings
+}
+
+func (preflight *Preflight) getRequiredModules(node *config.Node) []string {
+	result := []string{"overlay", "br_netfilter", "btrfs", "ip_tables", "ipip"}
+
+	if node.IsWorker() && !preflight.skipFeatures.HasFeatures(config.Features{utils.FeatureStorage}) {
+		result = append(result, "rbd", "ceph")
+	}
+
+	return result
+}
+
+func (preflight *Preflight) getRequiredPorts(node *config.Node) []uint16 {
+	result := []uint16{utils.PortKubelet}
+
+	if node.IsController() {
+		result = append(result, preflight.config.Config.APIServerPort, utils.PortEtcdClient, utils.PortEtcdPeer, preflight.config.Config.LoadBalancerPort)
+
+		if len(preflight.config.Config.ControllerVirtualIP) > 0 {
+			result = append(result, preflight.config.Config.VIPRaftControllerPort)
+		}
+	}
+
+	if node.IsWorker() && len(preflight.config.Config.WorkerVirtualIP) > 0 {
+		result = append(result, preflight.config.Config.VIPRaftWorkerPort)
+	}
+
+	return result
+}
+
+// getFactsCommand returns a script that prints one fact per line as key=value
+func (preflight *Preflight) getFactsCommand() string {
+	deploymentDirectory := preflight.config.Config.DeploymentDirectory
+
+	commands := []string{
+		"echo os=$(. /etc/os-release && echo $ID/$VERSION_ID)",
+		"echo kernel=$(uname -r)",
+		"echo time=$(date +%s.%N)",
+		"echo swap=$(tail -n +2 /proc/swaps | wc -l)",
+		"echo cgroup-filesystem=$(stat -fc %T /sys/fs/cgroup)",
+		"echo cgroup-controllers=$(awk '$4 == 1 {print $1}' /proc/cgroups | tr '\\n' ',')",
+		fmt.Sprintf("echo modules=$(for module in %s; do (grep -q \"^$module \" /proc/modules || modprobe -n $module) >/dev/null 2>&1 && printf \"$module,\"; done)", strings.Join(preflightModules, " ")),
+		"echo ports=$(ss -ltn | tail -n +2 | awk '{print $4}' | sed 's/.*://' | sort -un | tr '\\n' ',')",
+		// The deployment directory might not exist yet
+		fmt.Sprintf("directory=%s; while [ ! -d $directory ]; do directory=$(dirname $directory); done; echo disk=$(df -Pk $directory | tail -1 | awk '{print $4}')", deploymentDirectory),
+		fmt.Sprintf("echo service=$(systemctl is-active %s)", utils.ServiceName),
+	}
+
+	for _, name := range preflightSysctls {
+		commands = append(commands, fmt.Sprintf("echo sysctl-%s=$(sysctl -n %s 2>/dev/null)", name, name))
+	}
+
+	return strings.Join(commands, "; ")
+}
+
+func (preflight *Preflight) collectFacts(nodeDeployment *NodeDeployment) (*Facts, error) {
+	start := time.Now()
+
+	output, error := nodeDeployment.Execute("collect-facts", preflight.getFactsCommand())
+	if error != nil {
+		return nil, error
+	}
+
+	// Assume the remote time was read halfway through the command
+	end := time.Now()
+	localTime := start.Add(end.Sub(start) / 2)
+
+	facts := &Facts{Sysctls: map[string]string{}, Modules: []string{}, Ports: []uint16{}, CgroupControllers: []string{}}
+
+	for _, line := range strings.Split(output, "\n") {
+		tokens := strings.SplitN(line, "=", 2)
+
+		if len(tokens) != 2 {
+			continue
+		}
+
+		key := tokens[0]
+		value := strings.TrimSpace(tokens[1])
+
+		switch key {
+		case "os":
+			facts.OS = value
+
+		case "kernel":
+			facts.Kernel = value
+
+		case "time":
+			if seconds, error := strconv.ParseFloat(value, 64); error == nil {
+				facts.TimeOffset = time.Unix(0, int64(seconds*float64(time.Second))).Sub(localTime)
+			}
+
+		case "swap":
+			facts.Swap = value != "0"
+
+		case "cgroup-filesystem":
+			facts.CgroupFilesystem = value
+
+		case "cgroup-controllers":
+			facts.CgroupControllers = splitList(value)
+
+		case "modules":
+			facts.Modules = splitList(value)
+
+		case "ports":
+			for _, entry := range splitList(value) {
+				if port, error := strconv.ParseUint(entry, 10, 16); error == nil {
+					facts.Ports = append(facts.Ports, uint16(port))
+				}
+			}
+
+		case "disk":
+			if available, error := strconv.ParseUint(value, 10, 64); error == nil {
+				facts.AvailableDisk = available * 1024
+			}
+
+		case "service":
+			facts.ServiceActive = value == "active"
+
+		default:
+			if strings.HasPrefix(key, "sysctl-") && len(value) > 0 {
+				facts.Sysctls[strings.TrimPrefix(key, "sysctl-")] = value
+			}
+		}
+	}
+
+	log.WithFields(log.Fields{"node": nodeDeployment.name, "os": facts.OS, "kernel": facts.Kernel, "_modules": facts.Modules, "_ports": facts.Ports, "_time-offset": facts.TimeOffset.String(), "_cgroup-controllers": facts.CgroupControllers}).Info("Collected facts")
+
+	return facts, nil
+}
+
+func parseKernelVersion(kernel string) (major, minor int) {
+	tokens := strings.SplitN(kernel, ".", 3)
+
+	if len(tokens) < 2 {
+		return
+	}
+
+	major, _ = strconv.Atoi(tokens[0])
+	minor, _ = strconv.Atoi(tokens[1])
+
+	return
+}
+
+func splitList(value string) []string {
+	result := []string{}
+
+	for _, entry := range strings.Split(value, ",") {
+		if entry = strings.TrimSpace(entry); len(entry) > 0 {
+			result = append(result, entry)
+		}
+	}
+
+	return result
+}
+
+func contains(values []string, value string) bool {
+	for _, entry := range values {
+		if entry == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+func containsPort(ports []uint16, port uint16) bool {
+	for _, entry := range ports {
+		if entry == port {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,60 @@
+package deployment
+
+import (
+	"fmt"
+
+	"github.com/darxkies/k8s-tew/config"
+	"github.com/darxkies/k8s-tew/pkg/reset"
+	"github.com/darxkies/k8s-tew/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+// ClusterReset removes k8s-tew from remote nodes
+type ClusterReset struct {
+	config *config.InternalConfig
+	names  []string
+	nodes  map[string]*NodeDeployment
+}
+
+func NewClusterReset(_config *config.InternalConfig, identityFile string, names []string) (*ClusterReset, error) {
+	nodes := map[string]*NodeDeployment{}
+
+	for _, name := range names {
+		node, ok := _config.Config.Nodes[name]
+		if !ok {
+			return nil, fmt.Errorf("node '%s' not found", name)
+		}
+
+		nodes[name] = NewNodeDeployment(identityFile, name, node, _config, false)
+	}
+
+	return &ClusterReset{config: _config, names: names, nodes: nodes}, nil
+}
+
+func (clusterReset *ClusterReset) Steps() int {
+	return len(clusterReset.names)
+}
+
+// Run resets the nodes one after the other. Nodes that cannot be reset are recorded in the reports.
+func (clusterReset *ClusterReset) Run() reset.Reports {
+	reports := reset.Reports{}
+
+	for _, name := range clusterReset.names {
+		nodeDeployment := clusterReset.nodes[name]
+
+		clusterReset.config.SetNode(name, nodeDeployment.node)
+
+		log.WithFields(log.Fields{"node": name}).Info("Resetting node")
+
+		report, error := nodeDeployment.Reset()
+		if error != nil {
+			report = &reset.Report{Node: name, Problems: []*reset.Problem{{Step: "reset", Target: name, Error: error.Error()}}}
+		}
+
+		reports = append(reports, report)
+
+		utils.IncreaseProgressStep()
+	}
+
+	return reports
+}
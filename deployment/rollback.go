@@ -0,0 +1,116 @@
+package deployment
+
+import (
+	"fmt"
+
+	"github.com/darxkies/k8s-tew/config"
+	"github.com/darxkies/k8s-tew/utils"
+
+	log "github.com/sirupsen/logrus"
+)
+
+type Rollback struct {
+	config    *config.InternalConfig
+	nodes     map[string]*NodeDeployment
+	history   *History
+	revisions Revisions
+}
+
+// NewRollback prepares the restoration of the nodes to the state right after the deployment with the id to.
+// If to is empty, the last deployment is undone.
+func NewRollback(_config *config.InternalConfig, identityFile string, to string) (*Rollback, error) {
+	history, error := LoadHistory(_config.GetFullLocalAssetFilename(utils.DeploymentHistory))
+	if error != nil {
+		return nil, error
+	}
+
+	revisions := Revisions{}
+
+	if len(to) == 0 {
+		revision := history.Latest()
+
+		if revision == nil {
+			return nil, fmt.Errorf("no deployments to roll back")
+		}
+
+		revisions = append(revisions, revision)
+
+	} else {
+		if revisions, error = history.After(to); error != nil {
+			return nil, error
+		}
+
+		if len(revisions) == 0 {
+			return nil, fmt.Errorf("deployment '%s' is already the latest one", to)
+		}
+	}
+
+	nodes := map[string]*NodeDeployment{}
+
+	for nodeName, node := range _config.Config.Nodes {
+		nodes[nodeName] = NewNodeDeployment(identityFile, nodeName, node, _config, false)
+	}
+
+	return &Rollback{config: _config, nodes: nodes, history: history, revisions: revisions}, nil
+}
+
+func (rollback *Rollback) Steps() int {
+	return len(rollback.nodes)
+}
+
+func (rollback *Rollback) Run() error {
+	for _, nodeName := range rollback.config.GetSortedNodeKeys() {
+		nodeDeployment := rollback.nodes[nodeName]
+
+		rollback.config.SetNode(nodeName, nodeDeployment.node)
+
+		if error := rollback.runNode(nodeName, nodeDeployment); error != nil {
+			return error
+		}
+
+		utils.IncreaseProgressStep()
+	}
+
+	for _, revision := range rollback.revisions {
+		rollback.history.Remove(revision.ID)
+	}
+
+	if error := rollback.history.Save(); error != nil {
+		return error
+	}
+
+	if revision := rollback.history.Latest(); revision != nil {
+		log.WithFields(log.Fields{"deployment-id": revision.ID}).Info("Rolled back")
+	}
+
+	return nil
+}
+
+func (rollback *Rollback) runNode(nodeName string, nodeDeployment *NodeDeployment) error {
+	changed := false
+
+	for _, revision := range rollback.revisions {
+		if len(revision.Nodes[nodeName]) > 0 {
+			changed = true
+
+			break
+		}
+	}
+
+	if !changed {
+		log.WithFields(log.Fields{"node": nodeName}).Info("Nothing to roll back")
+
+		return nil
+	}
+
+	nodeDeployment.stopService()
+
+	// Revisions are sorted newest first so that the oldest backup wins
+	for _, revision := range rollback.revisions {
+		if error := nodeDeployment.RestoreFiles(revision.ID, revision.Nodes[nodeName]); error != nil {
+			return fmt.Errorf("Could not roll back deployment '%s' on node '%s' (%s)", revision.ID, nodeName, error.Error())
+		}
+	}
+
+	return nodeDeployment.startService()
+}
@@ -0,0 +1,241 @@
+package deployment
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/darxkies/k8s-tew/config"
+	"github.com/darxkies/k8s-tew/pkg/etcd"
+	"github.com/darxkies/k8s-tew/utils"
+	log "github.com/sirupsen/logrus"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// Rotation pushes regenerated certificates and kubeconfigs to one node at a time and restarts the components using them
+type Rotation struct {
+	config         *config.InternalConfig
+	deployment     *Deployment
+	commandRetries uint
+	apiServersOnly bool
+}
+
+func NewRotation(_config *config.InternalConfig, deployment *Deployment, commandRetries uint) *Rotation {
+	return &Rotation{config: _config, deployment: deployment, commandRetries: commandRetries}
+}
+
+// NewAPIServerRotation pushes the files to one controller at a time and only restarts the API servers
+func NewAPIServerRotation(_config *config.InternalConfig, deployment *Deployment, commandRetries uint) *Rotation {
+	return &Rotation{config: _config, deployment: deployment, commandRetries: commandRetries, apiServersOnly: true}
+}
+
+func (rotation *Rotation) Steps() int {
+	result := 0
+
+	if !rotation.deployment.skipPreflight {
+		result += rotation.deployment.preflight.Steps()
+	}
+
+	return result + rotation.RollSteps()
+}
+
+// RollSteps returns the steps of a single Roll
+func (rotation *Rotation) RollSteps() int {
+	result := 0
+
+	for _, nodeName := range rotation.getNodeNames() {
+		// Upload, restart and wait
+		result += rotation.deployment.nodes[nodeName].Steps() + 1
+	}
+
+	return result
+}
+
+// getNodeNames returns the controllers followed by the workers
+func (rotation *Rotation) getNodeNames() []string {
+	controllers := []string{}
+	workers := []string{}
+
+	for _, nodeName := range rotation.config.GetSortedNodeKeys() {
+		if rotation.config.Config.Nodes[nodeName].IsController() {
+			controllers = append(controllers, nodeName)
+
+		} else if !rotation.apiServersOnly {
+			workers = append(workers, nodeName)
+		}
+	}
+
+	return append(controllers, workers...)
+}
+
+func (rotation *Rotation) Run() (_error error) {
+	if _error = rotation.Prepare(); _error != nil {
+		return
+	}
+
+	defer rotation.deployment.saveReport(&_error)
+
+	return rotation.Roll()
+}
+
+// Prepare runs the preflight checks, it is needed only once for several calls of Roll
+func (rotation *Rotation) Prepare() error {
+	return rotation.deployment.prepare()
+}
+
+// Roll uploads the files to one node at a time, restarts the components and waits for them to recover
+func (rotation *Rotation) Roll() (_error error) {
+	for _, nodeName := range rotation.getNodeNames() {
+		if _error = rotation.deployment.uploadFiles([]string{nodeName}); _error != nil {
+			return
+		}
+
+		// The start times of the containers are reported in seconds
+		since := time.Now().Truncate(time.Second)
+
+		if _error = rotation.restartStaticPods(nodeName); _error != nil {
+			return
+		}
+
+		if _error = rotation.waitForNode(nodeName, since); _error != nil {
+			return
+		}
+
+		utils.IncreaseProgressStep()
+	}
+
+	return nil
+}
+
+func (rotation *Rotation) getStaticPods(nodeName string) []string {
+	components := []string{"kube-proxy"}
+
+	if rotation.config.Config.Nodes[nodeName].IsController() {
+		components = append(components, "etcd", "kube-apiserver", "kube-controller-manager", "kube-scheduler")
+	}
+
+	if rotation.apiServersOnly {
+		components = []string{"kube-apiserver"}
+	}
+
+	result := []string{}
+
+	for _, component := range components {
+		result = append(result, fmt.Sprintf("%s-%s", component, nodeName))
+	}
+
+	return result
+}
+
+// restartStaticPods stops the sandboxes of the static pods, the kubelet starts them again with the new files
+func (rotation *Rotation) restartStaticPods(nodeName string) error {
+	nodeDeployment := rotation.deployment.nodes[nodeName]
+
+	rotation.config.SetNode(nodeName, nodeDeployment.node)
+
+	crictl := rotation.config.GetFullTargetAssetFilename(utils.BinaryCrictl)
+	containerdSock := rotation.config.GetFullTargetAssetFilename(utils.ContainerdSock)
+
+	command := fmt.Sprintf("export CONTAINER_RUNTIME_ENDPOINT=unix://%s; for name in %s; do for pod in $(%s pods --namespace kube-system --name $name -q); do %s stopp $pod || exit 1; done; done", containerdSock, strings.Join(rotation.getStaticPods(nodeName), " "), crictl, crictl)
+
+	if output, error := nodeDeployment.ExecuteWithCombinedOutput("restart-static-pods", command); error != nil {
+		return fmt.Errorf("Could not restart static pods on node '%s' (%s: %s)", nodeName, error.Error(), output)
+	}
+
+	return nil
+}
+
+func (rotation *Rotation) waitForNode(nodeName string, since time.Time) error {
+	message := ""
+
+	for retries := uint(0); retries < rotation.commandRetries; retries++ {
+		var ready bool
+
+		if ready, message = rotation.checkNode(nodeName, since); ready {
+			log.WithFields(log.Fields{"node": nodeName}).Info("Rotated node")
+
+			return nil
+		}
+
+		log.WithFields(log.Fields{"node": nodeName, "message": message}).Debug("Waiting for node")
+
+		time.Sleep(time.Second)
+	}
+
+	return fmt.Errorf("Node '%s' did not recover (%s)", nodeName, message)
+}
+
+func (rotation *Rotation) checkNode(nodeName string, since time.Time) (bool, string) {
+	node := rotation.config.Config.Nodes[nodeName]
+
+	if node.IsController() {
+		if error := etcd.CheckHealth(rotation.config, rotation.config.GetETCDClientEndpoints()); error != nil {
+			return false, error.Error()
+		}
+
+		// Connect to the API server of the controller directly instead of going through the load balancer
+		restConfig, error := clientcmd.BuildConfigFromFlags(fmt.Sprintf("https://%s:%d", node.IP, rotation.config.Config.APIServerPort), rotation.config.GetFullLocalAssetFilename(utils.KubeconfigAdmin))
+		if error != nil {
+			return false, error.Error()
+		}
+
+		restConfig.Timeout = 5 * time.Second
+
+		clientset, error := kubernetes.NewForConfig(restConfig)
+		if error != nil {
+			return false, error.Error()
+		}
+
+		if _, error := clientset.Discovery().ServerVersion(); error != nil {
+			return false, fmt.Sprintf("API server is not reachable (%s)", error.Error())
+		}
+	}
+
+	clientset, error := getClientset(rotation.config)
+	if error != nil {
+		return false, error.Error()
+	}
+
+	kubernetesNode, error := clientset.CoreV1().Nodes().Get(nodeName, metav1.GetOptions{})
+	if error != nil {
+		return false, error.Error()
+	}
+
+	nodeReady := false
+
+	for _, condition := range kubernetesNode.Status.Conditions {
+		if condition.Type == v1.NodeReady && condition.Status == v1.ConditionTrue {
+			nodeReady = true
+		}
+	}
+
+	if !nodeReady {
+		return false, "node is not ready"
+	}
+
+	for _, name := range rotation.getStaticPods(nodeName) {
+		pod, error := clientset.CoreV1().Pods(metav1.NamespaceSystem).Get(name, metav1.GetOptions{})
+		if error != nil {
+			return false, error.Error()
+		}
+
+		if len(pod.Status.ContainerStatuses) == 0 {
+			return false, fmt.Sprintf("pod '%s' is not running", name)
+		}
+
+		for _, status := range pod.Status.ContainerStatuses {
+			if status.State.Running == nil || status.State.Running.StartedAt.Time.Before(since) {
+				return false, fmt.Sprintf("pod '%s' was not restarted yet", name)
+			}
+
+			if !status.Ready {
+				return false, fmt.Sprintf("pod '%s' is not ready", name)
+			}
+		}
+	}
+
+	return true, ""
+}
@@ -0,0 +1,76 @@
+package deployment
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/darxkies/k8s-tew/utils"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// RotationState records the stage generated last by a staged rotation and whether it was rolled out to all nodes. An
+// interrupted rotation finishes rolling out that stage before it moves on to the next one.
+type RotationState struct {
+	filename  string
+	Name      string `yaml:"name,omitempty"`
+	Stage     string `yaml:"stage"`
+	RolledOut bool   `yaml:"rolled-out"`
+}
+
+func LoadRotationState(filename string) (*RotationState, error) {
+	state := &RotationState{filename: filename}
+
+	if !utils.FileExists(filename) {
+		return state, nil
+	}
+
+	content, error := ioutil.ReadFile(filename)
+	if error != nil {
+		return nil, error
+	}
+
+	if error := yaml.Unmarshal(content, state); error != nil {
+		return nil, fmt.Errorf("Could not parse rotation state '%s' (%s)", filename, error.Error())
+	}
+
+	return state, nil
+}
+
+func (state *RotationState) Save() error {
+	content, error := yaml.Marshal(state)
+	if error != nil {
+		return error
+	}
+
+	return ioutil.WriteFile(state.filename, content, 0644)
+}
+
+func (state *RotationState) Remove() error {
+	if error := os.Remove(state.filename); error != nil && !os.IsNotExist(error) {
+		return error
+	}
+
+	return nil
+}
+
+// IsPending returns true if the stage generated last was not rolled out yet
+func (state *RotationState) IsPending() bool {
+	return len(state.Stage) > 0 && !state.RolledOut
+}
+
+// Generated records the stage before its files are generated
+func (state *RotationState) Generated(name, stage string) error {
+	state.Name = name
+	state.Stage = stage
+	state.RolledOut = false
+
+	return state.Save()
+}
+
+// Finish records that the stage was rolled out to all nodes
+func (state *RotationState) Finish() error {
+	state.RolledOut = true
+
+	return state.Save()
+}
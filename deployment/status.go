@@ -0,0 +1,613 @@
+package deployment
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/darxkies/k8s-tew/config"
+	"github.com/darxkies/k8s-tew/pkg/etcd"
+	"github.com/darxkies/k8s-tew/pkg/manifest"
+	"github.com/darxkies/k8s-tew/utils"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Pods of namespaces used by addons without a feature or by addons of different features
+const coreFeature = "core"
+
+// NodeStatus is the state of a node as seen from the bootstrapper
+type NodeStatus struct {
+	Name               string                `json:"name"`
+	IP                 string                `json:"ip"`
+	Labels             config.Labels         `json:"labels"`
+	Reachable          bool                  `json:"reachable"`
+	Service            string                `json:"service,omitempty"`
+	Ready              string                `json:"ready"`
+	ConfigVersion      string                `json:"config-version,omitempty"`
+	AssetRevision      string                `json:"asset-revision,omitempty"`
+	LocalAssetRevision string                `json:"local-asset-revision"`
+	ChangedAssets      int                   `json:"changed-assets"`
+	Servers            []config.ServerStatus `json:"servers,omitempty"`
+	FailedCommands     []string              `json:"failed-commands,omitempty"`
+	Errors             []string              `json:"errors,omitempty"`
+}
+
+// Healthy returns true if the node runs the local assets and all its servers
+func (status *NodeStatus) Healthy() bool {
+	if !status.Reachable || status.Service != "active" || status.Ready != string(v1.ConditionTrue) || len(status.FailedCommands) > 0 {
+		return false
+	}
+
+	if status.AssetRevision != status.LocalAssetRevision {
+		return false
+	}
+
+	for _, server := range status.Servers {
+		if server.Degraded || server.Failed() {
+			return false
+		}
+	}
+
+	return true
+}
+
+// getServersSummary counts the running servers and names the others
+func (status *NodeStatus) getServersSummary() string {
+	running := 0
+	others := []string{}
+
+	for _, server := range status.Servers {
+		if server.State == utils.ServerStateRunning && !server.Degraded {
+			running++
+
+			continue
+		}
+
+		state := server.State
+
+		if server.Degraded {
+			state = "degraded"
+		}
+
+		others = append(others, fmt.Sprintf("%s:%s", server.Name, state))
+	}
+
+	result := fmt.Sprintf("%d/%d", running, len(status.Servers))
+
+	if len(others) > 0 {
+		result += " " + strings.Join(others, ",")
+	}
+
+	return result
+}
+
+// ComponentStatus is the health of a control plane component
+type ComponentStatus struct {
+	Name    string `json:"name"`
+	Healthy bool   `json:"healthy"`
+	Message string `json:"message,omitempty"`
+}
+
+// FeatureStatus counts the pods of the namespaces used by the addons of a feature
+type FeatureStatus struct {
+	Feature   string   `json:"feature"`
+	Pods      int      `json:"pods"`
+	Ready     int      `json:"ready"`
+	Unhealthy []string `json:"unhealthy,omitempty"`
+}
+
+// ClusterStatus is the overview shown by 'k8s-tew status'
+type ClusterStatus struct {
+	UpdatedAt  time.Time            `json:"updated-at"`
+	Nodes      []*NodeStatus        `json:"nodes"`
+	Etcd       []*etcd.MemberStatus `json:"etcd"`
+	Components []*ComponentStatus   `json:"components"`
+	Features   []*FeatureStatus     `json:"features"`
+	Errors     []string             `json:"errors,omitempty"`
+	nodes      map[string]*NodeStatus
+	mutex      sync.Mutex
+}
+
+// Healthy returns true if nothing needs attention
+func (status *ClusterStatus) Healthy() bool {
+	if len(status.Errors) > 0 {
+		return false
+	}
+
+	for _, node := range status.Nodes {
+		if !node.Healthy() {
+			return false
+		}
+	}
+
+	for _, member := range status.Etcd {
+		if !member.Healthy {
+			return false
+		}
+	}
+
+	for _, component := range status.Components {
+		if !component.Healthy {
+			return false
+		}
+	}
+
+	for _, feature := range status.Features {
+		if len(feature.Unhealthy) > 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// WriteTable prints the status as tables
+func (status *ClusterStatus) WriteTable(writer io.Writer) {
+	table := tabwriter.NewWriter(writer, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintln(table, "NODE\tIP\tREACHABLE\tSERVICE\tREADY\tSERVERS\tASSETS\tCONFIG")
+
+	for _, node := range status.Nodes {
+		assets := node.AssetRevision
+
+		if len(assets) == 0 {
+			assets = "-"
+
+		} else if node.AssetRevision != node.LocalAssetRevision {
+			assets = fmt.Sprintf("%s (local %s, %d changed)", node.AssetRevision, getValue(node.LocalAssetRevision), node.ChangedAssets)
+		}
+
+		servers := "-"
+
+		if len(node.Servers) > 0 {
+			servers = node.getServersSummary()
+		}
+
+		if len(node.FailedCommands) > 0 {
+			servers += fmt.Sprintf(" failed-commands:%s", strings.Join(node.FailedCommands, ","))
+		}
+
+		fmt.Fprintf(table, "%s\t%s\t%t\t%s\t%s\t%s\t%s\t%s\n", node.Name, node.IP, node.Reachable, getValue(node.Service), getValue(node.Ready), servers, assets, getValue(node.ConfigVersion))
+	}
+
+	fmt.Fprintln(table)
+	fmt.Fprintln(table, "ETCD MEMBER\tENDPOINT\tHEALTHY\tLEADER\tVERSION\tERROR")
+
+	for _, member := range status.Etcd {
+		fmt.Fprintf(table, "%s\t%s\t%t\t%t\t%s\t%s\n", getValue(member.Name), getValue(member.Endpoint), member.Healthy, member.Leader, getValue(member.Version), member.Error)
+	}
+
+	fmt.Fprintln(table)
+	fmt.Fprintln(table, "COMPONENT\tHEALTHY\tMESSAGE")
+
+	for _, component := range status.Components {
+		fmt.Fprintf(table, "%s\t%t\t%s\n", component.Name, component.Healthy, component.Message)
+	}
+
+	fmt.Fprintln(table)
+	fmt.Fprintln(table, "FEATURE\tPODS\tREADY\tUNHEALTHY")
+
+	for _, feature := range status.Features {
+		fmt.Fprintf(table, "%s\t%d\t%d\t%s\n", feature.Feature, feature.Pods, feature.Ready, strings.Join(feature.Unhealthy, ","))
+	}
+
+	table.Flush()
+
+	for _, node := range status.Nodes {
+		for _, message := range node.Errors {
+			fmt.Fprintf(writer, "Error: %s: %s\n", node.Name, message)
+		}
+	}
+
+	for _, message := range status.Errors {
+		fmt.Fprintf(writer, "Error: %s\n", message)
+	}
+}
+
+func getValue(value string) string {
+	if len(value) == 0 {
+		return "-"
+	}
+
+	return value
+}
+
+// StatusCollector gathers the state of the nodes through SSH and the state of the cluster through the API server and etcd
+type StatusCollector struct {
+	config       *config.InternalConfig
+	identityFile string
+}
+
+func NewStatusCollector(_config *config.InternalConfig, identityFile string) *StatusCollector {
+	return &StatusCollector{config: _config, identityFile: identityFile}
+}
+
+// Collect returns the current status. Parts that cannot be checked are reported as errors of the status.
+func (collector *StatusCollector) Collect() (*ClusterStatus, error) {
+	status := &ClusterStatus{UpdatedAt: time.Now().UTC().Truncate(time.Second), Nodes: []*NodeStatus{}, Etcd: []*etcd.MemberStatus{}, Components: []*ComponentStatus{}, Features: []*FeatureStatus{}, Errors: []string{}, nodes: map[string]*NodeStatus{}}
+
+	checksums, error := LoadChecksums(collector.config.GetFullLocalAssetFilename(utils.DeploymentChecksums))
+	if error != nil {
+		return nil, error
+	}
+
+	for _, nodeName := range collector.config.GetSortedNodeKeys() {
+		node := collector.config.Config.Nodes[nodeName]
+
+		nodeStatus := &NodeStatus{Name: nodeName, IP: node.IP, Labels: node.Labels, Ready: string(v1.ConditionUnknown), Errors: []string{}}
+
+		status.Nodes = append(status.Nodes, nodeStatus)
+		status.nodes[nodeName] = nodeStatus
+	}
+
+	// The checksums are only read, they belong to the deployment which may run at the same time
+	collector.collect(status, checksums)
+
+	return status, nil
+}
+
+// collect checks the nodes, etcd and Kubernetes in parallel
+func (collector *StatusCollector) collect(status *ClusterStatus, checksums *Checksums) {
+	tasks := utils.Tasks{}
+
+	for _, nodeStatus := range status.Nodes {
+		nodeStatus := nodeStatus
+
+		tasks = append(tasks, func() error {
+			collector.collectNode(nodeStatus, checksums)
+
+			return nil
+		})
+	}
+
+	tasks = append(tasks, func() error {
+		collector.collectEtcd(status)
+
+		return nil
+	})
+
+	tasks = append(tasks, func() error {
+		collector.collectKubernetes(status)
+
+		return nil
+	})
+
+	_ = utils.RunParallelTasks(tasks, true)
+}
+
+func (status *ClusterStatus) addError(format string, arguments ...interface{}) {
+	status.mutex.Lock()
+	defer status.mutex.Unlock()
+
+	status.Errors = append(status.Errors, fmt.Sprintf(format, arguments...))
+}
+
+// collectNode checks the service, the deployed assets and the servers of the node
+func (collector *StatusCollector) collectNode(status *NodeStatus, checksums *Checksums) {
+	nodeDeployment := NewNodeDeployment(collector.identityFile, status.Name, collector.config.Config.Nodes[status.Name], collector.config, false)
+
+	localFileChecksums, error := nodeDeployment.getLocalFileChecksums(checksums)
+	if error != nil {
+		status.Errors = append(status.Errors, error.Error())
+
+	} else {
+		status.LocalAssetRevision = getAssetRevision(nodeDeployment.getManifest(localFileChecksums))
+	}
+
+	// One connection per node and collection, closed again so that --watch does not pile them up
+	if error := nodeDeployment.Connect(); error != nil {
+		status.Errors = append(status.Errors, error.Error())
+
+		return
+	}
+
+	defer nodeDeployment.Close()
+
+	manifestFile := collector.config.GetFullTargetAssetFilename(utils.DeploymentManifest)
+
+	output, error := nodeDeployment.Execute("get-status", fmt.Sprintf("echo service=$(systemctl is-active %s); cat %s 2>/dev/null || true", utils.ServiceName, manifestFile))
+	if error != nil {
+		status.Errors = append(status.Errors, error.Error())
+
+		return
+	}
+
+	status.Reachable = true
+
+	lines := strings.SplitN(output, "\n", 2)
+
+	status.Service = strings.TrimPrefix(strings.TrimSpace(lines[0]), "service=")
+
+	if len(lines) > 1 && len(strings.TrimSpace(lines[1])) > 0 {
+		status.AssetRevision = getAssetRevision([]byte(lines[1]))
+
+		remoteFileChecksums := parseManifest(lines[1])
+
+		for toFile, checksum := range localFileChecksums {
+			if remoteFileChecksums[toFile] != checksum {
+				status.ChangedAssets++
+			}
+		}
+	}
+
+	if status.Service != "active" {
+		return
+	}
+
+	serversStatus, error := newNodeControl(status.Name, collector.config, nodeDeployment).Status()
+	if error != nil {
+		status.Errors = append(status.Errors, error.Error())
+
+		return
+	}
+
+	status.ConfigVersion = serversStatus.ConfigVersion
+	status.Servers = serversStatus.Servers
+
+	for _, command := range serversStatus.Commands {
+		if command.State == utils.CommandStateFailed {
+			status.FailedCommands = append(status.FailedCommands, command.Name)
+		}
+	}
+}
+
+// getAssetRevision identifies the deployed assets by the checksum of the deployment manifest
+func getAssetRevision(manifest []byte) string {
+	return fmt.Sprintf("%x", sha256.Sum256(manifest))[:12]
+}
+
+// parseManifest reads the checksums in the format of sha256sum indexed by the filenames
+func parseManifest(content string) map[string]string {
+	result := map[string]string{}
+
+	for _, line := range strings.Split(content, "\n") {
+		tokens := strings.Fields(line)
+
+		if len(tokens) < 2 {
+			continue
+		}
+
+		result[tokens[len(tokens)-1]] = tokens[0]
+	}
+
+	return result
+}
+
+func (collector *StatusCollector) collectEtcd(status *ClusterStatus) {
+	endpoints := []string{}
+
+	for _, nodeName := range collector.config.GetSortedNodeKeys() {
+		node := collector.config.Config.Nodes[nodeName]
+
+		if node.IsController() {
+			endpoints = append(endpoints, getEtcdClientEndpoint(node))
+		}
+	}
+
+	members, error := etcd.GetMemberStatuses(collector.config, endpoints)
+	if error != nil {
+		status.addError("etcd: %s", error.Error())
+
+		return
+	}
+
+	sort.Slice(members, func(i, j int) bool {
+		return members[i].Name < members[j].Name
+	})
+
+	status.Etcd = members
+}
+
+// collectKubernetes checks the control plane, the nodes and the pods through the API server
+func (collector *StatusCollector) collectKubernetes(status *ClusterStatus) {
+	clientset, error := getClientset(collector.config)
+	if error != nil {
+		status.addError("kubernetes: %s", error.Error())
+
+		return
+	}
+
+	components, error := getComponentStatuses(clientset)
+	if error != nil {
+		status.addError("kubernetes: %s", error.Error())
+
+		return
+	}
+
+	status.Components = components
+
+	nodes, error := clientset.CoreV1().Nodes().List(metav1.ListOptions{})
+	if error != nil {
+		status.addError("kubernetes: %s", error.Error())
+
+	} else {
+		for _, node := range nodes.Items {
+			nodeStatus, ok := status.nodes[node.Name]
+			if !ok {
+				continue
+			}
+
+			for _, condition := range node.Status.Conditions {
+				if condition.Type == v1.NodeReady {
+					nodeStatus.Ready = string(condition.Status)
+				}
+			}
+		}
+	}
+
+	features, error := collector.getFeatureStatuses(clientset)
+	if error != nil {
+		status.addError("kubernetes: %s", error.Error())
+
+		return
+	}
+
+	status.Features = features
+}
+
+// getComponentStatuses asks the API server for its own health and for the health of the controller manager and the scheduler
+func getComponentStatuses(clientset *kubernetes.Clientset) ([]*ComponentStatus, error) {
+	result := []*ComponentStatus{}
+
+	apiServer := &ComponentStatus{Name: "kube-apiserver"}
+
+	content, error := clientset.Discovery().RESTClient().Get().AbsPath("/healthz").DoRaw()
+	if error != nil {
+		apiServer.Message = error.Error()
+
+	} else {
+		apiServer.Message = string(content)
+		apiServer.Healthy = string(content) == "ok"
+	}
+
+	result = append(result, apiServer)
+
+	components, error := clientset.CoreV1().ComponentStatuses().List(metav1.ListOptions{})
+	if error != nil {
+		return nil, error
+	}
+
+	for _, component := range components.Items {
+		// The members of etcd are checked directly
+		if strings.HasPrefix(component.Name, "etcd-") {
+			continue
+		}
+
+		componentStatus := &ComponentStatus{Name: component.Name}
+
+		for _, condition := range component.Conditions {
+			if condition.Type != v1.ComponentHealthy {
+				continue
+			}
+
+			componentStatus.Healthy = condition.Status == v1.ConditionTrue
+			componentStatus.Message = condition.Message
+
+			if len(condition.Error) > 0 {
+				componentStatus.Message = condition.Error
+			}
+		}
+
+		result = append(result, componentStatus)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+
+	return result, nil
+}
+
+// getFeatureStatuses groups the pods by the feature of the addons using their namespaces
+func (collector *StatusCollector) getFeatureStatuses(clientset *kubernetes.Clientset) ([]*FeatureStatus, error) {
+	applier, error := manifest.NewApplier(collector.config)
+	if error != nil {
+		return nil, error
+	}
+
+	applySets, error := applier.ListAddons()
+	if error != nil {
+		return nil, error
+	}
+
+	namespaceFeatures := map[string]string{}
+
+	for _, applySet := range applySets {
+		feature := applySet.Feature
+
+		if len(feature) == 0 {
+			feature = coreFeature
+		}
+
+		for _, namespace := range applySet.Namespaces {
+			namespaceFeature := feature
+
+			// Namespaces shared by several features are reported as core
+			if existing, ok := namespaceFeatures[namespace]; ok && existing != feature {
+				namespaceFeature = coreFeature
+			}
+
+			namespaceFeatures[namespace] = namespaceFeature
+		}
+	}
+
+	pods, error := clientset.CoreV1().Pods(metav1.NamespaceAll).List(metav1.ListOptions{})
+	if error != nil {
+		return nil, error
+	}
+
+	features := map[string]*FeatureStatus{}
+
+	for _, pod := range pods.Items {
+		feature, ok := namespaceFeatures[pod.Namespace]
+		if !ok {
+			continue
+		}
+
+		featureStatus, ok := features[feature]
+		if !ok {
+			featureStatus = &FeatureStatus{Feature: feature, Unhealthy: []string{}}
+
+			features[feature] = featureStatus
+		}
+
+		featureStatus.Pods++
+
+		if reason, healthy := isPodHealthy(&pod); healthy {
+			featureStatus.Ready++
+
+		} else {
+			featureStatus.Unhealthy = append(featureStatus.Unhealthy, fmt.Sprintf("%s/%s(%s)", pod.Namespace, pod.Name, reason))
+		}
+	}
+
+	result := []*FeatureStatus{}
+
+	for _, featureStatus := range features {
+		sort.Strings(featureStatus.Unhealthy)
+
+		result = append(result, featureStatus)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Feature < result[j].Feature
+	})
+
+	return result, nil
+}
+
+// isPodHealthy returns true for completed pods and for running pods with all containers ready, otherwise the reason
+func isPodHealthy(pod *v1.Pod) (string, bool) {
+	if pod.Status.Phase == v1.PodSucceeded {
+		return "", true
+	}
+
+	if pod.Status.Phase != v1.PodRunning {
+		if len(pod.Status.Reason) > 0 {
+			return pod.Status.Reason, false
+		}
+
+		return string(pod.Status.Phase), false
+	}
+
+	for _, container := range pod.Status.ContainerStatuses {
+		if container.Ready {
+			continue
+		}
+
+		if container.State.Waiting != nil && len(container.State.Waiting.Reason) > 0 {
+			return container.State.Waiting.Reason, false
+		}
+
+		return "NotReady", false
+	}
+
+	return "", true
+}
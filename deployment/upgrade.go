@@ -0,0 +1,474 @@
+package deployment
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/darxkies/k8s-tew/config"
+	"github.com/darxkies/k8s-tew/pkg/etcd"
+	"github.com/darxkies/k8s-tew/utils"
+	log "github.com/sirupsen/logrus"
+	yaml "gopkg.in/yaml.v2"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// UpgradeState records the progress of an upgrade, so that it can be continued after an interruption
+type UpgradeState struct {
+	filename string
+	From     string   `yaml:"from"`
+	To       string   `yaml:"to"`
+	Date     string   `yaml:"date"`
+	Snapshot string   `yaml:"snapshot,omitempty"`
+	Nodes    []string `yaml:"nodes"`
+}
+
+func LoadUpgradeState(filename string) (*UpgradeState, error) {
+	state := &UpgradeState{filename: filename, Nodes: []string{}}
+
+	if !utils.FileExists(filename) {
+		return state, nil
+	}
+
+	content, error := ioutil.ReadFile(filename)
+	if error != nil {
+		return nil, error
+	}
+
+	if error := yaml.Unmarshal(content, state); error != nil {
+		return nil, fmt.Errorf("Could not parse upgrade state '%s' (%s)", filename, error.Error())
+	}
+
+	return state, nil
+}
+
+func (state *UpgradeState) Save() error {
+	content, error := yaml.Marshal(state)
+	if error != nil {
+		return error
+	}
+
+	return ioutil.WriteFile(state.filename, content, 0644)
+}
+
+func (state *UpgradeState) Remove() error {
+	if error := os.Remove(state.filename); error != nil && !os.IsNotExist(error) {
+		return error
+	}
+
+	return nil
+}
+
+func (state *UpgradeState) IsUpgraded(name string) bool {
+	return contains(state.Nodes, name)
+}
+
+// Upgrade moves the cluster to the Kubernetes version of the configuration. The controllers are upgraded one at a time, followed by the workers in batches and the addons.
+type Upgrade struct {
+	config         *config.InternalConfig
+	deployment     *Deployment
+	batchSize      uint
+	commandRetries uint
+	target         string
+	state          *UpgradeState
+}
+
+func NewUpgrade(_config *config.InternalConfig, deployment *Deployment, batchSize uint, commandRetries uint) (*Upgrade, error) {
+	if batchSize == 0 {
+		return nil, fmt.Errorf("batch size has to be at least 1")
+	}
+
+	state, error := LoadUpgradeState(_config.GetFullLocalAssetFilename(utils.UpgradeState))
+	if error != nil {
+		return nil, error
+	}
+
+	return &Upgrade{config: _config, deployment: deployment, batchSize: batchSize, commandRetries: commandRetries, target: utils.ExtractImageTag(_config.Config.Versions.K8S), state: state}, nil
+}
+
+func (upgrade *Upgrade) Steps() int {
+	// Validation, snapshot, deployment and one health check per node
+	return 2 + upgrade.deployment.Steps() + len(upgrade.config.Config.Nodes)
+}
+
+func (upgrade *Upgrade) Run() (_error error) {
+	if _error = upgrade.validate(); _error != nil {
+		return
+	}
+
+	utils.IncreaseProgressStep()
+
+	if _error = upgrade.takeSnapshot(); _error != nil {
+		return
+	}
+
+	utils.IncreaseProgressStep()
+
+	if _error = upgrade.deployment.prepare(); _error != nil {
+		return
+	}
+
+	defer upgrade.deployment.saveReport(&_error)
+
+	controllers := []string{}
+	workers := []string{}
+
+	for _, nodeName := range upgrade.config.GetSortedNodeKeys() {
+		if upgrade.config.Config.Nodes[nodeName].IsController() {
+			controllers = append(controllers, nodeName)
+
+		} else {
+			workers = append(workers, nodeName)
+		}
+	}
+
+	// Never more than one control plane instance is down at a time
+	for _, nodeName := range controllers {
+		if _error = upgrade.upgradeNodes([]string{nodeName}); _error != nil {
+			return
+		}
+	}
+
+	for start := 0; start < len(workers); start += int(upgrade.batchSize) {
+		end := start + int(upgrade.batchSize)
+
+		if end > len(workers) {
+			end = len(workers)
+		}
+
+		if _error = upgrade.upgradeNodes(workers[start:end]); _error != nil {
+			return
+		}
+	}
+
+	log.Info("Upgrading addons")
+
+	if _error = upgrade.deployment.setup(); _error != nil {
+		return
+	}
+
+	log.WithFields(log.Fields{"from": upgrade.state.From, "to": upgrade.state.To}).Info("Upgraded cluster")
+
+	return upgrade.state.Remove()
+}
+
+func parseKubernetesVersion(version string) (major, minor, patch int, _error error) {
+	// Drop pre-release and build information
+	version = strings.TrimPrefix(version, "v")
+	version = strings.SplitN(version, "-", 2)[0]
+	version = strings.SplitN(version, "+", 2)[0]
+
+	tokens := strings.Split(version, ".")
+
+	if len(tokens) != 3 {
+		_error = fmt.Errorf("invalid version '%s'", version)
+
+		return
+	}
+
+	numbers := []*int{&major, &minor, &patch}
+
+	for index, token := range tokens {
+		if *numbers[index], _error = strconv.Atoi(token); _error != nil {
+			_error = fmt.Errorf("invalid version '%s'", version)
+
+			return
+		}
+	}
+
+	return
+}
+
+// compareKubernetesVersions returns a negative value if a is older than b, 0 if they are equal and a positive value otherwise
+func compareKubernetesVersions(a, b [3]int) int {
+	for index := range a {
+		if a[index] != b[index] {
+			return a[index] - b[index]
+		}
+	}
+
+	return 0
+}
+
+// getClusterVersion returns the oldest version of the API server and of the kubelets
+func (upgrade *Upgrade) getClusterVersion() (string, error) {
+	clientset, error := getClientset(upgrade.config)
+	if error != nil {
+		return "", error
+	}
+
+	serverVersion, error := clientset.Discovery().ServerVersion()
+	if error != nil {
+		return "", error
+	}
+
+	result := serverVersion.GitVersion
+
+	nodes, error := clientset.CoreV1().Nodes().List(metav1.ListOptions{})
+	if error != nil {
+		return "", error
+	}
+
+	for _, node := range nodes.Items {
+		version := node.Status.NodeInfo.KubeletVersion
+
+		if !isOlder(version, result) {
+			continue
+		}
+
+		result = version
+	}
+
+	return result, nil
+}
+
+func isOlder(a, b string) bool {
+	aMajor, aMinor, aPatch, aError := parseKubernetesVersion(a)
+	bMajor, bMinor, bPatch, bError := parseKubernetesVersion(b)
+
+	if aError != nil || bError != nil {
+		return false
+	}
+
+	return compareKubernetesVersions([3]int{aMajor, aMinor, aPatch}, [3]int{bMajor, bMinor, bPatch}) < 0
+}
+
+// validate makes sure that the target version is at most one minor version ahead of the cluster. An interrupted upgrade is continued.
+func (upgrade *Upgrade) validate() error {
+	if len(upgrade.state.To) > 0 {
+		if upgrade.state.To != upgrade.target {
+			return fmt.Errorf("an upgrade to '%s' is in progress, restore that version or remove '%s'", upgrade.state.To, upgrade.state.filename)
+		}
+
+		log.WithFields(log.Fields{"from": upgrade.state.From, "to": upgrade.state.To, "upgraded-nodes": upgrade.state.Nodes}).Info("Continuing upgrade")
+
+		return nil
+	}
+
+	current, error := upgrade.getClusterVersion()
+	if error != nil {
+		return fmt.Errorf("Could not determine cluster version (%s)", error.Error())
+	}
+
+	currentMajor, currentMinor, currentPatch, error := parseKubernetesVersion(current)
+	if error != nil {
+		return error
+	}
+
+	targetMajor, targetMinor, targetPatch, error := parseKubernetesVersion(upgrade.target)
+	if error != nil {
+		return error
+	}
+
+	comparison := compareKubernetesVersions([3]int{targetMajor, targetMinor, targetPatch}, [3]int{currentMajor, currentMinor, currentPatch})
+
+	if comparison == 0 {
+		return fmt.Errorf("the cluster is already running '%s'", current)
+	}
+
+	if comparison < 0 {
+		return fmt.Errorf("downgrading from '%s' to '%s' is not supported", current, upgrade.target)
+	}
+
+	if targetMajor != currentMajor || targetMinor > currentMinor+1 {
+		return fmt.Errorf("upgrading from '%s' to '%s' skips minor versions, upgrade one minor version at a time", current, upgrade.target)
+	}
+
+	log.WithFields(log.Fields{"from": current, "to": upgrade.target}).Info("Starting upgrade")
+
+	upgrade.state.From = current
+	upgrade.state.To = upgrade.target
+	upgrade.state.Date = time.Now().Format(time.RFC3339)
+
+	return upgrade.state.Save()
+}
+
+func (upgrade *Upgrade) takeSnapshot() error {
+	if len(upgrade.state.Snapshot) > 0 {
+		return nil
+	}
+
+	filename := path.Join(upgrade.config.GetFullLocalAssetDirectory(utils.DirectoryEtcdSnapshots), fmt.Sprintf("upgrade-%s-%s.db", upgrade.state.To, time.Now().Format("20060102150405")))
+
+	if error := etcd.Snapshot(upgrade.config, upgrade.config.GetETCDClientEndpoints(), filename); error != nil {
+		return error
+	}
+
+	upgrade.state.Snapshot = filename
+
+	return upgrade.state.Save()
+}
+
+// upgradeNodes deploys the new files to the nodes and waits until they run the target version
+func (upgrade *Upgrade) upgradeNodes(nodeNames []string) error {
+	pending := []string{}
+
+	for _, nodeName := range nodeNames {
+		if upgrade.state.IsUpgraded(nodeName) {
+			log.WithFields(log.Fields{"node": nodeName}).Info("Node already upgraded")
+
+			for steps := upgrade.deployment.nodes[nodeName].Steps() + 1; steps > 0; steps-- {
+				utils.IncreaseProgressStep()
+			}
+
+			continue
+		}
+
+		pending = append(pending, nodeName)
+	}
+
+	if len(pending) == 0 {
+		return nil
+	}
+
+	log.WithFields(log.Fields{"nodes": pending}).Info("Upgrading nodes")
+
+	if error := upgrade.deployment.uploadFiles(pending); error != nil {
+		return error
+	}
+
+	for _, nodeName := range pending {
+		if error := upgrade.waitForNode(nodeName); error != nil {
+			return error
+		}
+
+		utils.IncreaseProgressStep()
+
+		upgrade.state.Nodes = append(upgrade.state.Nodes, nodeName)
+
+		if error := upgrade.state.Save(); error != nil {
+			return error
+		}
+	}
+
+	return nil
+}
+
+func (upgrade *Upgrade) waitForNode(nodeName string) error {
+	node := upgrade.config.Config.Nodes[nodeName]
+
+	message := ""
+
+	for retries := uint(0); retries < upgrade.commandRetries; retries++ {
+		var ready bool
+
+		if ready, message = upgrade.checkNode(nodeName, node); ready {
+			log.WithFields(log.Fields{"node": nodeName, "version": upgrade.target}).Info("Upgraded node")
+
+			return nil
+		}
+
+		log.WithFields(log.Fields{"node": nodeName, "message": message}).Debug("Waiting for node")
+
+		time.Sleep(time.Second)
+	}
+
+	return fmt.Errorf("Timed out waiting for node '%s' to be upgraded (%s)", nodeName, message)
+}
+
+// checkNode verifies that the kubelet and the static pods run the target version and that the local API server is healthy
+func (upgrade *Upgrade) checkNode(nodeName string, node *config.Node) (bool, string) {
+	clientset, error := getClientset(upgrade.config)
+	if error != nil {
+		return false, error.Error()
+	}
+
+	if node.IsController() {
+		if ready, message := upgrade.checkAPIServer(node); !ready {
+			return false, message
+		}
+	}
+
+	kubernetesNode, error := clientset.CoreV1().Nodes().Get(nodeName, metav1.GetOptions{})
+	if error != nil {
+		return false, error.Error()
+	}
+
+	if kubernetesNode.Status.NodeInfo.KubeletVersion != upgrade.target {
+		return false, fmt.Sprintf("kubelet is running '%s'", kubernetesNode.Status.NodeInfo.KubeletVersion)
+	}
+
+	nodeReady := false
+
+	for _, condition := range kubernetesNode.Status.Conditions {
+		if condition.Type == v1.NodeReady && condition.Status == v1.ConditionTrue {
+			nodeReady = true
+		}
+	}
+
+	if !nodeReady {
+		return false, "node is not ready"
+	}
+
+	components := []string{"kube-proxy"}
+
+	if node.IsController() {
+		components = append(components, "kube-apiserver", "kube-controller-manager", "kube-scheduler")
+	}
+
+	for _, component := range components {
+		if ready, message := upgrade.checkStaticPod(clientset, fmt.Sprintf("%s-%s", component, nodeName)); !ready {
+			return false, message
+		}
+	}
+
+	return true, ""
+}
+
+// checkAPIServer connects to the API server of the controller directly instead of going through the load balancer
+func (upgrade *Upgrade) checkAPIServer(node *config.Node) (bool, string) {
+	restConfig, error := clientcmd.BuildConfigFromFlags(fmt.Sprintf("https://%s:%d", node.IP, upgrade.config.Config.APIServerPort), upgrade.config.GetFullLocalAssetFilename(utils.KubeconfigAdmin))
+	if error != nil {
+		return false, error.Error()
+	}
+
+	restConfig.Timeout = 5 * time.Second
+
+	clientset, error := kubernetes.NewForConfig(restConfig)
+	if error != nil {
+		return false, error.Error()
+	}
+
+	version, error := clientset.Discovery().ServerVersion()
+	if error != nil {
+		return false, fmt.Sprintf("API server is not reachable (%s)", error.Error())
+	}
+
+	if version.GitVersion != upgrade.target {
+		return false, fmt.Sprintf("API server is running '%s'", version.GitVersion)
+	}
+
+	return true, ""
+}
+
+func (upgrade *Upgrade) checkStaticPod(clientset *kubernetes.Clientset, name string) (bool, string) {
+	pod, error := clientset.CoreV1().Pods(metav1.NamespaceSystem).Get(name, metav1.GetOptions{})
+	if error != nil {
+		return false, error.Error()
+	}
+
+	for _, container := range pod.Spec.Containers {
+		if container.Image != upgrade.config.Config.Versions.K8S {
+			return false, fmt.Sprintf("pod '%s' is running '%s'", name, container.Image)
+		}
+	}
+
+	if len(pod.Status.ContainerStatuses) == 0 {
+		return false, fmt.Sprintf("pod '%s' is not running", name)
+	}
+
+	for _, status := range pod.Status.ContainerStatuses {
+		if !status.Ready {
+			return false, fmt.Sprintf("pod '%s' is not ready", name)
+		}
+	}
+
+	return true, ""
+}
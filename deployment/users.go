@@ -0,0 +1,95 @@
+package deployment
+
+import (
+	"fmt"
+
+	"github.com/darxkies/k8s-tew/config"
+	"github.com/darxkies/k8s-tew/utils"
+	log "github.com/sirupsen/logrus"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+func getUserBindingName(name string, binding config.UserBinding) string {
+	return fmt.Sprintf("%s-%s-%s", utils.UserBindingPrefix, name, binding.Role)
+}
+
+// ApplyUserBindings replaces the role bindings of the user with the recorded ones. Roles bound to a namespace use
+// role bindings, the others cluster role bindings.
+func ApplyUserBindings(_config *config.InternalConfig, user *config.User) error {
+	clientset, error := getClientset(_config)
+	if error != nil {
+		return error
+	}
+
+	if error := deleteUserBindings(clientset, user.Name); error != nil {
+		return error
+	}
+
+	labels := map[string]string{utils.UserBindingPrefix: user.Name}
+	subjects := []rbacv1.Subject{{Kind: rbacv1.UserKind, APIGroup: rbacv1.GroupName, Name: user.Name}}
+
+	for _, binding := range user.Bindings {
+		objectMeta := metav1.ObjectMeta{Name: getUserBindingName(user.Name, binding), Namespace: binding.Namespace, Labels: labels}
+		roleRef := rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "ClusterRole", Name: binding.Role}
+
+		if len(binding.Namespace) == 0 {
+			_, error = clientset.RbacV1().ClusterRoleBindings().Create(&rbacv1.ClusterRoleBinding{ObjectMeta: objectMeta, Subjects: subjects, RoleRef: roleRef})
+
+		} else {
+			_, error = clientset.RbacV1().RoleBindings(binding.Namespace).Create(&rbacv1.RoleBinding{ObjectMeta: objectMeta, Subjects: subjects, RoleRef: roleRef})
+		}
+
+		if error != nil {
+			return fmt.Errorf("Could not bind role '%s' to user '%s' (%s)", binding.String(), user.Name, error.Error())
+		}
+
+		log.WithFields(log.Fields{"user": user.Name, "role": binding.Role, "namespace": binding.Namespace}).Info("Bound role")
+	}
+
+	return nil
+}
+
+// DeleteUserBindings removes all role bindings created for the user
+func DeleteUserBindings(_config *config.InternalConfig, name string) error {
+	clientset, error := getClientset(_config)
+	if error != nil {
+		return error
+	}
+
+	return deleteUserBindings(clientset, name)
+}
+
+func deleteUserBindings(clientset *kubernetes.Clientset, name string) error {
+	options := metav1.ListOptions{LabelSelector: fmt.Sprintf("%s=%s", utils.UserBindingPrefix, name)}
+
+	clusterRoleBindings, error := clientset.RbacV1().ClusterRoleBindings().List(options)
+	if error != nil {
+		return error
+	}
+
+	for _, clusterRoleBinding := range clusterRoleBindings.Items {
+		if error := clientset.RbacV1().ClusterRoleBindings().Delete(clusterRoleBinding.Name, &metav1.DeleteOptions{}); error != nil && !apierrors.IsNotFound(error) {
+			return error
+		}
+
+		log.WithFields(log.Fields{"user": name, "name": clusterRoleBinding.Name}).Info("Deleted cluster role binding")
+	}
+
+	roleBindings, error := clientset.RbacV1().RoleBindings(metav1.NamespaceAll).List(options)
+	if error != nil {
+		return error
+	}
+
+	for _, roleBinding := range roleBindings.Items {
+		if error := clientset.RbacV1().RoleBindings(roleBinding.Namespace).Delete(roleBinding.Name, &metav1.DeleteOptions{}); error != nil && !apierrors.IsNotFound(error) {
+			return error
+		}
+
+		log.WithFields(log.Fields{"user": name, "namespace": roleBinding.Namespace, "name": roleBinding.Name}).Info("Deleted role binding")
+	}
+
+	return nil
+}
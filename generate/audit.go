@@ -0,0 +1,118 @@
+package generate
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+
+	"github.com/darxkies/k8s-tew/utils"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// generateAuditConfig renders the audit policy of the API servers, or copies the custom policy, and the kubeconfig
+// of the optional webhook backend
+func (generator *Generator) generateAuditConfig() error {
+	audit := generator.config.Config.Audit
+
+	if error := audit.Validate(); error != nil {
+		return error
+	}
+
+	policyFilename := generator.config.GetFullLocalAssetFilename(utils.AuditPolicy)
+
+	if len(audit.PolicyFile) > 0 {
+		if error := copyAuditPolicy(audit.PolicyFile, policyFilename); error != nil {
+			return error
+		}
+
+	} else {
+		if error := utils.ApplyTemplateAndSave("audit-policy", utils.TemplateAuditPolicy, struct {
+			Policy string
+		}{
+			Policy: audit.Policy,
+		}, policyFilename, true, false); error != nil {
+			return error
+		}
+	}
+
+	webhookFilename := generator.config.GetFullLocalAssetFilename(utils.AuditWebhookConfig)
+
+	if len(audit.WebhookURL) == 0 {
+		if error := os.Remove(webhookFilename); error != nil && !os.IsNotExist(error) {
+			return error
+		}
+
+		return nil
+	}
+
+	base64CA := ""
+
+	if len(audit.WebhookCAFile) > 0 {
+		var error error
+
+		base64CA, error = utils.GetBase64OfPEM(audit.WebhookCAFile)
+		if error != nil {
+			return error
+		}
+	}
+
+	return utils.ApplyTemplateAndSave("audit-webhook-config", utils.TemplateAuditWebhookConfig, struct {
+		WebhookURL string
+		CAData     string
+	}{
+		WebhookURL: audit.WebhookURL,
+		CAData:     base64CA,
+	}, webhookFilename, true, false)
+}
+
+// copyAuditPolicy checks that the custom file is an audit policy before copying it
+func copyAuditPolicy(source, destination string) error {
+	content, error := ioutil.ReadFile(source)
+	if error != nil {
+		return fmt.Errorf("Could not read audit policy '%s' (%s)", source, error.Error())
+	}
+
+	policy := struct {
+		APIVersion string `yaml:"apiVersion"`
+		Kind       string `yaml:"kind"`
+	}{}
+
+	if error := yaml.Unmarshal(content, &policy); error != nil {
+		return fmt.Errorf("Could not parse audit policy '%s' (%s)", source, error.Error())
+	}
+
+	if policy.Kind != "Policy" || path.Dir(policy.APIVersion) != "audit.k8s.io" {
+		return fmt.Errorf("'%s' is not an audit policy", source)
+	}
+
+	if error := utils.CreateDirectoryIfMissing(path.Dir(destination)); error != nil {
+		return error
+	}
+
+	if error := ioutil.WriteFile(destination, content, 0644); error != nil {
+		return error
+	}
+
+	utils.LogFilename("Generated", destination)
+
+	return nil
+}
+
+// getAuditLog returns the audit log of the API servers on the controllers
+func (generator *Generator) getAuditLog() string {
+	if len(generator.config.Config.Audit.LogPath) > 0 {
+		return generator.config.Config.Audit.LogPath
+	}
+
+	return path.Join(generator.config.GetFullTargetAssetDirectory(utils.DirectoryLogging), utils.AuditLog)
+}
+
+// getAuditWebhook returns the target filename of the webhook kubeconfig, or an empty string if there is no webhook
+func (generator *Generator) getAuditWebhook() string {
+	if len(generator.config.Config.Audit.WebhookURL) == 0 {
+		return ""
+	}
+
+	return generator.config.GetFullTargetAssetFilename(utils.AuditWebhookConfig)
+}
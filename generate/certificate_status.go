@@ -0,0 +1,365 @@
+package generate
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"sort"
+
+	"github.com/darxkies/k8s-tew/pki"
+	"github.com/darxkies/k8s-tew/utils"
+	log "github.com/sirupsen/logrus"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// CertificateStatus describes one certificate found in the assets, in a kubeconfig or served by an endpoint
+type CertificateStatus struct {
+	Name   string `json:"name"`
+	Node   string `json:"node,omitempty"`
+	Source string `json:"source"`
+	pki.CertificateInfo
+	Problems []string `json:"problems,omitempty"`
+}
+
+type CertificateStatuses []*CertificateStatus
+
+// Problems returns the count of certificates with problems
+func (statuses CertificateStatuses) Problems() int {
+	result := 0
+
+	for _, status := range statuses {
+		if len(status.Problems) > 0 {
+			result++
+		}
+	}
+
+	return result
+}
+
+// Dump logs the status of every certificate
+func (statuses CertificateStatuses) Dump() {
+	for _, status := range statuses {
+		fields := log.Fields{"name": status.Name, "source": status.Source, "subject": status.Subject, "issuer": status.Issuer, "serial": status.Serial, "key-algorithm": status.Algorithm, "not-after": status.NotAfter.Format("2006-01-02"), "days-left": status.DaysLeft}
+
+		if len(status.Node) > 0 {
+			fields["node"] = status.Node
+		}
+
+		if len(status.DNSNames) > 0 || len(status.IPAddresses) > 0 {
+			fields["sans"] = append(append([]string{}, status.DNSNames...), status.IPAddresses...)
+		}
+
+		if len(status.Problems) == 0 {
+			log.WithFields(fields).Info("Certificate")
+
+			continue
+		}
+
+		fields["problems"] = status.Problems
+
+		log.WithFields(fields).Warn("Certificate")
+	}
+}
+
+type certificateInventory struct {
+	generator *Generator
+	threshold uint
+	cas       map[string][]*x509.Certificate
+	leafs     map[string]*x509.Certificate
+	statuses  CertificateStatuses
+}
+
+// GetCertificateStatuses lists the CAs, the leaf certificates and the certificates embedded in the kubeconfigs. Certificates expiring
+// within threshold days, not signed by a trusted CA or with SANs not matching the nodes are flagged. With probe, the certificates
+// served by the API servers, etcd and the kubelets are compared with the local ones.
+func (generator *Generator) GetCertificateStatuses(threshold uint, probe bool) (CertificateStatuses, error) {
+	inventory := &certificateInventory{generator: generator, threshold: threshold, cas: map[string][]*x509.Certificate{}, leafs: map[string]*x509.Certificate{}, statuses: CertificateStatuses{}}
+
+	if error := inventory.addCAs(); error != nil {
+		return nil, error
+	}
+
+	inventory.addLeafs()
+	inventory.addKubeconfigs()
+
+	if probe {
+		inventory.addEndpoints()
+	}
+
+	return inventory.statuses, nil
+}
+
+func (inventory *certificateInventory) add(name, node, source string, certificate *x509.Certificate, problems ...string) *CertificateStatus {
+	status := &CertificateStatus{Name: name, Node: node, Source: source, Problems: problems}
+
+	if certificate != nil {
+		status.CertificateInfo = pki.NewCertificateInfo(certificate)
+
+		// The days left are truncated, a certificate expired less than a day ago has none left either
+		if status.Expired {
+			status.Problems = append(status.Problems, "expired")
+
+		} else if uint(status.DaysLeft) < inventory.threshold {
+			status.Problems = append(status.Problems, fmt.Sprintf("expires in %d days", status.DaysLeft))
+		}
+	}
+
+	inventory.statuses = append(inventory.statuses, status)
+
+	return status
+}
+
+func (inventory *certificateInventory) addCAs() error {
+	config := inventory.generator.config
+
+	for _, authority := range getAuthorities() {
+		filename := config.GetFullLocalAssetFilename(authority.certificate)
+
+		cas, error := pki.LoadCertificates(filename)
+		if error != nil {
+			return error
+		}
+
+		inventory.cas[authority.name] = cas
+
+		for _, ca := range cas {
+			inventory.add(authority.name, "", filename, ca)
+		}
+	}
+
+	// Files of a CA rotation in progress
+	for _, authority := range getAuthorities() {
+		for _, name := range []string{authority.next, authority.previous} {
+			filename := config.GetFullLocalAssetFilename(name)
+
+			if !utils.FileExists(filename) {
+				continue
+			}
+
+			certificates, error := pki.LoadCertificates(filename)
+			if error != nil {
+				return error
+			}
+
+			for _, certificate := range certificates {
+				inventory.add(authority.name, "", filename, certificate)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (inventory *certificateInventory) isTrusted(authority string, certificate *x509.Certificate) bool {
+	if len(authority) == 0 {
+		authority = authorityKubernetes
+	}
+
+	for _, ca := range inventory.cas[authority] {
+		if certificate.CheckSignatureFrom(ca) == nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+// getSANProblems compares the SANs of the certificate with the expected ones
+func getSANProblems(certificate *x509.Certificate, dnsNames, ipAddresses []string) []string {
+	expected := map[string]bool{}
+	actual := map[string]bool{}
+
+	for _, name := range append(append([]string{}, dnsNames...), ipAddresses...) {
+		expected[name] = true
+	}
+
+	for _, name := range certificate.DNSNames {
+		actual[name] = true
+	}
+
+	for _, ipAddress := range certificate.IPAddresses {
+		actual[ipAddress.String()] = true
+	}
+
+	result := []string{}
+
+	for name := range expected {
+		if !actual[name] {
+			result = append(result, fmt.Sprintf("missing SAN %s", name))
+		}
+	}
+
+	for name := range actual {
+		if !expected[name] {
+			result = append(result, fmt.Sprintf("unexpected SAN %s", name))
+		}
+	}
+
+	sort.Strings(result)
+
+	return result
+}
+
+func getLeafKey(name, node string) string {
+	return fmt.Sprintf("%s/%s", name, node)
+}
+
+func (inventory *certificateInventory) addLeafs() {
+	config := inventory.generator.config
+
+	for _, certificate := range inventory.generator.getCertificates() {
+		if len(certificate.node) > 0 {
+			config.SetNode(certificate.node, config.Config.Nodes[certificate.node])
+		}
+
+		filename := config.GetFullLocalAssetFilename(certificate.certificate)
+
+		certificates, error := pki.LoadCertificates(filename)
+		if error != nil {
+			inventory.add(certificate.name, certificate.node, filename, nil, error.Error())
+
+			continue
+		}
+
+		problems := []string{}
+
+		// The SANs of the manual certificates are not kept up to date
+		if !certificate.manual {
+			problems = getSANProblems(certificates[0], certificate.dnsNames, certificate.ipAddresses)
+		}
+
+		if algorithm := inventory.generator.getKeyOptions().Algorithm; pki.GetKeyAlgorithm(certificates[0].PublicKey) != algorithm {
+			problems = append(problems, fmt.Sprintf("key algorithm differs from the configured %s", algorithm))
+		}
+
+		if !inventory.isTrusted(certificate.authority, certificates[0]) {
+			problems = append(problems, "not signed by a trusted CA")
+		}
+
+		inventory.leafs[getLeafKey(certificate.name, certificate.node)] = certificates[0]
+
+		inventory.add(certificate.name, certificate.node, filename, certificates[0], problems...)
+	}
+}
+
+func (inventory *certificateInventory) addKubeconfig(name, node, kubeconfig string) {
+	config := inventory.generator.config
+
+	filename := config.GetFullLocalAssetFilename(kubeconfig)
+
+	kubeconfigContent, error := clientcmd.LoadFromFile(filename)
+	if error != nil {
+		inventory.add(name, node, filename, nil, error.Error())
+
+		return
+	}
+
+	caContent, error := ioutil.ReadFile(config.GetFullLocalAssetFilename(utils.PemCa))
+	if error != nil {
+		inventory.add(name, node, filename, nil, error.Error())
+
+		return
+	}
+
+	problems := []string{}
+
+	for _, cluster := range kubeconfigContent.Clusters {
+		if !bytes.Equal(cluster.CertificateAuthorityData, caContent) {
+			problems = append(problems, "embedded CA differs from the current CA bundle")
+		}
+	}
+
+	for _, authInfo := range kubeconfigContent.AuthInfos {
+		certificates, error := pki.ParseCertificates(authInfo.ClientCertificateData)
+		if error != nil || len(certificates) == 0 {
+			inventory.add(name, node, filename, nil, "no client certificate embedded")
+
+			continue
+		}
+
+		if leaf, ok := inventory.leafs[getLeafKey(name, node)]; ok && leaf.SerialNumber.Cmp(certificates[0].SerialNumber) != 0 {
+			problems = append(problems, "embedded certificate differs from the certificate file")
+		}
+
+		if !inventory.isTrusted(authorityKubernetes, certificates[0]) {
+			problems = append(problems, "not signed by a trusted CA")
+		}
+
+		inventory.add(name, node, filename, certificates[0], problems...)
+	}
+}
+
+func (inventory *certificateInventory) addKubeconfigs() {
+	config := inventory.generator.config
+
+	inventory.addKubeconfig("admin", "", utils.KubeconfigAdmin)
+	inventory.addKubeconfig("controller-manager", "", utils.KubeconfigControllerManager)
+	inventory.addKubeconfig("scheduler", "", utils.KubeconfigScheduler)
+	inventory.addKubeconfig("proxy", "", utils.KubeconfigProxy)
+
+	for _, nodeName := range config.GetSortedNodeKeys() {
+		config.SetNode(nodeName, config.Config.Nodes[nodeName])
+
+		inventory.addKubeconfig("kubelet", nodeName, utils.KubeconfigKubelet)
+	}
+}
+
+func (inventory *certificateInventory) loadClientCertificate(certificate, key string) (tls.Certificate, error) {
+	config := inventory.generator.config
+
+	return tls.LoadX509KeyPair(config.GetFullLocalAssetFilename(certificate), config.GetFullLocalAssetFilename(key))
+}
+
+// probe compares the certificate served at the address with the local one
+func (inventory *certificateInventory) probe(name, node, authority, address string, clientCertificate tls.Certificate, expected *x509.Certificate) {
+	certificate, error := pki.ProbeCertificate(address, clientCertificate)
+	if error != nil {
+		inventory.add(name, node, address, nil, error.Error())
+
+		return
+	}
+
+	problems := []string{}
+
+	if expected != nil && expected.SerialNumber.Cmp(certificate.SerialNumber) != 0 {
+		problems = append(problems, "served certificate differs from the certificate file")
+	}
+
+	if !inventory.isTrusted(authority, certificate) {
+		problems = append(problems, "not signed by a trusted CA")
+	}
+
+	inventory.add(name, node, address, certificate, problems...)
+}
+
+func (inventory *certificateInventory) addEndpoints() {
+	config := inventory.generator.config
+
+	adminCertificate, error := inventory.loadClientCertificate(utils.PemAdmin, utils.PemAdminKey)
+	if error != nil {
+		inventory.add("admin", "", config.GetFullLocalAssetFilename(utils.PemAdmin), nil, error.Error())
+
+		return
+	}
+
+	etcdClientCertificate, error := inventory.loadClientCertificate(utils.PemEtcdClient, utils.PemEtcdClientKey)
+	if error != nil {
+		inventory.add("etcd-client", "", config.GetFullLocalAssetFilename(utils.PemEtcdClient), nil, error.Error())
+
+		return
+	}
+
+	for _, nodeName := range config.GetSortedNodeKeys() {
+		node := config.Config.Nodes[nodeName]
+
+		if node.IsController() {
+			inventory.probe("kubernetes", nodeName, authorityKubernetes, net.JoinHostPort(node.IP, fmt.Sprintf("%d", config.Config.APIServerPort)), adminCertificate, inventory.leafs[getLeafKey("kubernetes", "")])
+			inventory.probe("etcd-server", nodeName, authorityEtcd, net.JoinHostPort(node.IP, fmt.Sprintf("%d", utils.PortEtcdClient)), etcdClientCertificate, inventory.leafs[getLeafKey("etcd-server", nodeName)])
+		}
+
+		inventory.probe("kubelet", nodeName, authorityKubernetes, net.JoinHostPort(node.IP, fmt.Sprintf("%d", utils.PortKubelet)), adminCertificate, inventory.leafs[getLeafKey("kubelet", nodeName)])
+	}
+}
@@ -0,0 +1,660 @@
+package generate
+
+import (
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/darxkies/k8s-tew/pki"
+	"github.com/darxkies/k8s-tew/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+const authorityKubernetes = "ca"
+const authorityEtcd = "etcd-ca"
+const authorityFrontProxy = "front-proxy-ca"
+
+// authority describes a CA. The cluster CA signs the certificates of the Kubernetes components, the etcd CA the
+// certificates of etcd and its clients and the front-proxy CA the client certificate of the aggregator. The next and the
+// previous CA are only present while the CA is rotated.
+type authority struct {
+	name        string
+	commonName  string
+	certificate string
+	key         string
+	next        string
+	nextKey     string
+	previous    string
+}
+
+func getAuthorities() []*authority {
+	return []*authority{
+		{name: authorityKubernetes, commonName: "Kubernetes", certificate: utils.PemCa, key: utils.PemCaKey, next: utils.PemCaNext, nextKey: utils.PemCaNextKey, previous: utils.PemCaPrevious},
+		{name: authorityEtcd, commonName: "etcd-ca", certificate: utils.PemEtcdCa, key: utils.PemEtcdCaKey, next: utils.PemEtcdCaNext, nextKey: utils.PemEtcdCaNextKey, previous: utils.PemEtcdCaPrevious},
+		{name: authorityFrontProxy, commonName: "front-proxy-ca", certificate: utils.PemFrontProxyCa, key: utils.PemFrontProxyCaKey, next: utils.PemFrontProxyCaNext, nextKey: utils.PemFrontProxyCaNextKey, previous: utils.PemFrontProxyCaPrevious},
+	}
+}
+
+// certificate describes a leaf certificate signed by one of the CAs, the cluster CA if no authority is set
+type certificate struct {
+	name         string
+	node         string
+	authority    string
+	commonName   string
+	organization string
+	dnsNames     []string
+	ipAddresses  []string
+	certificate  string
+	key          string
+	// Not reissued unless selected explicitly, even if the SANs changed
+	manual bool
+}
+
+// getKubernetesSANs returns the DNS names and the IP addresses the API servers are reached with
+func (generator *Generator) getKubernetesSANs() ([]string, []string) {
+	clusterDomain := generator.config.Config.ClusterDomain
+
+	dnsNames := []string{"kubernetes", "kubernetes.default", "kubernetes.default.svc", "kubernetes.default.svc." + clusterDomain, "localhost"}
+	ipAddresses := []string{"127.0.0.1"}
+
+	if serviceIP, error := generator.config.GetKubernetesServiceIP(); error == nil {
+		ipAddresses = append(ipAddresses, serviceIP)
+	}
+
+	if len(generator.config.Config.ControllerVirtualIP) > 0 {
+		ipAddresses = append(ipAddresses, generator.config.Config.ControllerVirtualIP)
+	}
+
+	for nodeName, node := range generator.config.Config.Nodes {
+		dnsNames = append(dnsNames, nodeName)
+		ipAddresses = append(ipAddresses, node.IP)
+	}
+
+	for _, name := range generator.config.Config.ExtraSANs {
+		if net.ParseIP(name) != nil {
+			ipAddresses = append(ipAddresses, name)
+
+		} else {
+			dnsNames = append(dnsNames, name)
+		}
+	}
+
+	return dnsNames, ipAddresses
+}
+
+func (generator *Generator) getCertificates() []*certificate {
+	kubernetesDNSNames, kubernetesIPAddresses := generator.getKubernetesSANs()
+
+	result := []*certificate{
+		{name: "admin", commonName: utils.CnAdmin, organization: "system:masters", certificate: utils.PemAdmin, key: utils.PemAdminKey},
+		{name: "kubernetes", commonName: "kubernetes", organization: "Kubernetes", dnsNames: kubernetesDNSNames, ipAddresses: kubernetesIPAddresses, certificate: utils.PemKubernetes, key: utils.PemKubernetesKey},
+		{name: "aggregator", authority: authorityFrontProxy, commonName: utils.CnAggregator, organization: "Kubernetes", certificate: utils.PemAggregator, key: utils.PemAggregatorKey},
+		{name: "etcd-client", authority: authorityEtcd, commonName: utils.CnEtcdClient, organization: "system:masters", certificate: utils.PemEtcdClient, key: utils.PemEtcdClientKey},
+		// The key signs the service account tokens, replacing it invalidates all tokens
+		{name: "service-account", commonName: "service-accounts", organization: "Kubernetes", dnsNames: kubernetesDNSNames, ipAddresses: kubernetesIPAddresses, certificate: utils.PemServiceAccount, key: utils.PemServiceAccountKey, manual: true},
+		{name: "controller-manager", commonName: utils.CnSystemKubeControllerManager, organization: "system:node-controller-manager", certificate: utils.PemControllerManager, key: utils.PemControllerManagerKey},
+		{name: "scheduler", commonName: utils.CnSystemKubeScheduler, organization: "system:kube-scheduler", certificate: utils.PemScheduler, key: utils.PemSchedulerKey},
+		{name: "proxy", commonName: utils.CnSystemKubeProxy, organization: "system:node-proxier", certificate: utils.PemProxy, key: utils.PemProxyKey},
+	}
+
+	for nodeName, node := range generator.config.Config.Nodes {
+		result = append(result, &certificate{name: "kubelet", node: nodeName, commonName: fmt.Sprintf(utils.CnSystemNodePrefix, nodeName), organization: "system:nodes", dnsNames: []string{nodeName}, ipAddresses: []string{node.IP}, certificate: utils.PemKubelet, key: utils.PemKubeletKey})
+	}
+
+	for nodeName, node := range generator.config.Config.Nodes {
+		if !node.IsController() {
+			continue
+		}
+
+		dnsNames := []string{nodeName, "localhost"}
+		ipAddresses := []string{node.IP, "127.0.0.1"}
+
+		result = append(result, &certificate{name: "etcd-server", node: nodeName, authority: authorityEtcd, commonName: nodeName, organization: "etcd", dnsNames: dnsNames, ipAddresses: ipAddresses, certificate: utils.PemEtcdServer, key: utils.PemEtcdServerKey})
+		result = append(result, &certificate{name: "etcd-peer", node: nodeName, authority: authorityEtcd, commonName: nodeName, organization: "etcd", dnsNames: dnsNames, ipAddresses: ipAddresses, certificate: utils.PemEtcdPeer, key: utils.PemEtcdPeerKey})
+	}
+
+	return result
+}
+
+// GetCertificateNames returns the names of the leaf certificates that can be rotated
+func (generator *Generator) GetCertificateNames() []string {
+	names := map[string]bool{}
+
+	for _, certificate := range generator.getCertificates() {
+		names[certificate.name] = true
+	}
+
+	result := []string{}
+
+	for name := range names {
+		result = append(result, name)
+	}
+
+	sort.Strings(result)
+
+	return result
+}
+
+// loadCA loads the certificates and private keys of all CAs
+func (generator *Generator) loadCA() error {
+	generator.cas = map[string]*pki.CertificateAndPrivateKey{}
+
+	for _, authority := range getAuthorities() {
+		privateKeyFilename := generator.config.GetFullLocalAssetFilename(authority.key)
+
+		if generator.isExternal(authority) {
+			privateKeyFilename = ""
+		}
+
+		ca, error := pki.LoadCertificateAndPrivateKey(generator.config.GetFullLocalAssetFilename(authority.certificate), privateKeyFilename)
+		if error != nil {
+			return error
+		}
+
+		generator.cas[authority.name] = ca
+	}
+
+	generator.ca = generator.cas[authorityKubernetes]
+
+	return nil
+}
+
+func (generator *Generator) getSigner(certificate *certificate) *pki.CertificateAndPrivateKey {
+	if len(certificate.authority) == 0 {
+		return generator.ca
+	}
+
+	return generator.cas[certificate.authority]
+}
+
+func (generator *Generator) getKeyOptions() pki.KeyOptions {
+	return pki.NewKeyOptions(generator.config.Config.KeyAlgorithm, generator.config.Config.RSASize)
+}
+
+// checkKeyAlgorithm warns about existing certificates using another key algorithm than the configured one
+func (generator *Generator) checkKeyAlgorithm(name, filename string, expected string) {
+	if !utils.FileExists(filename) {
+		return
+	}
+
+	certificates, error := pki.LoadCertificates(filename)
+	if error != nil {
+		return
+	}
+
+	if algorithm := pki.GetKeyAlgorithm(certificates[0].PublicKey); algorithm != expected {
+		log.WithFields(log.Fields{"name": name, "filename": filename, "algorithm": algorithm, "configured-algorithm": expected}).Warn("Certificate uses another key algorithm, rotate it to migrate")
+	}
+}
+
+// isSignedBy returns true if the certificate does not exist yet or if it was signed by the CA
+func (generator *Generator) isSignedBy(filename string, ca *pki.CertificateAndPrivateKey) bool {
+	if !utils.FileExists(filename) {
+		return true
+	}
+
+	certificates, error := pki.LoadCertificates(filename)
+	if error != nil {
+		return true
+	}
+
+	if error := certificates[0].CheckSignatureFrom(ca.Certificate); error != nil {
+		log.WithFields(log.Fields{"filename": filename, "ca": ca.CertificateFilename}).Info("Reissuing certificate not signed by its CA")
+
+		return false
+	}
+
+	return true
+}
+
+// hasSANs returns true if the certificate does not exist yet or if its SANs match the nodes and the configuration
+func (generator *Generator) hasSANs(filename string, certificate *certificate) bool {
+	if !utils.FileExists(filename) {
+		return true
+	}
+
+	certificates, error := pki.LoadCertificates(filename)
+	if error != nil {
+		return true
+	}
+
+	if problems := getSANProblems(certificates[0], certificate.dnsNames, certificate.ipAddresses); len(problems) > 0 {
+		log.WithFields(log.Fields{"filename": filename, "problems": strings.Join(problems, ", ")}).Info("Reissuing certificate with changed SANs")
+
+		return false
+	}
+
+	return true
+}
+
+func (generator *Generator) generateCertificate(certificate *certificate, force bool) error {
+	if len(certificate.node) > 0 {
+		generator.config.SetNode(certificate.node, generator.config.Config.Nodes[certificate.node])
+	}
+
+	// The certificates of external CAs are signed outside of the cluster and imported
+	if generator.getSigner(certificate).PrivateKey == nil {
+		if generator.needsExternalSigning(certificate) {
+			return fmt.Errorf("'%s' has to be signed externally, export the certificate signing requests with 'k8s-tew certificates export-csr'", generator.config.GetFullLocalAssetFilename(certificate.certificate))
+		}
+
+		return nil
+	}
+
+	if !force {
+		generator.checkKeyAlgorithm(certificate.name, generator.config.GetFullLocalAssetFilename(certificate.certificate), generator.getKeyOptions().Algorithm)
+
+		// Certificates issued before the etcd and front-proxy CAs existed have to be reissued by their CA
+		force = !generator.isSignedBy(generator.config.GetFullLocalAssetFilename(certificate.certificate), generator.getSigner(certificate))
+	}
+
+	if !force && !certificate.manual {
+		force = !generator.hasSANs(generator.config.GetFullLocalAssetFilename(certificate.certificate), certificate)
+	}
+
+	return pki.GenerateClient(generator.getSigner(certificate), generator.getKeyOptions(), generator.config.Config.ClientValidityPeriod, certificate.commonName, certificate.organization, certificate.dnsNames, certificate.ipAddresses, generator.config.GetFullLocalAssetFilename(certificate.certificate), generator.config.GetFullLocalAssetFilename(certificate.key), force)
+}
+
+func (generator *Generator) generateCertificates() error {
+	if error := pki.ValidateKeyAlgorithm(generator.config.Config.KeyAlgorithm); error != nil {
+		return error
+	}
+
+	if _, error := generator.config.GetKubernetesServiceIP(); error != nil {
+		return error
+	}
+
+	// Clusters generated before etcd had its own CA move to it in stages
+	if !utils.FileExists(generator.config.GetFullLocalAssetFilename(utils.PemEtcdCa)) && generator.hasEtcdManifests() {
+		if error := generator.config.SetEtcdCAMigrationStage(utils.CARotationLegacy); error != nil {
+			return error
+		}
+
+		log.Warn("Etcd keeps using the cluster CA, move it to its own CA with 'k8s-tew certificates rotate --etcd-ca'")
+	}
+
+	// Generate CAs if not done already
+	for _, authority := range getAuthorities() {
+		if generator.isExternal(authority) {
+			continue
+		}
+
+		generator.checkKeyAlgorithm(authority.name, generator.config.GetFullLocalAssetFilename(authority.certificate), generator.getKeyOptions().Algorithm)
+
+		if error := pki.GenerateCA(generator.getKeyOptions(), generator.config.Config.CAValidityPeriod, authority.commonName, "Kubernetes", generator.config.GetFullLocalAssetFilename(authority.certificate), generator.config.GetFullLocalAssetFilename(authority.key), false); error != nil {
+			return error
+		}
+	}
+
+	// Load ca certificates and private keys
+	if error := generator.loadCA(); error != nil {
+		return error
+	}
+
+	for _, certificate := range generator.getCertificates() {
+		if error := generator.generateCertificate(certificate, false); error != nil {
+			return error
+		}
+	}
+
+	return generator.generateEtcdCABundle()
+}
+
+// hasEtcdManifests returns true if the etcd manifest of a controller was generated already
+func (generator *Generator) hasEtcdManifests() bool {
+	for nodeName, node := range generator.config.Config.Nodes {
+		if !node.IsController() {
+			continue
+		}
+
+		generator.config.SetNode(nodeName, node)
+
+		if utils.FileExists(generator.config.GetFullLocalAssetFilename(utils.ManifestEtcd)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// generateEtcdCABundle writes the CAs trusted by etcd. While etcd moves to its own CA, the cluster CA is trusted too.
+func (generator *Generator) generateEtcdCABundle() error {
+	certificates, error := pki.LoadCertificates(generator.config.GetFullLocalAssetFilename(utils.PemEtcdCa))
+	if error != nil {
+		return error
+	}
+
+	if generator.config.IsEtcdCAMigrating() {
+		clusterCertificates, error := pki.LoadCertificates(generator.config.GetFullLocalAssetFilename(utils.PemCa))
+		if error != nil {
+			return error
+		}
+
+		certificates = mergeCertificates(certificates, clusterCertificates)
+	}
+
+	return pki.SaveCertificates(generator.config.GetFullLocalAssetFilename(utils.PemEtcdCaBundle), certificates)
+}
+
+// GetEtcdCAMigrationStage returns the stage the next call of MigrateEtcdCA moves to, or an empty string if etcd uses
+// its own CA already
+func (generator *Generator) GetEtcdCAMigrationStage() string {
+	switch generator.config.GetEtcdCAMigrationStage() {
+	case utils.CARotationLegacy:
+		return utils.CARotationTrust
+
+	case utils.CARotationTrust:
+		return utils.CARotationSwitch
+
+	case utils.CARotationSwitch:
+		return utils.CARotationFinish
+	}
+
+	return ""
+}
+
+// MigrateEtcdCA moves etcd one stage further from the cluster CA to its own CA and returns the stage reached. Like the
+// CA rotation, the stages have to be deployed one after the other: trust adds the etcd CA to the CAs trusted by etcd,
+// switch uses the certificates of the etcd CA and finish drops the cluster CA.
+func (generator *Generator) MigrateEtcdCA() (string, error) {
+	stage := generator.GetEtcdCAMigrationStage()
+
+	if len(stage) == 0 {
+		return "", fmt.Errorf("Etcd uses its own CA already")
+	}
+
+	if error := generator.config.SetEtcdCAMigrationStage(stage); error != nil {
+		return "", error
+	}
+
+	if error := generator.RegenerateCAFiles(); error != nil {
+		return "", error
+	}
+
+	log.WithFields(log.Fields{"stage": stage}).Info("Moved etcd CA")
+
+	return stage, nil
+}
+
+// RotateCertificates reissues the named leaf certificates, or all of them except the manual ones if no names are given, and regenerates the kubeconfigs
+func (generator *Generator) RotateCertificates(names []string) error {
+	selected := map[string]bool{}
+
+	for _, name := range names {
+		selected[name] = false
+	}
+
+	if error := generator.loadCA(); error != nil {
+		return error
+	}
+
+	for _, certificate := range generator.getCertificates() {
+		if _, ok := selected[certificate.name]; ok {
+			selected[certificate.name] = true
+
+		} else if len(names) > 0 || certificate.manual {
+			continue
+		}
+
+		if error := generator.generateCertificate(certificate, true); error != nil {
+			return error
+		}
+	}
+
+	for name, found := range selected {
+		if !found {
+			return fmt.Errorf("unknown certificate '%s'", name)
+		}
+	}
+
+	if error := generator.generateKubeConfigs(); error != nil {
+		return error
+	}
+
+	// Update the checksum of the manifests
+	return generator.generateManifestKubeApiserver()
+}
+
+// containsCertificate returns true if the certificate is part of the list
+func containsCertificate(certificates []*x509.Certificate, certificate *x509.Certificate) bool {
+	for _, _certificate := range certificates {
+		if _certificate.Equal(certificate) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// mergeCertificates appends the certificates of the second list that are not part of the first one
+func mergeCertificates(first, second []*x509.Certificate) []*x509.Certificate {
+	result := append([]*x509.Certificate{}, first...)
+
+	for _, certificate := range second {
+		if !containsCertificate(result, certificate) {
+			result = append(result, certificate)
+		}
+	}
+
+	return result
+}
+
+// excludeCertificates returns the certificates of the first list that are not part of the second one
+func excludeCertificates(first, second []*x509.Certificate) []*x509.Certificate {
+	result := []*x509.Certificate{}
+
+	for _, certificate := range first {
+		if !containsCertificate(second, certificate) {
+			result = append(result, certificate)
+		}
+	}
+
+	return result
+}
+
+// RegenerateCAFiles regenerates the files depending on the trusted CAs: the kubeconfigs, the CA bundle of etcd and the
+// manifests of etcd and the API servers
+func (generator *Generator) RegenerateCAFiles() error {
+	if error := generator.loadCA(); error != nil {
+		return error
+	}
+
+	if error := generator.generateKubeConfigs(); error != nil {
+		return error
+	}
+
+	if error := generator.generateEtcdCABundle(); error != nil {
+		return error
+	}
+
+	if error := generator.generateManifestEtcd(); error != nil {
+		return error
+	}
+
+	return generator.generateManifestKubeApiserver()
+}
+
+// getAuthorityCertificateNames returns the names of the certificates signed by the CA, except the manual ones
+func (generator *Generator) getAuthorityCertificateNames(authority *authority) []string {
+	result := []string{}
+
+	for _, certificate := range generator.getCertificates() {
+		signer := certificate.authority
+
+		if len(signer) == 0 {
+			signer = authorityKubernetes
+		}
+
+		if signer != authority.name || certificate.manual {
+			continue
+		}
+
+		result = append(result, certificate.name)
+	}
+
+	return result
+}
+
+// GetCARotationStage returns the stage the next call of RotateCA moves the named CA to. A next CA that is not trusted
+// yet was imported and starts the rotation.
+func (generator *Generator) GetCARotationStage(name string) (string, error) {
+	authority, error := getAuthority(name)
+	if error != nil {
+		return "", error
+	}
+
+	nextFilename := generator.config.GetFullLocalAssetFilename(authority.next)
+
+	if utils.FileExists(nextFilename) {
+		next, error := pki.LoadCertificates(nextFilename)
+		if error != nil {
+			return utils.CARotationSwitch, nil
+		}
+
+		certificates, error := pki.LoadCertificates(generator.config.GetFullLocalAssetFilename(authority.certificate))
+		if error != nil || containsCertificate(certificates, next[0]) {
+			return utils.CARotationSwitch, nil
+		}
+
+		return utils.CARotationTrust, nil
+	}
+
+	if utils.FileExists(generator.config.GetFullLocalAssetFilename(authority.previous)) {
+		return utils.CARotationFinish, nil
+	}
+
+	return utils.CARotationTrust, nil
+}
+
+// RotateCA moves the rotation of the named CA one stage further and returns the stage reached. The stages have to be
+// deployed one after the other, so that every component trusts the new CA before it is used and the old one until it is
+// not used anymore: trust adds a new CA to the trusted bundle, switch signs the certificates of the CA with the new CA and
+// finish drops the old CA. The new CA is generated unless one was imported with ImportCA. The issuers of both CAs are
+// kept in the bundle.
+func (generator *Generator) RotateCA(name string) (string, error) {
+	stage, error := generator.GetCARotationStage(name)
+	if error != nil {
+		return "", error
+	}
+
+	authority, _ := getAuthority(name)
+
+	if authority.name == authorityEtcd && len(generator.GetEtcdCAMigrationStage()) > 0 {
+		return "", fmt.Errorf("Etcd does not use its own CA yet, finish moving it with 'k8s-tew certificates rotate --etcd-ca' first")
+	}
+
+	caFilename := generator.config.GetFullLocalAssetFilename(authority.certificate)
+	caKeyFilename := generator.config.GetFullLocalAssetFilename(authority.key)
+	nextFilename := generator.config.GetFullLocalAssetFilename(authority.next)
+	nextKeyFilename := generator.config.GetFullLocalAssetFilename(authority.nextKey)
+	previousFilename := generator.config.GetFullLocalAssetFilename(authority.previous)
+
+	if generator.isExternal(authority) && !utils.FileExists(nextFilename) && stage == utils.CARotationTrust {
+		return "", fmt.Errorf("The private key of the CA is not available, import the new CA with 'k8s-tew certificates import-ca' first")
+	}
+
+	certificates, error := pki.LoadCertificates(caFilename)
+	if error != nil {
+		return "", error
+	}
+
+	switch stage {
+	case utils.CARotationTrust:
+		if !utils.FileExists(nextFilename) {
+			if error := pki.GenerateCA(generator.getKeyOptions(), generator.config.Config.CAValidityPeriod, authority.commonName, "Kubernetes", nextFilename, nextKeyFilename, true); error != nil {
+				return "", error
+			}
+		}
+
+		next, error := pki.LoadCertificates(nextFilename)
+		if error != nil {
+			return "", error
+		}
+
+		// The current CA stays first as it still signs the certificates
+		if error := pki.SaveCertificates(caFilename, mergeCertificates(certificates, next)); error != nil {
+			return "", error
+		}
+
+	case utils.CARotationSwitch:
+		next, error := pki.LoadCertificates(nextFilename)
+		if error != nil {
+			return "", error
+		}
+
+		previous := excludeCertificates(certificates, next)
+
+		// A switch that failed before is repeated, the new CA was already moved in place
+		if certificates[0].Equal(next[0]) {
+			if previous, error = pki.LoadCertificates(previousFilename); error != nil {
+				return "", error
+			}
+
+		} else if error := pki.SaveCertificates(previousFilename, previous); error != nil {
+			return "", error
+		}
+
+		if error := pki.SaveCertificates(caFilename, mergeCertificates(next, previous)); error != nil {
+			return "", error
+		}
+
+		// Without the private key of the imported CA, the certificates have to be signed externally
+		if utils.FileExists(nextKeyFilename) {
+			nextKey, error := ioutil.ReadFile(nextKeyFilename)
+			if error != nil {
+				return "", error
+			}
+
+			if error := ioutil.WriteFile(caKeyFilename, nextKey, 0600); error != nil {
+				return "", error
+			}
+
+		} else if utils.FileExists(caKeyFilename) {
+			if error := os.Remove(caKeyFilename); error != nil {
+				return "", error
+			}
+		}
+
+		// Sign the certificates of the CA with the new CA and regenerate the kubeconfigs
+		if error := generator.RotateCertificates(generator.getAuthorityCertificateNames(authority)); error != nil {
+			return "", error
+		}
+
+		// The next CA is kept until everything was reissued, so that a failed switch can be run again
+		for _, filename := range []string{nextFilename, nextKeyFilename} {
+			if !utils.FileExists(filename) {
+				continue
+			}
+
+			if error := os.Remove(filename); error != nil {
+				return "", error
+			}
+		}
+
+	case utils.CARotationFinish:
+		previous, error := pki.LoadCertificates(previousFilename)
+		if error != nil {
+			return "", error
+		}
+
+		if error := pki.SaveCertificates(caFilename, excludeCertificates(certificates, previous)); error != nil {
+			return "", error
+		}
+
+		if error := os.Remove(previousFilename); error != nil {
+			return "", error
+		}
+	}
+
+	log.WithFields(log.Fields{"name": authority.name, "stage": stage}).Info("Rotated CA")
+
+	if error := generator.RegenerateCAFiles(); error != nil {
+		return "", error
+	}
+
+	return stage, nil
+}
@@ -0,0 +1,181 @@
+package generate
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	"github.com/darxkies/k8s-tew/config"
+	"github.com/darxkies/k8s-tew/pki"
+	"github.com/darxkies/k8s-tew/utils"
+	log "github.com/sirupsen/logrus"
+	yaml "gopkg.in/yaml.v2"
+)
+
+type encryptionKey struct {
+	Name   string `yaml:"name"`
+	Secret string `yaml:"secret"`
+}
+
+type encryptionConfig struct {
+	Resources []struct {
+		Providers []struct {
+			AESCBC *struct {
+				Keys []encryptionKey `yaml:"keys"`
+			} `yaml:"aescbc"`
+		} `yaml:"providers"`
+	} `yaml:"resources"`
+}
+
+// getEncryptionKeyIndex returns the number of keys named key<N>
+func getEncryptionKeyIndex(key encryptionKey) int {
+	index, error := strconv.Atoi(strings.TrimPrefix(key.Name, "key"))
+	if error != nil {
+		return 0
+	}
+
+	return index
+}
+
+func newEncryptionKey(index int) (encryptionKey, error) {
+	secret, error := pki.GenerateEncryptionConfig()
+	if error != nil {
+		return encryptionKey{}, error
+	}
+
+	return encryptionKey{Name: fmt.Sprintf("key%d", index), Secret: secret}, nil
+}
+
+// loadEncryptionKeys returns the aescbc keys of the encryption config, the first one encrypts the secrets
+func (generator *Generator) loadEncryptionKeys() ([]encryptionKey, error) {
+	filename := generator.config.GetFullLocalAssetFilename(utils.EncryptionConfig)
+
+	content, error := ioutil.ReadFile(filename)
+	if error != nil {
+		return nil, error
+	}
+
+	encryption := encryptionConfig{}
+
+	if error := yaml.Unmarshal(content, &encryption); error != nil {
+		return nil, fmt.Errorf("Could not parse encryption config '%s' (%s)", filename, error.Error())
+	}
+
+	for _, resource := range encryption.Resources {
+		for _, provider := range resource.Providers {
+			if provider.AESCBC != nil && len(provider.AESCBC.Keys) > 0 {
+				return provider.AESCBC.Keys, nil
+			}
+		}
+	}
+
+	return nil, fmt.Errorf("No aescbc keys found in '%s'", filename)
+}
+
+func (generator *Generator) saveEncryptionKeys(keys []encryptionKey) error {
+	return utils.ApplyTemplateAndSave("encryption-config", utils.TemplateEncryptionConfig, struct {
+		Keys []encryptionKey
+		KMS  config.KMS
+	}{
+		Keys: keys,
+		KMS:  generator.config.Config.EncryptionKMS,
+	}, generator.config.GetFullLocalAssetFilename(utils.EncryptionConfig), true, false)
+}
+
+// generateEncryptionFile creates the encryption config with a first key. Existing keys are kept, only the KMS provider
+// is updated.
+func (generator *Generator) generateEncryptionFile() error {
+	if error := generator.config.Config.EncryptionKMS.Validate(); error != nil {
+		return error
+	}
+
+	keys := []encryptionKey{}
+
+	if utils.FileExists(generator.config.GetFullLocalAssetFilename(utils.EncryptionConfig)) {
+		var error error
+
+		keys, error = generator.loadEncryptionKeys()
+		if error != nil {
+			return error
+		}
+
+	} else {
+		key, error := newEncryptionKey(1)
+		if error != nil {
+			return error
+		}
+
+		keys = append(keys, key)
+	}
+
+	return generator.saveEncryptionKeys(keys)
+}
+
+// GetEncryptionRotationStage returns the stage the next call of RotateEncryptionKey moves to. The stage is derived from
+// the keys: a single key is rotated by adding a new one, an added key with a higher number than the first one is
+// promoted and a promoted key causes the old one to be dropped.
+func (generator *Generator) GetEncryptionRotationStage() (string, error) {
+	if generator.config.Config.EncryptionKMS.Enabled() {
+		return "", fmt.Errorf("The secrets are encrypted by the KMS plugin, rotate its key instead")
+	}
+
+	keys, error := generator.loadEncryptionKeys()
+	if error != nil {
+		return "", error
+	}
+
+	if len(keys) == 1 {
+		return utils.EncryptionRotationAdd, nil
+	}
+
+	if getEncryptionKeyIndex(keys[0]) < getEncryptionKeyIndex(keys[1]) {
+		return utils.EncryptionRotationPromote, nil
+	}
+
+	return utils.EncryptionRotationDrop, nil
+}
+
+// RotateEncryptionKey moves the key rotation one stage further and returns the stage reached. Each stage has to be
+// deployed to all API servers before the next one: add makes every API server able to read the new key, promote
+// encrypts with the new key and, once all secrets were rewritten, drop removes the old key.
+func (generator *Generator) RotateEncryptionKey() (string, error) {
+	stage, error := generator.GetEncryptionRotationStage()
+	if error != nil {
+		return "", error
+	}
+
+	keys, error := generator.loadEncryptionKeys()
+	if error != nil {
+		return "", error
+	}
+
+	switch stage {
+	case utils.EncryptionRotationAdd:
+		key, error := newEncryptionKey(getEncryptionKeyIndex(keys[0]) + 1)
+		if error != nil {
+			return "", error
+		}
+
+		keys = append(keys, key)
+
+	case utils.EncryptionRotationPromote:
+		keys = []encryptionKey{keys[1], keys[0]}
+
+	case utils.EncryptionRotationDrop:
+		keys = keys[:1]
+	}
+
+	if error := generator.saveEncryptionKeys(keys); error != nil {
+		return "", error
+	}
+
+	log.WithFields(log.Fields{"stage": stage, "primary": keys[0].Name}).Info("Rotated encryption key")
+
+	// Update the checksum of the manifests
+	if error := generator.generateManifestKubeApiserver(); error != nil {
+		return "", error
+	}
+
+	return stage, nil
+}
@@ -0,0 +1,152 @@
+package generate
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/darxkies/k8s-tew/pki"
+	"github.com/darxkies/k8s-tew/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+func getAuthority(name string) (*authority, error) {
+	for _, authority := range getAuthorities() {
+		if authority.name == name {
+			return authority, nil
+		}
+	}
+
+	return nil, fmt.Errorf("unknown CA '%s'", name)
+}
+
+// isExternal returns true if the CA was imported without its private key, its certificates are signed outside of the cluster
+func (generator *Generator) isExternal(authority *authority) bool {
+	return utils.FileExists(generator.config.GetFullLocalAssetFilename(authority.certificate)) && !utils.FileExists(generator.config.GetFullLocalAssetFilename(authority.key))
+}
+
+// needsExternalSigning returns true if the certificate is missing, was not issued by its CA or its SANs changed
+func (generator *Generator) needsExternalSigning(certificate *certificate) bool {
+	certificates, error := pki.LoadCertificates(generator.config.GetFullLocalAssetFilename(certificate.certificate))
+	if error != nil {
+		return true
+	}
+
+	if error := certificates[0].CheckSignatureFrom(generator.getSigner(certificate).Certificate); error != nil {
+		return true
+	}
+
+	return !certificate.manual && len(getSANProblems(certificates[0], certificate.dnsNames, certificate.ipAddresses)) > 0
+}
+
+func getCSRFilename(directory, certificateFilename string) string {
+	return path.Join(directory, strings.TrimSuffix(path.Base(certificateFilename), ".pem")+".csr")
+}
+
+// ImportCA replaces a CA with an existing one, for instance an intermediate CA of a corporate PKI. Without a private key
+// the certificates have to be signed externally. The certificates issued by the replaced CA are reissued by the next generate.
+// An existing CA is not replaced right away, the CA is imported as the next CA and RotateCA moves it in place.
+func (generator *Generator) ImportCA(name, certificateFilename, privateKeyFilename, chainFilename string) error {
+	authority, error := getAuthority(name)
+	if error != nil {
+		return error
+	}
+
+	caFilename := generator.config.GetFullLocalAssetFilename(authority.certificate)
+	caKeyFilename := generator.config.GetFullLocalAssetFilename(authority.key)
+
+	if utils.FileExists(caFilename) {
+		if authority.name == authorityEtcd && len(generator.GetEtcdCAMigrationStage()) > 0 {
+			return fmt.Errorf("Etcd does not use its own CA yet, finish moving it with 'k8s-tew certificates rotate --etcd-ca' first")
+		}
+
+		stage, error := generator.GetCARotationStage(authority.name)
+		if error != nil {
+			return error
+		}
+
+		if stage != utils.CARotationTrust {
+			return fmt.Errorf("A rotation of the CA is in progress, finish it first")
+		}
+
+		if error := pki.ImportCA(certificateFilename, privateKeyFilename, chainFilename, generator.config.GetFullLocalAssetFilename(authority.next), generator.config.GetFullLocalAssetFilename(authority.nextKey)); error != nil {
+			return error
+		}
+
+		log.WithFields(log.Fields{"name": authority.name}).Info("Imported the next CA, rotate to it with 'k8s-tew certificates rotate --ca=<name>'")
+
+		return nil
+	}
+
+	return pki.ImportCA(certificateFilename, privateKeyFilename, chainFilename, caFilename, caKeyFilename)
+}
+
+// ExportCertificateSigningRequests writes the signing requests of the certificates issued by external CAs to the directory.
+// Unless all is set, only the certificates that are missing, not issued by their CA or not matching the nodes are exported.
+// The private keys are generated if needed and stay in the base directory.
+func (generator *Generator) ExportCertificateSigningRequests(directory string, all bool) (int, error) {
+	if error := generator.loadCA(); error != nil {
+		return 0, error
+	}
+
+	count := 0
+
+	for _, certificate := range generator.getCertificates() {
+		if generator.getSigner(certificate).PrivateKey != nil {
+			continue
+		}
+
+		if len(certificate.node) > 0 {
+			generator.config.SetNode(certificate.node, generator.config.Config.Nodes[certificate.node])
+		}
+
+		if !all && !generator.needsExternalSigning(certificate) {
+			continue
+		}
+
+		if error := pki.GenerateCSR(generator.getKeyOptions(), certificate.commonName, certificate.organization, certificate.dnsNames, certificate.ipAddresses, generator.config.GetFullLocalAssetFilename(certificate.key), getCSRFilename(directory, generator.config.GetFullLocalAssetFilename(certificate.certificate))); error != nil {
+			return count, error
+		}
+
+		count++
+	}
+
+	return count, nil
+}
+
+// ImportCertificates stores the externally signed certificates found in the directory. The files are expected to have the
+// names of the certificate signing requests with the extension .pem.
+func (generator *Generator) ImportCertificates(directory string) (int, error) {
+	if error := generator.loadCA(); error != nil {
+		return 0, error
+	}
+
+	count := 0
+
+	for _, certificate := range generator.getCertificates() {
+		signer := generator.getSigner(certificate)
+
+		if signer.PrivateKey != nil {
+			continue
+		}
+
+		if len(certificate.node) > 0 {
+			generator.config.SetNode(certificate.node, generator.config.Config.Nodes[certificate.node])
+		}
+
+		certificateFilename := generator.config.GetFullLocalAssetFilename(certificate.certificate)
+		filename := path.Join(directory, path.Base(certificateFilename))
+
+		if !utils.FileExists(filename) {
+			continue
+		}
+
+		if error := pki.ImportCertificate(signer, filename, certificateFilename, generator.config.GetFullLocalAssetFilename(certificate.key)); error != nil {
+			return count, error
+		}
+
+		count++
+	}
+
+	return count, nil
+}
@@ -1,11 +1,14 @@
 package generate
 
 import (
+	"crypto/sha256"
 	"fmt"
+	"io/ioutil"
 	"path"
 	"strings"
 
 	"github.com/darxkies/k8s-tew/config"
+	"github.com/darxkies/k8s-tew/pkg/etcd"
 
 	"github.com/darxkies/k8s-tew/pki"
 	"github.com/darxkies/k8s-tew/utils"
@@ -15,6 +18,7 @@ import (
 type Generator struct {
 	config         *config.InternalConfig
 	ca             *pki.CertificateAndPrivateKey
+	cas            map[string]*pki.CertificateAndPrivateKey
 	generatorSteps []func() error
 }
 
@@ -46,10 +50,14 @@ func NewGenerator(config *config.InternalConfig) *Generator {
 		generator.generateContainerdConfig,
 		// Generate kubernetes security file
 		generator.generateEncryptionFile,
+		// Generate audit policy and webhook configuration
+		generator.generateAuditConfig,
 		// Generate kubeconfig files
 		generator.generateCertificates,
 		// Generate kubeconfig files
 		generator.generateKubeConfigs,
+		// Copy the CA of the OIDC provider
+		generator.generateOIDCCA,
 		// Generate Ceph Config
 		generator.generateCephConfig,
 		// Generate Ceph Config
@@ -233,27 +241,6 @@ func (generator *Generator) generateK8SHelmUserConfigFile() error {
 	}, generator.config.GetFullLocalAssetFilename(utils.K8sHelmUserSetup), true, false)
 }
 
-func (generator *Generator) generateEncryptionFile() error {
-	fullEncryptionConfigFilename := generator.config.GetFullLocalAssetFilename(utils.EncryptionConfig)
-
-	if utils.FileExists(fullEncryptionConfigFilename) {
-		utils.LogFilename("skipped", fullEncryptionConfigFilename)
-
-		return nil
-	}
-
-	encryptionKey, error := pki.GenerateEncryptionConfig()
-	if error != nil {
-		return error
-	}
-
-	return utils.ApplyTemplateAndSave("encryption-config", utils.TemplateEncryptionConfig, struct {
-		EncryptionKey string
-	}{
-		EncryptionKey: encryptionKey,
-	}, fullEncryptionConfigFilename, false, false)
-}
-
 func (generator *Generator) generateContainerdConfig() error {
 	for nodeName, node := range generator.config.Config.Nodes {
 		generator.config.SetNode(nodeName, node)
@@ -442,7 +429,66 @@ func (generator *Generator) generateManifestWorkerVirtualIP() error {
 	return nil
 }
 
+// loadEtcdMembers recovers missing members from the running etcd cluster, for instance after an upgrade from a version
+// that did not record them. Only if etcd is not reachable and the cluster was never generated nor deployed, the members
+// are seeded with the controllers, as they bootstrap etcd together. Otherwise controllers could bootstrap a second
+// cluster instead of joining the existing one.
+func (generator *Generator) loadEtcdMembers() (*config.EtcdMembers, error) {
+	filename := generator.config.GetFullLocalAssetFilename(utils.EtcdMembers)
+
+	members, error := config.LoadEtcdMembers(filename)
+	if error != nil {
+		return nil, error
+	}
+
+	if !members.Empty() {
+		return members, nil
+	}
+
+	endpoints := []string{}
+
+	for _, node := range generator.config.Config.Nodes {
+		if node.IsController() {
+			endpoints = append(endpoints, fmt.Sprintf("https://%s:%d", node.IP, utils.PortEtcdClient))
+		}
+	}
+
+	names, _, error := etcd.ListMembers(generator.config, endpoints)
+	if error == nil && len(names) > 0 {
+		for _, name := range names {
+			members.Add(name)
+		}
+
+		log.WithFields(log.Fields{"members": members.Names}).Info("Recovered etcd members")
+
+		return members, members.Save()
+	}
+
+	if generator.hasEtcdManifests() || utils.FileExists(generator.config.GetFullLocalAssetFilename(utils.DeploymentChecksums)) {
+		if error == nil {
+			return nil, fmt.Errorf("'%s' is missing and the cluster was already deployed, but etcd has no started members", filename)
+		}
+
+		return nil, fmt.Errorf("'%s' is missing and the cluster was already deployed, restore the file or make etcd reachable (%s)", filename, error.Error())
+	}
+
+	log.WithFields(log.Fields{"error": error}).Debug("Etcd not reachable")
+
+	for nodeName, node := range generator.config.Config.Nodes {
+		if node.IsController() {
+			members.Add(nodeName)
+		}
+	}
+
+	return members, members.Save()
+}
+
 func (generator *Generator) generateManifestEtcd() error {
+	members, error := generator.loadEtcdMembers()
+	if error != nil {
+		return error
+	}
+
 	for nodeName, node := range generator.config.Config.Nodes {
 		generator.config.SetNode(nodeName, node)
 
@@ -450,24 +496,38 @@ func (generator *Generator) generateManifestEtcd() error {
 			continue
 		}
 
+		initialCluster, initialClusterState := generator.config.GetEtcdInitialCluster(nodeName, members)
+		server, serverKey, peer, peerKey := generator.config.GetEtcdServerCertificates()
+		client, clientKey := generator.config.GetEtcdClientCertificate()
+
 		if error := utils.ApplyTemplateAndSave("manifest-etcd", utils.TemplateManifestEtcd, struct {
 			EtcdImage         string
 			Name              string
-			PemCA             string
-			PemKubernetes     string
-			PemKubernetesKey  string
+			PemEtcdCA         string
+			PemEtcdServer     string
+			PemEtcdServerKey  string
+			PemEtcdPeer       string
+			PemEtcdPeerKey    string
+			PemEtcdClient     string
+			PemEtcdClientKey  string
 			NodeIP            string
 			EtcdDataDirectory string
 			EtcdCluster       string
+			EtcdClusterState  string
 		}{
 			EtcdImage:         generator.config.Config.Versions.Etcd,
 			Name:              nodeName,
-			PemCA:             generator.config.GetFullTargetAssetFilename(utils.PemCa),
-			PemKubernetes:     generator.config.GetFullTargetAssetFilename(utils.PemKubernetes),
-			PemKubernetesKey:  generator.config.GetFullTargetAssetFilename(utils.PemKubernetesKey),
+			PemEtcdCA:         generator.config.GetFullTargetAssetFilename(generator.config.GetEtcdTrustedCA()),
+			PemEtcdServer:     generator.config.GetFullTargetAssetFilename(server),
+			PemEtcdServerKey:  generator.config.GetFullTargetAssetFilename(serverKey),
+			PemEtcdPeer:       generator.config.GetFullTargetAssetFilename(peer),
+			PemEtcdPeerKey:    generator.config.GetFullTargetAssetFilename(peerKey),
+			PemEtcdClient:     generator.config.GetFullTargetAssetFilename(client),
+			PemEtcdClientKey:  generator.config.GetFullTargetAssetFilename(clientKey),
 			NodeIP:            node.IP,
 			EtcdDataDirectory: generator.config.GetFullTargetAssetDirectory(utils.DirectoryEtcdData),
-			EtcdCluster:       generator.config.GetEtcdCluster(),
+			EtcdCluster:       initialCluster,
+			EtcdClusterState:  initialClusterState,
 		}, generator.config.GetFullLocalAssetFilename(utils.ManifestEtcd), true, false); error != nil {
 			return error
 		}
@@ -484,33 +544,71 @@ func (generator *Generator) generateManifestKubeApiserver() error {
 			continue
 		}
 
+		checksum, error := generator.getAssetChecksum(utils.PemKubernetes, utils.EncryptionConfig, utils.AuditPolicy, utils.AuditWebhookConfig)
+		if error != nil {
+			return error
+		}
+
+		auditLog := generator.getAuditLog()
+		etcdClient, etcdClientKey := generator.config.GetEtcdClientCertificate()
+
+		kmsDirectory := ""
+
+		if generator.config.Config.EncryptionKMS.Enabled() {
+			kmsDirectory = path.Dir(generator.config.Config.EncryptionKMS.GetSocket())
+		}
+
 		if error := utils.ApplyTemplateAndSave("manifest-kube-apiserver", utils.TemplateManifestKubeApiserver, struct {
 			KubernetesImage   string
 			ControllersCount  string
 			AuditLog          string
+			AuditLogDirectory string
+			AuditPolicy       string
+			AuditWebhook      string
+			Checksum          string
+			Audit             config.Audit
 			EtcdServers       string
 			PemCA             string
 			PemKubernetes     string
 			PemKubernetesKey  string
 			PemAggregator     string
 			PemAggregatorKey  string
+			PemFrontProxyCA   string
+			PemEtcdCA         string
+			PemEtcdClient     string
+			PemEtcdClientKey  string
 			PemServiceAccount string
+			PemOIDCCA         string
+			OIDC              config.OIDC
 			EncryptionConfig  string
+			KMSDirectory      string
 			NodeIP            string
 			APIServerPort     uint16
 			ClusterIPRange    string
 		}{
 			KubernetesImage:   generator.config.Config.Versions.K8S,
 			ControllersCount:  generator.config.GetControllersCount(),
-			AuditLog:          path.Join(generator.config.GetFullTargetAssetDirectory(utils.DirectoryLogging), utils.AuditLog),
+			AuditLog:          auditLog,
+			AuditLogDirectory: path.Dir(auditLog),
+			AuditPolicy:       generator.config.GetFullTargetAssetFilename(utils.AuditPolicy),
+			AuditWebhook:      generator.getAuditWebhook(),
+			Checksum:          checksum,
+			Audit:             generator.config.Config.Audit,
 			EtcdServers:       generator.config.GetEtcdServers(),
 			PemCA:             generator.config.GetFullTargetAssetFilename(utils.PemCa),
 			PemKubernetes:     generator.config.GetFullTargetAssetFilename(utils.PemKubernetes),
 			PemKubernetesKey:  generator.config.GetFullTargetAssetFilename(utils.PemKubernetesKey),
 			PemAggregator:     generator.config.GetFullTargetAssetFilename(utils.PemAggregator),
 			PemAggregatorKey:  generator.config.GetFullTargetAssetFilename(utils.PemAggregatorKey),
+			PemFrontProxyCA:   generator.config.GetFullTargetAssetFilename(utils.PemFrontProxyCa),
+			PemEtcdCA:         generator.config.GetFullTargetAssetFilename(generator.config.GetEtcdTrustedCA()),
+			PemEtcdClient:     generator.config.GetFullTargetAssetFilename(etcdClient),
+			PemEtcdClientKey:  generator.config.GetFullTargetAssetFilename(etcdClientKey),
 			PemServiceAccount: generator.config.GetFullTargetAssetFilename(utils.PemServiceAccount),
+			PemOIDCCA:         generator.getOIDCCA(),
+			OIDC:              generator.config.Config.OIDC,
 			EncryptionConfig:  generator.config.GetFullTargetAssetFilename(utils.EncryptionConfig),
+			KMSDirectory:      kmsDirectory,
 			NodeIP:            node.IP,
 			APIServerPort:     generator.config.Config.APIServerPort,
 			ClusterIPRange:    generator.config.Config.ClusterIPRange,
@@ -530,12 +628,20 @@ func (generator *Generator) generateManifestKubeControllerManager() error {
 			continue
 		}
 
+		// Without the key of the CA, the controller manager cannot sign certificates
+		pemCAKey := ""
+
+		if utils.FileExists(generator.config.GetFullLocalAssetFilename(utils.PemCaKey)) {
+			pemCAKey = generator.config.GetFullTargetAssetFilename(utils.PemCaKey)
+		}
+
 		if error := utils.ApplyTemplateAndSave("manifest-kube-controller-manager", utils.TemplateManifestKubeControllerManager, struct {
 			KubernetesImage      string
 			ClusterCIDR          string
 			ClusterIPRange       string
 			PemCA                string
 			PemCAKey             string
+			PemFrontProxyCA      string
 			Kubeconfig           string
 			PemKubernetes        string
 			PemKubernetesKey     string
@@ -545,7 +651,8 @@ func (generator *Generator) generateManifestKubeControllerManager() error {
 			ClusterCIDR:          generator.config.Config.ClusterCIDR,
 			ClusterIPRange:       generator.config.Config.ClusterIPRange,
 			PemCA:                generator.config.GetFullTargetAssetFilename(utils.PemCa),
-			PemCAKey:             generator.config.GetFullTargetAssetFilename(utils.PemCaKey),
+			PemCAKey:             pemCAKey,
+			PemFrontProxyCA:      generator.config.GetFullTargetAssetFilename(utils.PemFrontProxyCa),
 			Kubeconfig:           generator.config.GetFullTargetAssetFilename(utils.KubeconfigControllerManager),
 			PemKubernetes:        generator.config.GetFullTargetAssetFilename(utils.PemKubernetes),
 			PemKubernetesKey:     generator.config.GetFullTargetAssetFilename(utils.PemKubernetesKey),
@@ -602,82 +709,6 @@ func (generator *Generator) generateManifestKubeProxy() error {
 	return nil
 }
 
-func (generator *Generator) generateCertificates() error {
-	var error error
-
-	fullCAFilename := generator.config.GetFullLocalAssetFilename(utils.PemCa)
-	fullCAKeyFilename := generator.config.GetFullLocalAssetFilename(utils.PemCaKey)
-
-	// Generate CA if not done already
-	if error := pki.GenerateCA(generator.config.Config.RSASize, generator.config.Config.CAValidityPeriod, "Kubernetes", "Kubernetes", fullCAFilename, fullCAKeyFilename); error != nil {
-		return error
-	}
-
-	// Load ca certificate and private key
-	generator.ca, error = pki.LoadCertificateAndPrivateKey(fullCAFilename, fullCAKeyFilename)
-	if error != nil {
-		return error
-	}
-
-	// Collect dns names and ip addresses
-	kubernetesDNSNames := []string{"kubernetes", "kubenetes.default", "kubenetes.default.svc", "kubenetes.default.svc.cluster.local", "localhost"}
-	kubernetesIPAddresses := []string{"127.0.0.1", "10.32.0.1"}
-
-	if len(generator.config.Config.ControllerVirtualIP) > 0 {
-		kubernetesIPAddresses = append(kubernetesIPAddresses, generator.config.Config.ControllerVirtualIP)
-	}
-
-	for nodeName, node := range generator.config.Config.Nodes {
-		kubernetesDNSNames = append(kubernetesDNSNames, nodeName)
-		kubernetesIPAddresses = append(kubernetesIPAddresses, node.IP)
-	}
-
-	// Generate admin certificate
-	if error := pki.GenerateClient(generator.ca, generator.config.Config.RSASize, generator.config.Config.ClientValidityPeriod, utils.CnAdmin, "system:masters", []string{}, []string{}, generator.config.GetFullLocalAssetFilename(utils.PemAdmin), generator.config.GetFullLocalAssetFilename(utils.PemAdminKey), false); error != nil {
-		return error
-	}
-
-	// Generate kuberentes certificate
-	if error := pki.GenerateClient(generator.ca, generator.config.Config.RSASize, generator.config.Config.ClientValidityPeriod, "kubernetes", "Kubernetes", kubernetesDNSNames, kubernetesIPAddresses, generator.config.GetFullLocalAssetFilename(utils.PemKubernetes), generator.config.GetFullLocalAssetFilename(utils.PemKubernetesKey), true); error != nil {
-		return error
-	}
-
-	// Generate aggregator certificate
-	if error := pki.GenerateClient(generator.ca, generator.config.Config.RSASize, generator.config.Config.ClientValidityPeriod, utils.CnAggregator, "Kubernetes", kubernetesDNSNames, kubernetesIPAddresses, generator.config.GetFullLocalAssetFilename(utils.PemAggregator), generator.config.GetFullLocalAssetFilename(utils.PemAggregatorKey), true); error != nil {
-		return error
-	}
-
-	// Generate service accounts certificate
-	if error := pki.GenerateClient(generator.ca, generator.config.Config.RSASize, generator.config.Config.ClientValidityPeriod, "service-accounts", "Kubernetes", kubernetesDNSNames, kubernetesIPAddresses, generator.config.GetFullLocalAssetFilename(utils.PemServiceAccount), generator.config.GetFullLocalAssetFilename(utils.PemServiceAccountKey), false); error != nil {
-		return error
-	}
-
-	// Generate controller manager certificate
-	if error := pki.GenerateClient(generator.ca, generator.config.Config.RSASize, generator.config.Config.ClientValidityPeriod, utils.CnSystemKubeControllerManager, "system:node-controller-manager", []string{}, []string{}, generator.config.GetFullLocalAssetFilename(utils.PemControllerManager), generator.config.GetFullLocalAssetFilename(utils.PemControllerManagerKey), false); error != nil {
-		return error
-	}
-
-	// Generate scheduler certificate
-	if error := pki.GenerateClient(generator.ca, generator.config.Config.RSASize, generator.config.Config.ClientValidityPeriod, utils.CnSystemKubeScheduler, "system:kube-scheduler", []string{}, []string{}, generator.config.GetFullLocalAssetFilename(utils.PemScheduler), generator.config.GetFullLocalAssetFilename(utils.PemSchedulerKey), false); error != nil {
-		return error
-	}
-
-	// Generate proxy certificate
-	if error := pki.GenerateClient(generator.ca, generator.config.Config.RSASize, generator.config.Config.ClientValidityPeriod, utils.CnSystemKubeProxy, "system:node-proxier", []string{}, []string{}, generator.config.GetFullLocalAssetFilename(utils.PemProxy), generator.config.GetFullLocalAssetFilename(utils.PemProxyKey), false); error != nil {
-		return error
-	}
-
-	for nodeName, node := range generator.config.Config.Nodes {
-		generator.config.SetNode(nodeName, node)
-
-		if error := pki.GenerateClient(generator.ca, generator.config.Config.RSASize, generator.config.Config.ClientValidityPeriod, fmt.Sprintf(utils.CnSystemNodePrefix, nodeName), "system:nodes", []string{nodeName}, []string{node.IP}, generator.config.GetFullLocalAssetFilename(utils.PemKubelet), generator.config.GetFullLocalAssetFilename(utils.PemKubeletKey), false); error != nil {
-			return error
-		}
-	}
-
-	return nil
-}
-
 func (generator *Generator) generateConfigKubeConfig(kubeConfigFilename, caFilename, user, apiServers, certificateFilename, keyFilename string, force bool) error {
 	if utils.FileExists(kubeConfigFilename) && !force {
 		utils.LogFilename("skipped", kubeConfigFilename)
@@ -720,13 +751,44 @@ func (generator *Generator) generateConfigKubeConfig(kubeConfigFilename, caFilen
 	}, kubeConfigFilename, true, false)
 }
 
-func (generator *Generator) generateKubeConfigs() error {
+// getAPIServer returns the address of the load balancer in front of the API servers
+func (generator *Generator) getAPIServer() (string, error) {
 	apiServer, error := generator.config.GetAPIServerIP()
 	if error != nil {
-		return error
+		return "", error
 	}
 
-	apiServer = fmt.Sprintf("%s:%d", apiServer, generator.config.Config.LoadBalancerPort)
+	return fmt.Sprintf("%s:%d", apiServer, generator.config.Config.LoadBalancerPort), nil
+}
+
+// getAssetChecksum returns the checksum of the local assets. The API servers do not reload their certificates and
+// configuration files, the checksum is added to their manifests so that they are restarted when the files change.
+func (generator *Generator) getAssetChecksum(names ...string) (string, error) {
+	hash := sha256.New()
+
+	for _, name := range names {
+		filename := generator.config.GetFullLocalAssetFilename(name)
+
+		if !utils.FileExists(filename) {
+			continue
+		}
+
+		content, error := ioutil.ReadFile(filename)
+		if error != nil {
+			return "", error
+		}
+
+		hash.Write(content)
+	}
+
+	return fmt.Sprintf("%x", hash.Sum(nil)), nil
+}
+
+func (generator *Generator) generateKubeConfigs() error {
+	apiServer, error := generator.getAPIServer()
+	if error != nil {
+		return error
+	}
 
 	if error := generator.generateConfigKubeConfig(generator.config.GetFullLocalAssetFilename(utils.KubeconfigAdmin), generator.ca.CertificateFilename, "admin", apiServer, generator.config.GetFullLocalAssetFilename(utils.PemAdmin), generator.config.GetFullLocalAssetFilename(utils.PemAdminKey), true); error != nil {
 		return error
@@ -976,12 +1038,16 @@ func (generator *Generator) generateVeleroSetup() error {
 		MinioClientImage string
 		PodsDirectory    string
 		MinioPort        uint16
+		MinioAccessKey   string
+		MinioSecretKey   string
 	}{
 		VeleroImage:      generator.config.Config.Versions.Velero,
 		MinioServerImage: generator.config.Config.Versions.MinioServer,
 		MinioClientImage: generator.config.Config.Versions.MinioClient,
 		PodsDirectory:    generator.config.GetFullTargetAssetDirectory(utils.DirectoryPodsData),
 		MinioPort:        utils.PortMinio,
+		MinioAccessKey:   generator.config.Config.MinioAccessKey,
+		MinioSecretKey:   generator.config.Config.MinioSecretKey,
 	}, generator.config.GetFullLocalAssetFilename(utils.K8sVeleroSetup), true, false)
 }
 
@@ -0,0 +1,101 @@
+package generate
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/darxkies/k8s-tew/pki"
+	"github.com/darxkies/k8s-tew/utils"
+)
+
+// generateOIDCCA copies the CA of the OIDC provider to the certificates, so that it is deployed to the controllers
+func (generator *Generator) generateOIDCCA() error {
+	oidc := generator.config.Config.OIDC
+
+	if error := oidc.Validate(); error != nil {
+		return error
+	}
+
+	filename := generator.config.GetFullLocalAssetFilename(utils.PemOIDCCa)
+
+	if !oidc.Enabled() || len(oidc.CAFile) == 0 {
+		if error := os.Remove(filename); error != nil && !os.IsNotExist(error) {
+			return error
+		}
+
+		return nil
+	}
+
+	certificates, error := pki.LoadCertificates(oidc.CAFile)
+	if error != nil {
+		return error
+	}
+
+	return pki.SaveCertificates(filename, certificates)
+}
+
+// getOIDCCA returns the target filename of the CA of the OIDC provider, or an empty string if there is none
+func (generator *Generator) getOIDCCA() string {
+	if !generator.config.Config.OIDC.Enabled() || len(generator.config.Config.OIDC.CAFile) == 0 {
+		return ""
+	}
+
+	return generator.config.GetFullTargetAssetFilename(utils.PemOIDCCa)
+}
+
+// GenerateOIDCKubeconfig writes a kubeconfig using the oidc auth provider. The tokens are optional, kubectl plugins
+// or login helpers can fill them in later.
+func (generator *Generator) GenerateOIDCKubeconfig(filename, name, clientSecret, idToken, refreshToken, extraScopes string) error {
+	oidc := generator.config.Config.OIDC
+
+	if !oidc.Enabled() {
+		return fmt.Errorf("OIDC is not configured, set it with 'k8s-tew configure --oidc-issuer-url'")
+	}
+
+	if error := oidc.Validate(); error != nil {
+		return error
+	}
+
+	apiServer, error := generator.getAPIServer()
+	if error != nil {
+		return error
+	}
+
+	base64CA, error := utils.GetBase64OfPEM(generator.config.GetFullLocalAssetFilename(utils.PemCa))
+	if error != nil {
+		return error
+	}
+
+	base64IDPCA := ""
+
+	if len(oidc.CAFile) > 0 {
+		base64IDPCA, error = utils.GetBase64OfPEM(oidc.CAFile)
+		if error != nil {
+			return error
+		}
+	}
+
+	return utils.ApplyTemplateAndSave("kubeconfig-oidc", utils.TemplateKubeconfigOIDC, struct {
+		Name         string
+		APIServer    string
+		CAData       string
+		IssuerURL    string
+		ClientID     string
+		ClientSecret string
+		IDPCAData    string
+		IDToken      string
+		RefreshToken string
+		ExtraScopes  string
+	}{
+		Name:         name,
+		APIServer:    apiServer,
+		CAData:       base64CA,
+		IssuerURL:    oidc.IssuerURL,
+		ClientID:     oidc.ClientID,
+		ClientSecret: clientSecret,
+		IDPCAData:    base64IDPCA,
+		IDToken:      idToken,
+		RefreshToken: refreshToken,
+		ExtraScopes:  extraScopes,
+	}, filename, true, false)
+}
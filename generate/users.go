@@ -0,0 +1,129 @@
+package generate
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"time"
+
+	"github.com/darxkies/k8s-tew/config"
+	"github.com/darxkies/k8s-tew/pki"
+	"github.com/darxkies/k8s-tew/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+// The user name is used in the names and labels of the role bindings
+var userNamePattern = regexp.MustCompile(`^[a-z0-9]([-a-z0-9.]{0,61}[a-z0-9])?$`)
+
+// GetUserFilenames returns the certificate, the private key and the kubeconfig of the user
+func (generator *Generator) GetUserFilenames(name string) (string, string, string) {
+	directory := generator.config.GetFullLocalAssetDirectory(utils.DirectoryUsers)
+
+	return path.Join(directory, name+".pem"), path.Join(directory, name+"-key.pem"), path.Join(directory, name+".kubeconfig")
+}
+
+// AddUser issues a client certificate for the user, valid for the given duration, writes a kubeconfig using the load
+// balancer and records the user. Issuing a certificate for an existing user replaces the recorded entry. The name of a
+// revoked user is only reused with force while its old certificate is valid, as the role bindings would apply to it too.
+func (generator *Generator) AddUser(name string, groups []string, validity time.Duration, bindings []config.UserBinding, force bool) (*config.User, error) {
+	if !userNamePattern.MatchString(name) {
+		return nil, fmt.Errorf("invalid user name '%s', only lower case alphanumeric characters, '-' and '.' are allowed", name)
+	}
+
+	for _, group := range groups {
+		if group == "system:masters" {
+			log.WithFields(log.Fields{"user": name, "group": group}).Warn("The permissions of the group cannot be revoked before the certificate expires")
+		}
+	}
+
+	users, error := config.LoadUsers(generator.config.GetFullLocalAssetFilename(utils.Users))
+	if error != nil {
+		return nil, error
+	}
+
+	if revoked := users.Get(name); revoked != nil && revoked.RevokedAt != nil && time.Now().Before(revoked.ExpiresAt) {
+		if !force {
+			return nil, fmt.Errorf("user '%s' was revoked and its certificate is valid until %s, the role bindings would grant it access again", name, revoked.ExpiresAt.Format(time.RFC3339))
+		}
+
+		log.WithFields(log.Fields{"user": name, "serial": revoked.Serial, "expires-at": revoked.ExpiresAt}).Warn("The role bindings also apply to the revoked certificate until it expires")
+	}
+
+	if error := generator.loadCA(); error != nil {
+		return nil, error
+	}
+
+	apiServer, error := generator.getAPIServer()
+	if error != nil {
+		return nil, error
+	}
+
+	if error := utils.CreateDirectoryIfMissing(generator.config.GetFullLocalAssetDirectory(utils.DirectoryUsers)); error != nil {
+		return nil, error
+	}
+
+	certificateFilename, keyFilename, kubeconfigFilename := generator.GetUserFilenames(name)
+
+	if error := pki.GenerateUser(generator.ca, generator.getKeyOptions(), validity, name, groups, certificateFilename, keyFilename); error != nil {
+		return nil, error
+	}
+
+	certificates, error := pki.LoadCertificates(certificateFilename)
+	if error != nil {
+		return nil, error
+	}
+
+	if error := generator.generateConfigKubeConfig(kubeconfigFilename, generator.ca.CertificateFilename, name, apiServer, certificateFilename, keyFilename, true); error != nil {
+		return nil, error
+	}
+
+	user := &config.User{
+		Name:      name,
+		Groups:    groups,
+		Serial:    fmt.Sprintf("%x", certificates[0].SerialNumber),
+		IssuedAt:  time.Now().UTC().Truncate(time.Second),
+		ExpiresAt: certificates[0].NotAfter.UTC(),
+		Bindings:  bindings,
+	}
+
+	users.Set(user)
+
+	if error := users.Save(); error != nil {
+		return nil, error
+	}
+
+	return user, nil
+}
+
+// RevokeUser marks the user as revoked and removes its files. Kubernetes does not check revoked client certificates,
+// the certificate remains valid until it expires.
+func (generator *Generator) RevokeUser(name string) (*config.User, error) {
+	users, error := config.LoadUsers(generator.config.GetFullLocalAssetFilename(utils.Users))
+	if error != nil {
+		return nil, error
+	}
+
+	user := users.Get(name)
+	if user == nil {
+		return nil, fmt.Errorf("unknown user '%s'", name)
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+
+	user.RevokedAt = &now
+
+	certificateFilename, keyFilename, kubeconfigFilename := generator.GetUserFilenames(name)
+
+	for _, filename := range []string{certificateFilename, keyFilename, kubeconfigFilename} {
+		if error := os.Remove(filename); error != nil && !os.IsNotExist(error) {
+			return nil, error
+		}
+	}
+
+	if error := users.Save(); error != nil {
+		return nil, error
+	}
+
+	return user, nil
+}
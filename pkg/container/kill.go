@@ -309,19 +309,33 @@ func Unmount(path string) error {
 	return nil
 }
 
-func KillContainers(_config *config.InternalConfig) {
-	containerdShimBinary := _config.GetFullLocalAssetFilename(utils.BinaryContainerdShim)
-
-	workdirPrefix := _config.GetFullLocalAssetDirectory(utils.DirectoryDynamicData)
-	mountPrefixes := []string{
-		workdirPrefix,
+func getMountPrefixes(_config *config.InternalConfig) []string {
+	return []string{
+		_config.GetFullLocalAssetDirectory(utils.DirectoryDynamicData),
 		_config.GetFullLocalAssetDirectory(utils.DirectoryRun),
 		_config.GetFullLocalAssetDirectory(utils.DirectoryVarRun),
 		_config.GetFullLocalAssetDirectory(utils.DirectoryKubeletData),
 	}
+}
+
+// GetMountPoints returns the paths mounted below the directories used by the containers
+func GetMountPoints(_config *config.InternalConfig) []string {
+	result := []string{}
+
+	for _, mount := range *getMounts(getMountPrefixes(_config)) {
+		result = append(result, mount.Destination)
+	}
+
+	return result
+}
+
+func KillContainers(_config *config.InternalConfig) {
+	containerdShimBinary := _config.GetFullLocalAssetFilename(utils.BinaryContainerdShim)
+
+	workdirPrefix := _config.GetFullLocalAssetDirectory(utils.DirectoryDynamicData)
 
 	processParentMap := getProcessParentMap()
-	mounts := getMounts(mountPrefixes)
+	mounts := getMounts(getMountPrefixes(_config))
 	pvPaths := mounts.getPV()
 	containers := getContainerdShim(containerdShimBinary, workdirPrefix, pvPaths, processParentMap)
 
@@ -0,0 +1,326 @@
+package etcd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"time"
+
+	"github.com/coreos/etcd/clientv3"
+	"github.com/coreos/etcd/etcdserver/etcdserverpb"
+	"github.com/coreos/etcd/pkg/transport"
+	"github.com/darxkies/k8s-tew/config"
+	"github.com/darxkies/k8s-tew/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+const dialTimeout = 5 * time.Second
+const requestTimeout = 10 * time.Second
+const snapshotTimeout = 5 * time.Minute
+
+// NewClient connects to the etcd endpoints using the certificates generated for the cluster
+func NewClient(_config *config.InternalConfig, endpoints []string) (*clientv3.Client, error) {
+	certificate, key := _config.GetEtcdClientCertificate()
+
+	tlsInfo := transport.TLSInfo{
+		CertFile:      _config.GetFullLocalAssetFilename(certificate),
+		KeyFile:       _config.GetFullLocalAssetFilename(key),
+		TrustedCAFile: _config.GetFullLocalAssetFilename(_config.GetEtcdTrustedCA()),
+	}
+
+	tlsConfig, error := tlsInfo.ClientConfig()
+	if error != nil {
+		return nil, error
+	}
+
+	return clientv3.New(clientv3.Config{Endpoints: endpoints, DialTimeout: dialTimeout, TLS: tlsConfig})
+}
+
+func getQuorum(members int) int {
+	return members/2 + 1
+}
+
+// countHealthyMembers counts the started members that answer a status request, except the one with the excluded id
+func countHealthyMembers(client *clientv3.Client, members []*etcdserverpb.Member, excluded uint64) int {
+	result := 0
+
+	for _, member := range members {
+		if member.ID == excluded || len(member.ClientURLs) == 0 {
+			continue
+		}
+
+		_context, cancel := context.WithTimeout(context.Background(), requestTimeout)
+
+		if _, error := client.Status(_context, member.ClientURLs[0]); error == nil {
+			result++
+		}
+
+		cancel()
+	}
+
+	return result
+}
+
+// AddMember announces a new member with the given peer url to the cluster. It has to be called before the etcd of the new member starts.
+func AddMember(_config *config.InternalConfig, endpoints []string, name, peerURL string) error {
+	client, error := NewClient(_config, endpoints)
+	if error != nil {
+		return error
+	}
+
+	defer client.Close()
+
+	_context, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+
+	members, error := client.MemberList(_context)
+	if error != nil {
+		return fmt.Errorf("Could not list etcd members (%s)", error.Error())
+	}
+
+	for _, member := range members.Members {
+		for _, _peerURL := range member.PeerURLs {
+			if _peerURL == peerURL {
+				log.WithFields(log.Fields{"name": name, "id": fmt.Sprintf("%x", member.ID)}).Info("Etcd member already added")
+
+				return nil
+			}
+		}
+	}
+
+	// The new member counts towards the quorum as soon as it is added, but it is not started yet
+	healthy := countHealthyMembers(client, members.Members, 0)
+
+	if healthy < getQuorum(len(members.Members)+1) {
+		return fmt.Errorf("Adding etcd member '%s' would leave the cluster without quorum (%d of %d members healthy)", name, healthy, len(members.Members))
+	}
+
+	response, error := client.MemberAdd(_context, []string{peerURL})
+	if error != nil {
+		return fmt.Errorf("Could not add etcd member '%s' (%s)", name, error.Error())
+	}
+
+	log.WithFields(log.Fields{"name": name, "id": fmt.Sprintf("%x", response.Member.ID)}).Info("Added etcd member")
+
+	return nil
+}
+
+// ListMembers returns the names of the started members and the peer urls of the members that were added but not started yet
+func ListMembers(_config *config.InternalConfig, endpoints []string) (names []string, unstarted []string, _error error) {
+	client, _error := NewClient(_config, endpoints)
+	if _error != nil {
+		return
+	}
+
+	defer client.Close()
+
+	_context, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+
+	members, _error := client.MemberList(_context)
+	if _error != nil {
+		return nil, nil, fmt.Errorf("Could not list etcd members (%s)", _error.Error())
+	}
+
+	for _, member := range members.Members {
+		if len(member.Name) == 0 {
+			unstarted = append(unstarted, member.PeerURLs...)
+
+			continue
+		}
+
+		names = append(names, member.Name)
+	}
+
+	return
+}
+
+// RemoveMember removes the member with the given name from the cluster if the remaining members keep the quorum. The endpoints should not include the member itself.
+func RemoveMember(_config *config.InternalConfig, endpoints []string, name string) error {
+	client, error := NewClient(_config, endpoints)
+	if error != nil {
+		return error
+	}
+
+	defer client.Close()
+
+	_context, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+
+	members, error := client.MemberList(_context)
+	if error != nil {
+		return fmt.Errorf("Could not list etcd members (%s)", error.Error())
+	}
+
+	for _, member := range members.Members {
+		if member.Name != name {
+			continue
+		}
+
+		healthy := countHealthyMembers(client, members.Members, member.ID)
+		remaining := len(members.Members) - 1
+
+		if remaining > 0 && healthy < getQuorum(remaining) {
+			return fmt.Errorf("Removing etcd member '%s' would leave the cluster without quorum (%d of %d remaining members healthy)", name, healthy, remaining)
+		}
+
+		if _, error := client.MemberRemove(_context, member.ID); error != nil {
+			return fmt.Errorf("Could not remove etcd member '%s' (%s)", name, error.Error())
+		}
+
+		log.WithFields(log.Fields{"name": name, "id": fmt.Sprintf("%x", member.ID)}).Info("Removed etcd member")
+
+		return nil
+	}
+
+	log.WithFields(log.Fields{"name": name}).Info("Etcd member not found")
+
+	return nil
+}
+
+// Snapshot streams a snapshot of the keyspace from one of the endpoints into the file. The file is only replaced once the snapshot is complete.
+func Snapshot(_config *config.InternalConfig, endpoints []string, filename string) error {
+	client, error := NewClient(_config, endpoints)
+	if error != nil {
+		return error
+	}
+
+	defer client.Close()
+
+	_context, cancel := context.WithTimeout(context.Background(), snapshotTimeout)
+	defer cancel()
+
+	reader, error := client.Snapshot(_context)
+	if error != nil {
+		return fmt.Errorf("Could not request etcd snapshot (%s)", error.Error())
+	}
+
+	defer reader.Close()
+
+	if error := utils.CreateDirectoryIfMissing(path.Dir(filename)); error != nil {
+		return error
+	}
+
+	temporaryFilename := filename + ".part"
+
+	file, error := os.OpenFile(temporaryFilename, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if error != nil {
+		return error
+	}
+
+	if _, error := io.Copy(file, reader); error != nil {
+		file.Close()
+
+		return fmt.Errorf("Could not download etcd snapshot (%s)", error.Error())
+	}
+
+	if error := file.Sync(); error != nil {
+		file.Close()
+
+		return error
+	}
+
+	if error := file.Close(); error != nil {
+		return error
+	}
+
+	if error := os.Rename(temporaryFilename, filename); error != nil {
+		return error
+	}
+
+	log.WithFields(log.Fields{"filename": filename}).Info("Saved etcd snapshot")
+
+	return nil
+}
+
+// CheckHealth returns an error unless every endpoint answers a status request
+func CheckHealth(_config *config.InternalConfig, endpoints []string) error {
+	client, error := NewClient(_config, endpoints)
+	if error != nil {
+		return error
+	}
+
+	defer client.Close()
+
+	for _, endpoint := range endpoints {
+		_context, cancel := context.WithTimeout(context.Background(), requestTimeout)
+
+		_, error := client.Status(_context, endpoint)
+
+		cancel()
+
+		if error != nil {
+			return fmt.Errorf("Etcd endpoint '%s' is not healthy (%s)", endpoint, error.Error())
+		}
+	}
+
+	return nil
+}
+
+// MemberStatus is the health of an etcd member
+type MemberStatus struct {
+	Name     string `json:"name"`
+	Endpoint string `json:"endpoint"`
+	Healthy  bool   `json:"healthy"`
+	Leader   bool   `json:"leader,omitempty"`
+	Version  string `json:"version,omitempty"`
+	DBSize   int64  `json:"db-size,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// GetMemberStatuses asks every member of the cluster for its status. Members that were added but not started yet are reported as not healthy.
+func GetMemberStatuses(_config *config.InternalConfig, endpoints []string) ([]*MemberStatus, error) {
+	client, error := NewClient(_config, endpoints)
+	if error != nil {
+		return nil, error
+	}
+
+	defer client.Close()
+
+	_context, cancel := context.WithTimeout(context.Background(), requestTimeout)
+
+	members, error := client.MemberList(_context)
+
+	cancel()
+
+	if error != nil {
+		return nil, fmt.Errorf("Could not list etcd members (%s)", error.Error())
+	}
+
+	result := []*MemberStatus{}
+
+	for _, member := range members.Members {
+		status := &MemberStatus{Name: member.Name}
+
+		result = append(result, status)
+
+		if len(member.ClientURLs) == 0 {
+			status.Error = "not started"
+
+			continue
+		}
+
+		status.Endpoint = member.ClientURLs[0]
+
+		_context, cancel := context.WithTimeout(context.Background(), requestTimeout)
+
+		response, error := client.Status(_context, status.Endpoint)
+
+		cancel()
+
+		if error != nil {
+			status.Error = error.Error()
+
+			continue
+		}
+
+		status.Healthy = true
+		status.Leader = response.Leader == member.ID
+		status.Version = response.Version
+		status.DBSize = response.DbSize
+	}
+
+	return result, nil
+}
@@ -0,0 +1,290 @@
+package etcd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/darxkies/k8s-tew/config"
+	"github.com/darxkies/k8s-tew/utils"
+	minio "github.com/minio/minio-go"
+	log "github.com/sirupsen/logrus"
+)
+
+const snapshotPrefix = "snapshot-"
+const snapshotSuffix = ".db"
+
+// SnapshotInfo describes a snapshot either kept in the local snapshot directory or in the MinIO bucket
+type SnapshotInfo struct {
+	Name    string
+	Size    int64
+	Date    time.Time
+	Storage string
+}
+
+type Snapshots []SnapshotInfo
+
+func (snapshots Snapshots) Len() int {
+	return len(snapshots)
+}
+
+func (snapshots Snapshots) Less(i, j int) bool {
+	return snapshots[i].Date.Before(snapshots[j].Date)
+}
+
+func (snapshots Snapshots) Swap(i, j int) {
+	snapshots[i], snapshots[j] = snapshots[j], snapshots[i]
+}
+
+func getSnapshotDirectory(_config *config.InternalConfig) string {
+	return _config.GetFullLocalAssetDirectory(utils.DirectoryEtcdSnapshots)
+}
+
+// Only the snapshots taken by SaveSnapshot are subject to the retention, snapshots taken before upgrades are kept
+func isScheduledSnapshot(name string) bool {
+	return strings.HasPrefix(name, snapshotPrefix) && strings.HasSuffix(name, snapshotSuffix)
+}
+
+func newMinioClient(_config *config.InternalConfig) (*minio.Client, error) {
+	if len(_config.Config.MinioAccessKey) == 0 || len(_config.Config.MinioSecretKey) == 0 {
+		return nil, fmt.Errorf("The minio credentials are missing, run 'k8s-tew generate' first")
+	}
+
+	ip, error := _config.GetWorkerIP()
+	if error != nil {
+		return nil, error
+	}
+
+	return minio.New(fmt.Sprintf("%s:%d", ip, utils.PortMinio), _config.Config.MinioAccessKey, _config.Config.MinioSecretKey, false)
+}
+
+// SaveSnapshot takes a snapshot of the cluster, stores it in the configured storage and removes the snapshots exceeding the retention
+func SaveSnapshot(_config *config.InternalConfig) (string, error) {
+	name := fmt.Sprintf("%s%s%s", snapshotPrefix, time.Now().Format("20060102150405"), snapshotSuffix)
+	filename := path.Join(getSnapshotDirectory(_config), name)
+
+	if error := Snapshot(_config, _config.GetETCDClientEndpoints(), filename); error != nil {
+		return "", error
+	}
+
+	if _config.Config.EtcdSnapshotStorage == utils.EtcdSnapshotStorageMinio {
+		if error := uploadSnapshot(_config, filename); error != nil {
+			return "", error
+		}
+
+		if error := os.Remove(filename); error != nil {
+			return "", error
+		}
+	}
+
+	if error := pruneSnapshots(_config); error != nil {
+		return "", error
+	}
+
+	return name, nil
+}
+
+func uploadSnapshot(_config *config.InternalConfig, filename string) error {
+	client, error := newMinioClient(_config)
+	if error != nil {
+		return error
+	}
+
+	exists, error := client.BucketExists(utils.MinioEtcdSnapshotsBucket)
+	if error != nil {
+		return fmt.Errorf("Could not access MinIO (%s)", error.Error())
+	}
+
+	if !exists {
+		if error := client.MakeBucket(utils.MinioEtcdSnapshotsBucket, ""); error != nil {
+			return fmt.Errorf("Could not create bucket '%s' (%s)", utils.MinioEtcdSnapshotsBucket, error.Error())
+		}
+	}
+
+	if _, error := client.FPutObject(utils.MinioEtcdSnapshotsBucket, path.Base(filename), filename, minio.PutObjectOptions{ContentType: "application/octet-stream"}); error != nil {
+		return fmt.Errorf("Could not upload etcd snapshot (%s)", error.Error())
+	}
+
+	log.WithFields(log.Fields{"name": path.Base(filename), "bucket": utils.MinioEtcdSnapshotsBucket}).Info("Uploaded etcd snapshot")
+
+	return nil
+}
+
+func listLocalSnapshots(_config *config.InternalConfig) (Snapshots, error) {
+	result := Snapshots{}
+
+	files, error := ioutil.ReadDir(getSnapshotDirectory(_config))
+	if os.IsNotExist(error) {
+		return result, nil
+	}
+
+	if error != nil {
+		return nil, error
+	}
+
+	for _, file := range files {
+		if file.IsDir() || !strings.HasSuffix(file.Name(), snapshotSuffix) {
+			continue
+		}
+
+		result = append(result, SnapshotInfo{Name: file.Name(), Size: file.Size(), Date: file.ModTime(), Storage: utils.EtcdSnapshotStorageLocal})
+	}
+
+	return result, nil
+}
+
+func listMinioSnapshots(_config *config.InternalConfig) (Snapshots, error) {
+	result := Snapshots{}
+
+	client, error := newMinioClient(_config)
+	if error != nil {
+		return nil, error
+	}
+
+	exists, error := client.BucketExists(utils.MinioEtcdSnapshotsBucket)
+	if error != nil {
+		return nil, fmt.Errorf("Could not access MinIO (%s)", error.Error())
+	}
+
+	if !exists {
+		return result, nil
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+
+	for object := range client.ListObjects(utils.MinioEtcdSnapshotsBucket, "", false, done) {
+		if object.Err != nil {
+			return nil, object.Err
+		}
+
+		result = append(result, SnapshotInfo{Name: object.Key, Size: object.Size, Date: object.LastModified, Storage: utils.EtcdSnapshotStorageMinio})
+	}
+
+	return result, nil
+}
+
+// ListSnapshots returns the local snapshots and, if MinIO is the configured storage, the uploaded ones sorted by date
+func ListSnapshots(_config *config.InternalConfig) (Snapshots, error) {
+	result, error := listLocalSnapshots(_config)
+	if error != nil {
+		return nil, error
+	}
+
+	if _config.Config.EtcdSnapshotStorage == utils.EtcdSnapshotStorageMinio {
+		snapshots, error := listMinioSnapshots(_config)
+		if error != nil {
+			return nil, error
+		}
+
+		result = append(result, snapshots...)
+	}
+
+	sort.Sort(result)
+
+	return result, nil
+}
+
+// FetchSnapshot returns the local filename of the snapshot and downloads it from MinIO first if it is not available locally
+func FetchSnapshot(_config *config.InternalConfig, name string) (string, error) {
+	filename := path.Join(getSnapshotDirectory(_config), path.Base(name))
+
+	if utils.FileExists(filename) {
+		return filename, nil
+	}
+
+	if _config.Config.EtcdSnapshotStorage != utils.EtcdSnapshotStorageMinio {
+		return "", fmt.Errorf("Snapshot '%s' not found", name)
+	}
+
+	client, error := newMinioClient(_config)
+	if error != nil {
+		return "", error
+	}
+
+	if error := client.FGetObject(utils.MinioEtcdSnapshotsBucket, path.Base(name), filename, minio.GetObjectOptions{}); error != nil {
+		return "", fmt.Errorf("Could not download snapshot '%s' (%s)", name, error.Error())
+	}
+
+	log.WithFields(log.Fields{"name": name, "bucket": utils.MinioEtcdSnapshotsBucket}).Info("Downloaded etcd snapshot")
+
+	return filename, nil
+}
+
+func pruneSnapshots(_config *config.InternalConfig) error {
+	if _config.Config.EtcdSnapshotRetention == 0 {
+		return nil
+	}
+
+	snapshots, error := ListSnapshots(_config)
+	if error != nil {
+		return error
+	}
+
+	scheduled := Snapshots{}
+
+	for _, snapshot := range snapshots {
+		if isScheduledSnapshot(snapshot.Name) {
+			scheduled = append(scheduled, snapshot)
+		}
+	}
+
+	if uint(len(scheduled)) <= _config.Config.EtcdSnapshotRetention {
+		return nil
+	}
+
+	var client *minio.Client
+
+	for _, snapshot := range scheduled[:uint(len(scheduled))-_config.Config.EtcdSnapshotRetention] {
+		if snapshot.Storage == utils.EtcdSnapshotStorageLocal {
+			if error := os.Remove(path.Join(getSnapshotDirectory(_config), snapshot.Name)); error != nil {
+				return error
+			}
+
+		} else {
+			if client == nil {
+				if client, error = newMinioClient(_config); error != nil {
+					return error
+				}
+			}
+
+			if error := client.RemoveObject(utils.MinioEtcdSnapshotsBucket, snapshot.Name); error != nil {
+				return error
+			}
+		}
+
+		log.WithFields(log.Fields{"name": snapshot.Name, "storage": snapshot.Storage}).Info("Removed etcd snapshot")
+	}
+
+	return nil
+}
+
+// ScheduleSnapshots takes a snapshot every configured interval until stop is closed. Failed snapshots are logged and retried at the next interval.
+func ScheduleSnapshots(_config *config.InternalConfig, stop <-chan struct{}) {
+	if _config.Config.EtcdSnapshotInterval == 0 {
+		return
+	}
+
+	interval := time.Duration(_config.Config.EtcdSnapshotInterval) * time.Hour
+
+	log.WithFields(log.Fields{"interval": interval, "storage": _config.Config.EtcdSnapshotStorage}).Info("Scheduled etcd snapshots")
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+
+		case <-ticker.C:
+			if _, error := SaveSnapshot(_config); error != nil {
+				log.WithFields(log.Fields{"error": error}).Error("Etcd snapshot failed")
+			}
+		}
+	}
+}
@@ -0,0 +1,442 @@
+package manifest
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/darxkies/k8s-tew/utils"
+	log "github.com/sirupsen/logrus"
+	yaml "gopkg.in/yaml.v2"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const applySetKey = "apply-set"
+
+var configMapResource = schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}
+var persistentVolumeClaimResource = schema.GroupVersionResource{Version: "v1", Resource: "persistentvolumeclaims"}
+
+// Resource is a resource type used by the objects of an addon
+type Resource struct {
+	Group      string `yaml:"group,omitempty"`
+	Version    string `yaml:"version"`
+	Resource   string `yaml:"resource"`
+	Namespaced bool   `yaml:"namespaced,omitempty"`
+}
+
+func (resource *Resource) GroupVersionResource() schema.GroupVersionResource {
+	return schema.GroupVersionResource{Group: resource.Group, Version: resource.Version, Resource: resource.Resource}
+}
+
+// ApplySet records the resource types and the namespaces used by an addon. It is stored in a config map so that the objects of the addon can be found again, after they were removed from the manifest.
+type ApplySet struct {
+	Name       string      `yaml:"name"`
+	Feature    string      `yaml:"feature,omitempty"`
+	Resources  []*Resource `yaml:"resources"`
+	Namespaces []string    `yaml:"namespaces"`
+	objects    map[string]bool
+}
+
+func newApplySet(name, feature string) *ApplySet {
+	return &ApplySet{Name: name, Feature: feature, Resources: []*Resource{}, Namespaces: []string{}, objects: map[string]bool{}}
+}
+
+// The version is left out, because the same object can be served by several versions
+func getObjectKey(object *unstructured.Unstructured) string {
+	return fmt.Sprintf("%s/%s/%s", object.GetKind(), object.GetNamespace(), object.GetName())
+}
+
+func getConfigMapName(name string) string {
+	return fmt.Sprintf("%s-addon-%s", utils.ClusterName, name)
+}
+
+func (applySet *ApplySet) addResource(resource *Resource) {
+	for _, existing := range applySet.Resources {
+		if *existing == *resource {
+			return
+		}
+	}
+
+	applySet.Resources = append(applySet.Resources, resource)
+}
+
+func (applySet *ApplySet) addNamespace(namespace string) {
+	if len(namespace) == 0 || applySet.hasNamespace(namespace) {
+		return
+	}
+
+	applySet.Namespaces = append(applySet.Namespaces, namespace)
+}
+
+func (applySet *ApplySet) hasNamespace(namespace string) bool {
+	for _, existing := range applySet.Namespaces {
+		if existing == namespace {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (applySet *ApplySet) add(mapping *meta.RESTMapping, object *unstructured.Unstructured) {
+	namespaced := mapping.Scope.Name() == meta.RESTScopeNameNamespace
+
+	applySet.addResource(&Resource{Group: mapping.Resource.Group, Version: mapping.Resource.Version, Resource: mapping.Resource.Resource, Namespaced: namespaced})
+
+	if namespaced {
+		applySet.addNamespace(object.GetNamespace())
+	}
+
+	if object.GetKind() == "Namespace" {
+		applySet.addNamespace(object.GetName())
+	}
+
+	applySet.objects[getObjectKey(object)] = true
+}
+
+// merge returns a copy of the apply set that also contains the resources and the namespaces of the other one
+func (applySet *ApplySet) merge(other *ApplySet) *ApplySet {
+	result := newApplySet(applySet.Name, applySet.Feature)
+
+	for _, current := range []*ApplySet{applySet, other} {
+		for _, resource := range current.Resources {
+			result.addResource(resource)
+		}
+
+		for _, namespace := range current.Namespaces {
+			result.addNamespace(namespace)
+		}
+	}
+
+	return result
+}
+
+func (applier *Applier) loadApplySet(name string) (*ApplySet, error) {
+	configMap, error := applier.client.Resource(configMapResource).Namespace(metav1.NamespaceSystem).Get(getConfigMapName(name), metav1.GetOptions{})
+	if apierrors.IsNotFound(error) {
+		return nil, nil
+	}
+
+	if error != nil {
+		return nil, error
+	}
+
+	return parseApplySet(configMap)
+}
+
+func parseApplySet(configMap *unstructured.Unstructured) (*ApplySet, error) {
+	content, _, _ := unstructured.NestedString(configMap.Object, "data", applySetKey)
+
+	applySet := newApplySet("", "")
+
+	if error := yaml.Unmarshal([]byte(content), applySet); error != nil {
+		return nil, fmt.Errorf("Could not parse apply set '%s' (%s)", configMap.GetName(), error.Error())
+	}
+
+	return applySet, nil
+}
+
+func (applier *Applier) saveApplySet(applySet *ApplySet) error {
+	content, error := yaml.Marshal(applySet)
+	if error != nil {
+		return error
+	}
+
+	resource := applier.client.Resource(configMapResource).Namespace(metav1.NamespaceSystem)
+
+	configMap, error := resource.Get(getConfigMapName(applySet.Name), metav1.GetOptions{})
+	if apierrors.IsNotFound(error) {
+		configMap = &unstructured.Unstructured{Object: map[string]interface{}{"apiVersion": "v1", "kind": "ConfigMap"}}
+		configMap.SetName(getConfigMapName(applySet.Name))
+		configMap.SetNamespace(metav1.NamespaceSystem)
+		configMap.SetLabels(map[string]string{utils.LabelApplySet: applySet.Name})
+
+		if error := unstructured.SetNestedField(configMap.Object, string(content), "data", applySetKey); error != nil {
+			return error
+		}
+
+		_, error = resource.Create(configMap, metav1.CreateOptions{})
+
+		return error
+	}
+
+	if error != nil {
+		return error
+	}
+
+	if error := unstructured.SetNestedField(configMap.Object, string(content), "data", applySetKey); error != nil {
+		return error
+	}
+
+	_, error = resource.Update(configMap, metav1.UpdateOptions{})
+
+	return error
+}
+
+// ListAddons returns the apply sets of all installed addons sorted by name
+func (applier *Applier) ListAddons() ([]*ApplySet, error) {
+	configMaps, error := applier.client.Resource(configMapResource).Namespace(metav1.NamespaceSystem).List(metav1.ListOptions{LabelSelector: utils.LabelApplySet})
+	if error != nil {
+		return nil, error
+	}
+
+	result := []*ApplySet{}
+
+	for index := range configMaps.Items {
+		applySet, error := parseApplySet(&configMaps.Items[index])
+		if error != nil {
+			return nil, error
+		}
+
+		result = append(result, applySet)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+
+	return result, nil
+}
+
+// listObjects returns the objects of the resource that belong to the addon. Resources that are not served anymore are ignored.
+func (applier *Applier) listObjects(resource *Resource, addon string) ([]unstructured.Unstructured, error) {
+	list, error := applier.client.Resource(resource.GroupVersionResource()).List(metav1.ListOptions{LabelSelector: fmt.Sprintf("%s=%s", utils.LabelAddon, addon)})
+	if apierrors.IsNotFound(error) {
+		log.WithFields(log.Fields{"addon": addon, "resource": resource.GroupVersionResource().String()}).Debug("Resource not served")
+
+		return nil, nil
+	}
+
+	if error != nil {
+		return nil, error
+	}
+
+	return list.Items, nil
+}
+
+func (applier *Applier) deleteObject(resource *Resource, object *unstructured.Unstructured) error {
+	propagation := metav1.DeletePropagationBackground
+
+	client := applier.client.Resource(resource.GroupVersionResource())
+
+	var error error
+
+	if resource.Namespaced {
+		error = client.Namespace(object.GetNamespace()).Delete(object.GetName(), &metav1.DeleteOptions{PropagationPolicy: &propagation})
+
+	} else {
+		error = client.Delete(object.GetName(), &metav1.DeleteOptions{PropagationPolicy: &propagation})
+	}
+
+	if error != nil && !apierrors.IsNotFound(error) {
+		return fmt.Errorf("Could not delete %s '%s' (%s)", object.GetKind(), object.GetName(), error.Error())
+	}
+
+	log.WithFields(log.Fields{"addon": object.GetLabels()[utils.LabelAddon], "kind": object.GetKind(), "namespace": object.GetNamespace(), "name": object.GetName()}).Info("Deleted object")
+
+	return nil
+}
+
+// isNamespaceShared returns true if another addon uses the namespace as well
+func (applier *Applier) isNamespaceShared(namespace, addon string) (bool, error) {
+	applySets, error := applier.ListAddons()
+	if error != nil {
+		return false, error
+	}
+
+	for _, applySet := range applySets {
+		if applySet.Name != addon && applySet.hasNamespace(namespace) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func (applier *Applier) hasPersistentVolumeClaims(namespace string) (bool, error) {
+	claims, error := applier.client.Resource(persistentVolumeClaimResource).Namespace(namespace).List(metav1.ListOptions{})
+	if error != nil {
+		return false, error
+	}
+
+	return len(claims.Items) > 0, nil
+}
+
+// deleteNamespace deletes the namespace unless it is still needed
+func (applier *Applier) deleteNamespace(resource *Resource, object *unstructured.Unstructured, addon string, keepPersistentVolumeClaims bool) error {
+	shared, error := applier.isNamespaceShared(object.GetName(), addon)
+	if error != nil {
+		return error
+	}
+
+	if shared {
+		log.WithFields(log.Fields{"addon": addon, "namespace": object.GetName()}).Info("Keeping shared namespace")
+
+		return nil
+	}
+
+	if keepPersistentVolumeClaims {
+		claims, error := applier.hasPersistentVolumeClaims(object.GetName())
+		if error != nil {
+			return error
+		}
+
+		if claims {
+			log.WithFields(log.Fields{"addon": addon, "namespace": object.GetName()}).Info("Keeping namespace with persistent volume claims")
+
+			return nil
+		}
+	}
+
+	return applier.deleteObject(resource, object)
+}
+
+// deleteStatefulSetClaims deletes the claims created from the volume claim templates of a stateful set, as they are not removed together with it
+func (applier *Applier) deleteStatefulSetClaims(object *unstructured.Unstructured) error {
+	templates, _, _ := unstructured.NestedSlice(object.Object, "spec", "volumeClaimTemplates")
+	if len(templates) == 0 {
+		return nil
+	}
+
+	claims, error := applier.client.Resource(persistentVolumeClaimResource).Namespace(object.GetNamespace()).List(metav1.ListOptions{})
+	if error != nil {
+		return error
+	}
+
+	resource := &Resource{Version: persistentVolumeClaimResource.Version, Resource: persistentVolumeClaimResource.Resource, Namespaced: true}
+
+	for _, template := range templates {
+		name, _, _ := unstructured.NestedString(template.(map[string]interface{}), "metadata", "name")
+
+		// Claims are named <template>-<stateful set>-<ordinal>
+		prefix := fmt.Sprintf("%s-%s-", name, object.GetName())
+
+		for index := range claims.Items {
+			if !strings.HasPrefix(claims.Items[index].GetName(), prefix) {
+				continue
+			}
+
+			if error := applier.deleteObject(resource, &claims.Items[index]); error != nil {
+				return error
+			}
+		}
+	}
+
+	return nil
+}
+
+// prune deletes the objects of the addon that were not applied this time
+func (applier *Applier) prune(applySet *ApplySet) error {
+	previous, error := applier.loadApplySet(applySet.Name)
+	if error != nil {
+		return error
+	}
+
+	if previous == nil {
+		return applier.saveApplySet(applySet)
+	}
+
+	// Remember everything until the pruning is over, in case it fails midway
+	merged := applySet.merge(previous)
+
+	if error := applier.saveApplySet(merged); error != nil {
+		return error
+	}
+
+	for _, resource := range merged.Resources {
+		objects, error := applier.listObjects(resource, applySet.Name)
+		if error != nil {
+			return error
+		}
+
+		for index := range objects {
+			object := &objects[index]
+
+			if applySet.objects[getObjectKey(object)] {
+				continue
+			}
+
+			if object.GetKind() == "Namespace" {
+				error = applier.deleteNamespace(resource, object, applySet.Name, true)
+
+			} else {
+				error = applier.deleteObject(resource, object)
+			}
+
+			if error != nil {
+				return error
+			}
+		}
+	}
+
+	return applier.saveApplySet(applySet)
+}
+
+// Uninstall deletes all objects of the addon in reverse order. Persistent volume claims and the namespaces containing them can be kept.
+func (applier *Applier) Uninstall(addon string, keepPersistentVolumeClaims bool) error {
+	applySet, error := applier.loadApplySet(addon)
+	if error != nil {
+		return error
+	}
+
+	if applySet == nil {
+		return fmt.Errorf("addon '%s' is not installed", addon)
+	}
+
+	namespaces := []unstructured.Unstructured{}
+
+	var namespaceResource *Resource
+
+	for index := len(applySet.Resources) - 1; index >= 0; index-- {
+		resource := applySet.Resources[index]
+
+		if keepPersistentVolumeClaims && resource.GroupVersionResource().GroupResource() == persistentVolumeClaimResource.GroupResource() {
+			continue
+		}
+
+		objects, error := applier.listObjects(resource, addon)
+		if error != nil {
+			return error
+		}
+
+		for index := range objects {
+			object := &objects[index]
+
+			// Namespaces are deleted last as they take everything inside with them
+			if object.GetKind() == "Namespace" {
+				namespaces = append(namespaces, *object)
+				namespaceResource = resource
+
+				continue
+			}
+
+			if error := applier.deleteObject(resource, object); error != nil {
+				return error
+			}
+
+			if object.GetKind() == "StatefulSet" && !keepPersistentVolumeClaims {
+				if error := applier.deleteStatefulSetClaims(object); error != nil {
+					return error
+				}
+			}
+		}
+	}
+
+	for index := range namespaces {
+		if error := applier.deleteNamespace(namespaceResource, &namespaces[index], addon, keepPersistentVolumeClaims); error != nil {
+			return error
+		}
+	}
+
+	if error := applier.client.Resource(configMapResource).Namespace(metav1.NamespaceSystem).Delete(getConfigMapName(addon), &metav1.DeleteOptions{}); error != nil && !apierrors.IsNotFound(error) {
+		return error
+	}
+
+	log.WithFields(log.Fields{"addon": addon}).Info("Uninstalled addon")
+
+	return nil
+}
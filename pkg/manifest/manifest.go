@@ -0,0 +1,491 @@
+package manifest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/darxkies/k8s-tew/config"
+	"github.com/darxkies/k8s-tew/utils"
+	log "github.com/sirupsen/logrus"
+	"k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/jsonmergepatch"
+	"k8s.io/apimachinery/pkg/util/mergepatch"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+	"k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/restmapper"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+const pollInterval = 2 * time.Second
+
+// Object actions
+const ActionCreated = "created"
+const ActionConfigured = "configured"
+const ActionUnchanged = "unchanged"
+const ActionFailed = "failed"
+
+// ObjectStatus describes the outcome of applying one object of a manifest
+type ObjectStatus struct {
+	Addon     string `yaml:"addon"`
+	Kind      string `yaml:"kind"`
+	Namespace string `yaml:"namespace,omitempty"`
+	Name      string `yaml:"name"`
+	Action    string `yaml:"action"`
+	Ready     bool   `yaml:"ready"`
+	Message   string `yaml:"message,omitempty"`
+}
+
+type ObjectStatuses []*ObjectStatus
+
+// Dump logs the status of every object
+func (statuses ObjectStatuses) Dump() {
+	for _, status := range statuses {
+		fields := log.Fields{"addon": status.Addon, "kind": status.Kind, "namespace": status.Namespace, "name": status.Name, "action": status.Action, "ready": status.Ready}
+
+		if len(status.Message) > 0 {
+			fields["message"] = status.Message
+		}
+
+		if status.Ready {
+			log.WithFields(fields).Debug("Object status")
+
+		} else {
+			log.WithFields(fields).Warn("Object status")
+		}
+	}
+}
+
+// Applier creates or updates the objects of rendered manifests and waits for them to become ready
+type Applier struct {
+	config    *config.InternalConfig
+	client    dynamic.Interface
+	discovery discovery.DiscoveryInterface
+	mapper    meta.RESTMapper
+}
+
+func NewApplier(_config *config.InternalConfig) (*Applier, error) {
+	restConfig, error := clientcmd.BuildConfigFromFlags("", _config.GetFullLocalAssetFilename(utils.KubeconfigAdmin))
+	if error != nil {
+		return nil, error
+	}
+
+	client, error := dynamic.NewForConfig(restConfig)
+	if error != nil {
+		return nil, error
+	}
+
+	discoveryClient, error := discovery.NewDiscoveryClientForConfig(restConfig)
+	if error != nil {
+		return nil, error
+	}
+
+	return &Applier{config: _config, client: client, discovery: discoveryClient}, nil
+}
+
+// Apply applies all objects of the manifest and waits for the workloads and the custom resource definitions to become ready. The timeout covers the whole addon. The objects are labeled with the addon and the feature and those that were applied before but are no longer part of the manifest are deleted.
+func (applier *Applier) Apply(addon, feature, filename string, timeout time.Duration) (ObjectStatuses, error) {
+	deadline := time.Now().Add(timeout)
+
+	objects, error := readObjects(filename)
+	if error != nil {
+		return nil, fmt.Errorf("Could not read manifest '%s' (%s)", filename, error.Error())
+	}
+
+	log.WithFields(log.Fields{"addon": addon, "objects": len(objects), "timeout": timeout}).Info("Applying manifest")
+
+	applySet := newApplySet(addon, feature)
+
+	statuses := ObjectStatuses{}
+
+	for _, object := range objects {
+		setLabels(object, addon, feature)
+
+		status := &ObjectStatus{Addon: addon, Kind: object.GetKind(), Namespace: object.GetNamespace(), Name: object.GetName()}
+
+		statuses = append(statuses, status)
+
+		mapping, error := applier.getMapping(object, deadline)
+		if error == nil {
+			error = applier.applyObject(object, status, deadline)
+		}
+
+		if error != nil {
+			status.Action = ActionFailed
+			status.Message = error.Error()
+
+			return statuses, fmt.Errorf("Could not apply %s '%s' of addon '%s' (%s)", status.Kind, status.Name, addon, error.Error())
+		}
+
+		applySet.add(mapping, object)
+
+		log.WithFields(log.Fields{"addon": addon, "kind": status.Kind, "namespace": status.Namespace, "name": status.Name, "action": status.Action}).Debug("Applied object")
+	}
+
+	if error := applier.waitForObjects(objects, statuses, deadline); error != nil {
+		return statuses, fmt.Errorf("Addon '%s' did not become ready (%s)", addon, error.Error())
+	}
+
+	if error := applier.prune(applySet); error != nil {
+		return statuses, fmt.Errorf("Could not prune addon '%s' (%s)", addon, error.Error())
+	}
+
+	log.WithFields(log.Fields{"addon": addon}).Info("Addon ready")
+
+	return statuses, nil
+}
+
+// setLabels marks the object as part of the addon
+func setLabels(object *unstructured.Unstructured, addon, feature string) {
+	labels := object.GetLabels()
+	if labels == nil {
+		labels = map[string]string{}
+	}
+
+	labels[utils.LabelAddon] = addon
+
+	if len(feature) > 0 {
+		labels[utils.LabelFeature] = feature
+	}
+
+	object.SetLabels(labels)
+}
+
+// readObjects decodes all documents of a multi-document YAML file. Lists are flattened.
+func readObjects(filename string) ([]*unstructured.Unstructured, error) {
+	file, error := os.Open(filename)
+	if error != nil {
+		return nil, error
+	}
+
+	defer file.Close()
+
+	decoder := yaml.NewYAMLOrJSONDecoder(file, 4096)
+
+	result := []*unstructured.Unstructured{}
+
+	for {
+		document := map[string]interface{}{}
+
+		if error := decoder.Decode(&document); error != nil {
+			if error == io.EOF {
+				break
+			}
+
+			return nil, error
+		}
+
+		// Empty documents
+		if len(document) == 0 {
+			continue
+		}
+
+		object := &unstructured.Unstructured{Object: document}
+
+		if !object.IsList() {
+			result = append(result, object)
+
+			continue
+		}
+
+		list, error := object.ToList()
+		if error != nil {
+			return nil, error
+		}
+
+		for index := range list.Items {
+			result = append(result, &list.Items[index])
+		}
+	}
+
+	return result, nil
+}
+
+// getMapping maps the kind of the object to its resource. Unknown kinds refresh the discovery information until the deadline is reached, in order to pick up freshly registered custom resource definitions.
+func (applier *Applier) getMapping(object *unstructured.Unstructured, deadline time.Time) (*meta.RESTMapping, error) {
+	gvk := object.GroupVersionKind()
+
+	for {
+		if applier.mapper != nil {
+			mapping, error := applier.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+			if error == nil {
+				return mapping, nil
+			}
+
+			if !meta.IsNoMatchError(error) || time.Now().After(deadline) {
+				return nil, error
+			}
+
+			log.WithFields(log.Fields{"kind": gvk.Kind, "version": gvk.Version}).Debug("Waiting for kind")
+
+			time.Sleep(pollInterval)
+		}
+
+		groupResources, error := restmapper.GetAPIGroupResources(applier.discovery)
+		if error != nil {
+			if time.Now().After(deadline) {
+				return nil, error
+			}
+
+			log.WithFields(log.Fields{"error": error}).Debug("Discovery failed")
+
+			time.Sleep(pollInterval)
+
+			continue
+		}
+
+		applier.mapper = restmapper.NewDiscoveryRESTMapper(groupResources)
+	}
+}
+
+// getResource returns the client of the resource the object belongs to. Namespaced objects without a namespace are put in the default namespace.
+func (applier *Applier) getResource(object *unstructured.Unstructured, deadline time.Time) (dynamic.ResourceInterface, error) {
+	mapping, error := applier.getMapping(object, deadline)
+	if error != nil {
+		return nil, error
+	}
+
+	if mapping.Scope.Name() != meta.RESTScopeNameNamespace {
+		return applier.client.Resource(mapping.Resource), nil
+	}
+
+	if len(object.GetNamespace()) == 0 {
+		object.SetNamespace(metav1.NamespaceDefault)
+	}
+
+	return applier.client.Resource(mapping.Resource).Namespace(object.GetNamespace()), nil
+}
+
+// applyObject creates the object or updates it the way kubectl apply does. The applied manifest is stored in the last-applied-configuration
+// annotation. The patch is the three-way merge of that annotation, the new manifest and the live object, so fields dropped from the manifest
+// are removed while fields set by the cluster, such as the cluster ip of a service, are kept.
+func (applier *Applier) applyObject(object *unstructured.Unstructured, status *ObjectStatus, deadline time.Time) error {
+	resource, error := applier.getResource(object, deadline)
+	if error != nil {
+		return error
+	}
+
+	status.Namespace = object.GetNamespace()
+
+	modified, error := setLastApplied(object)
+	if error != nil {
+		return error
+	}
+
+	for {
+		error = applier.createOrPatch(resource, object, modified, status)
+		if error == nil {
+			return nil
+		}
+
+		if apierrors.IsInvalid(error) || apierrors.IsBadRequest(error) || time.Now().After(deadline) {
+			return error
+		}
+
+		// The API server might still be starting or a namespace might still be created
+		log.WithFields(log.Fields{"kind": object.GetKind(), "name": object.GetName(), "error": error}).Debug("Apply failed")
+
+		time.Sleep(pollInterval)
+	}
+}
+
+// setLastApplied stores the manifest of the object in its annotation and returns the annotated manifest
+func setLastApplied(object *unstructured.Unstructured) ([]byte, error) {
+	annotations := object.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+
+	delete(annotations, v1.LastAppliedConfigAnnotation)
+
+	object.SetAnnotations(annotations)
+
+	content, error := json.Marshal(object.Object)
+	if error != nil {
+		return nil, error
+	}
+
+	annotations[v1.LastAppliedConfigAnnotation] = string(content)
+
+	object.SetAnnotations(annotations)
+
+	return json.Marshal(object.Object)
+}
+
+func (applier *Applier) createOrPatch(resource dynamic.ResourceInterface, object *unstructured.Unstructured, modified []byte, status *ObjectStatus) error {
+	current, error := resource.Get(object.GetName(), metav1.GetOptions{})
+	if apierrors.IsNotFound(error) {
+		if _, error := resource.Create(object, metav1.CreateOptions{}); error != nil {
+			return error
+		}
+
+		status.Action = ActionCreated
+
+		return nil
+	}
+
+	if error != nil {
+		return error
+	}
+
+	patchType, patch, error := getPatch(object.GroupVersionKind(), current, modified)
+	if error != nil {
+		return error
+	}
+
+	if string(patch) == "{}" {
+		status.Action = ActionUnchanged
+
+		return nil
+	}
+
+	if _, error := resource.Patch(object.GetName(), patchType, patch, metav1.UpdateOptions{}); error != nil {
+		return error
+	}
+
+	status.Action = ActionConfigured
+
+	return nil
+}
+
+// getPatch returns a strategic merge patch for the kinds known to client-go, which merges lists like the containers of a pod by their keys.
+// Custom resources only support JSON merge patches. Objects created without the annotation have no fields removed by the first patch.
+func getPatch(kind schema.GroupVersionKind, current *unstructured.Unstructured, modified []byte) (types.PatchType, []byte, error) {
+	original := []byte(current.GetAnnotations()[v1.LastAppliedConfigAnnotation])
+
+	currentContent, error := json.Marshal(current.Object)
+	if error != nil {
+		return "", nil, error
+	}
+
+	preconditions := []mergepatch.PreconditionFunc{mergepatch.RequireKeyUnchanged("apiVersion"), mergepatch.RequireKeyUnchanged("kind"), mergepatch.RequireMetadataKeyUnchanged("name")}
+
+	versionedObject, error := scheme.Scheme.New(kind)
+	if runtime.IsNotRegisteredError(error) {
+		patch, error := jsonmergepatch.CreateThreeWayJSONMergePatch(original, modified, currentContent, preconditions...)
+
+		return types.MergePatchType, patch, error
+	}
+
+	if error != nil {
+		return "", nil, error
+	}
+
+	lookupPatchMeta, error := strategicpatch.NewPatchMetaFromStruct(versionedObject)
+	if error != nil {
+		return "", nil, error
+	}
+
+	patch, error := strategicpatch.CreateThreeWayMergePatch(original, modified, currentContent, lookupPatchMeta, true, preconditions...)
+
+	return types.StrategicMergePatchType, patch, error
+}
+
+func (applier *Applier) waitForObjects(objects []*unstructured.Unstructured, statuses ObjectStatuses, deadline time.Time) error {
+	for index, object := range objects {
+		status := statuses[index]
+
+		for {
+			resource, error := applier.getResource(object, deadline)
+			if error != nil {
+				return error
+			}
+
+			current, error := resource.Get(object.GetName(), metav1.GetOptions{})
+			if error == nil {
+				status.Ready, status.Message = isReady(current)
+
+				if status.Ready {
+					break
+				}
+
+			} else {
+				status.Message = error.Error()
+			}
+
+			if time.Now().After(deadline) {
+				return fmt.Errorf("%s '%s' is not ready (%s)", status.Kind, status.Name, status.Message)
+			}
+
+			log.WithFields(log.Fields{"kind": status.Kind, "namespace": status.Namespace, "name": status.Name, "message": status.Message}).Debug("Waiting for object")
+
+			time.Sleep(pollInterval)
+		}
+	}
+
+	return nil
+}
+
+// isReady evaluates the status of workloads and custom resource definitions. All other kinds are ready once they exist.
+func isReady(object *unstructured.Unstructured) (bool, string) {
+	generation := object.GetGeneration()
+	observedGeneration, _, _ := unstructured.NestedInt64(object.Object, "status", "observedGeneration")
+
+	switch object.GetKind() {
+	case "Deployment", "StatefulSet":
+		if observedGeneration < generation {
+			return false, "waiting for the rollout to be observed"
+		}
+
+		replicas, found, _ := unstructured.NestedInt64(object.Object, "spec", "replicas")
+		if !found {
+			replicas = 1
+		}
+
+		field := "availableReplicas"
+
+		if object.GetKind() == "StatefulSet" {
+			field = "readyReplicas"
+		}
+
+		updated, _, _ := unstructured.NestedInt64(object.Object, "status", "updatedReplicas")
+		ready, _, _ := unstructured.NestedInt64(object.Object, "status", field)
+
+		if updated < replicas || ready < replicas {
+			return false, fmt.Sprintf("%d of %d replicas updated, %d ready", updated, replicas, ready)
+		}
+
+	case "DaemonSet":
+		if observedGeneration < generation {
+			return false, "waiting for the rollout to be observed"
+		}
+
+		desired, _, _ := unstructured.NestedInt64(object.Object, "status", "desiredNumberScheduled")
+		updated, _, _ := unstructured.NestedInt64(object.Object, "status", "updatedNumberScheduled")
+		available, _, _ := unstructured.NestedInt64(object.Object, "status", "numberAvailable")
+
+		if updated < desired || available < desired {
+			return false, fmt.Sprintf("%d of %d pods updated, %d available", updated, desired, available)
+		}
+
+	case "CustomResourceDefinition":
+		conditions, _, _ := unstructured.NestedSlice(object.Object, "status", "conditions")
+
+		for _, condition := range conditions {
+			fields, ok := condition.(map[string]interface{})
+			if !ok {
+				continue
+			}
+
+			if fields["type"] == "Established" && fields["status"] == "True" {
+				return true, ""
+			}
+		}
+
+		return false, "not established"
+	}
+
+	return true, ""
+}
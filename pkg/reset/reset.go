@@ -0,0 +1,258 @@
+package reset
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/darxkies/k8s-tew/config"
+	"github.com/darxkies/k8s-tew/pkg/container"
+	"github.com/darxkies/k8s-tew/utils"
+	log "github.com/sirupsen/logrus"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Interface name prefixes of the network devices created by Calico and kube-proxy
+var interfacePrefixes = []string{"cali", "vxlan.calico", "kube-ipvs", "tunl"}
+
+// Chain name prefixes of the iptables rules created by Calico and kube-proxy
+var chainPrefixes = []string{"cali-", "KUBE-"}
+
+// Problem describes something that could not be cleaned up
+type Problem struct {
+	Step   string `yaml:"step"`
+	Target string `yaml:"target"`
+	Error  string `yaml:"error"`
+}
+
+// Report lists the problems encountered while resetting a node
+type Report struct {
+	Node     string     `yaml:"node"`
+	Problems []*Problem `yaml:"problems"`
+}
+
+type Reports []*Report
+
+// ParseReport reads a report printed by the reset command
+func ParseReport(content string) (*Report, error) {
+	report := &Report{}
+
+	if error := yaml.Unmarshal([]byte(content), report); error != nil {
+		return nil, fmt.Errorf("Could not parse reset report (%s)", error.Error())
+	}
+
+	return report, nil
+}
+
+func (report *Report) String() string {
+	content, error := yaml.Marshal(report)
+	if error != nil {
+		return ""
+	}
+
+	return string(content)
+}
+
+// Dump logs the problems of the report
+func (report *Report) Dump() {
+	for _, problem := range report.Problems {
+		log.WithFields(log.Fields{"node": report.Node, "step": problem.Step, "target": problem.Target, "error": problem.Error}).Warn("Could not clean up")
+	}
+}
+
+// Reset removes k8s-tew from the machine it runs on
+type Reset struct {
+	config       *config.InternalConfig
+	removeAssets bool
+	report       *Report
+	steps        []func()
+}
+
+// NewReset removes only the deployed files unless removeAssets is set, then the assets of the bootstrapper in the base directory are removed too
+func NewReset(_config *config.InternalConfig, removeAssets bool) *Reset {
+	reset := &Reset{config: _config, removeAssets: removeAssets, report: &Report{Node: _config.Name, Problems: []*Problem{}}}
+
+	reset.steps = []func(){
+		reset.stopService,
+		reset.killContainers,
+		reset.removeInterfaces,
+		reset.removeIptablesRules,
+		reset.removeFiles,
+	}
+
+	return reset
+}
+
+func (reset *Reset) Steps() int {
+	return len(reset.steps)
+}
+
+// Run executes all steps even if some of them fail and returns the problems
+func (reset *Reset) Run() *Report {
+	for _, step := range reset.steps {
+		step()
+
+		utils.IncreaseProgressStep()
+	}
+
+	return reset.report
+}
+
+func (reset *Reset) addProblem(step, target string, error error) {
+	log.WithFields(log.Fields{"step": step, "target": target, "error": error}).Debug("Reset failed")
+
+	reset.report.Problems = append(reset.report.Problems, &Problem{Step: step, Target: target, Error: error.Error()})
+}
+
+func (reset *Reset) stopService() {
+	if !utils.FileExists(reset.config.GetFullLocalAssetFilename(utils.ServiceConfig)) {
+		return
+	}
+
+	log.WithFields(log.Fields{"name": utils.ServiceName}).Info("Stopping service")
+
+	if error := utils.RunCommand(fmt.Sprintf("systemctl stop %s && systemctl disable %s", utils.ServiceName, utils.ServiceName)); error != nil {
+		reset.addProblem("stop-service", utils.ServiceName, error)
+	}
+}
+
+func (reset *Reset) killContainers() {
+	log.Info("Killing containers")
+
+	container.KillContainers(reset.config)
+
+	for _, mountPoint := range container.GetMountPoints(reset.config) {
+		reset.addProblem("unmount", mountPoint, fmt.Errorf("still mounted"))
+	}
+}
+
+func (reset *Reset) removeInterfaces() {
+	output, error := utils.RunCommandWithOutput("ip -o link show")
+	if error != nil {
+		reset.addProblem("remove-interfaces", "", error)
+
+		return
+	}
+
+	for _, line := range strings.Split(output, "\n") {
+		tokens := strings.Fields(line)
+
+		if len(tokens) < 2 {
+			continue
+		}
+
+		// Strip the colon and the parent device (e.g. cali123@if4:)
+		name := strings.Split(strings.TrimSuffix(tokens[1], ":"), "@")[0]
+
+		for _, prefix := range interfacePrefixes {
+			if !strings.HasPrefix(name, prefix) {
+				continue
+			}
+
+			log.WithFields(log.Fields{"name": name}).Info("Removing interface")
+
+			// tunl0 belongs to the ipip module and can only be removed by unloading it
+			command := fmt.Sprintf("ip link delete %s", name)
+
+			if name == "tunl0" {
+				command = "ip link set tunl0 down && modprobe -r ipip"
+			}
+
+			if error := utils.RunCommand(command); error != nil {
+				reset.addProblem("remove-interface", name, error)
+			}
+
+			break
+		}
+	}
+}
+
+func (reset *Reset) removeIptablesRules() {
+	// Only match chain names at the start of a token (:KUBE-SERVICES, -A cali-INPUT, -j KUBE-FIREWALL)
+	filter := fmt.Sprintf("'(^|[ :])(%s)'", strings.Join(chainPrefixes, "|"))
+
+	for _, binary := range []string{"iptables", "ip6tables"} {
+		if _, error := utils.RunCommandWithOutput(fmt.Sprintf("command -v %s-save", binary)); error != nil {
+			continue
+		}
+
+		log.WithFields(log.Fields{"name": binary}).Info("Removing rules")
+
+		if error := utils.RunCommand(fmt.Sprintf("%s-save | grep -v -E %s | %s-restore", binary, filter, binary)); error != nil {
+			reset.addProblem("remove-rules", binary, error)
+		}
+	}
+}
+
+func (reset *Reset) removeFiles() {
+	labels := config.Labels{utils.NodeController, utils.NodeWorker}
+
+	if reset.config.Node != nil {
+		labels = reset.config.Node.Labels
+	}
+
+	filenames := reset.config.GetOwnedPaths(reset.config.Config.DeploymentDirectory, labels)
+
+	if reset.removeAssets {
+		filenames = append(filenames, reset.config.GetOwnedPaths(reset.config.BaseDirectory, config.Labels{utils.NodeBootstrapper, utils.NodeController, utils.NodeWorker})...)
+	}
+
+	hasAssets := reset.hasAssets()
+	keptAssets := false
+
+	for _, filename := range filenames {
+		if !utils.FileExists(filename) {
+			continue
+		}
+
+		if !reset.removeAssets && hasAssets && overlaps(filename, reset.config.BaseDirectory) {
+			log.WithFields(log.Fields{"_name": filename}).Debug("Keeping assets")
+
+			keptAssets = true
+
+			continue
+		}
+
+		log.WithFields(log.Fields{"name": filename}).Info("Removing")
+
+		if error := os.RemoveAll(filename); error != nil {
+			reset.addProblem("remove-files", filename, error)
+		}
+	}
+
+	if keptAssets {
+		log.WithFields(log.Fields{"directory": reset.config.BaseDirectory}).Warn("Kept the assets of the bootstrapper, use --assets to remove them")
+	}
+
+	if error := utils.RunCommand("systemctl daemon-reload"); error != nil {
+		reset.addProblem("reload-systemd", "", error)
+	}
+}
+
+// hasAssets checks if the base directory contains files that are never deployed to the nodes, like the keys of the etcd CA. Then it holds the assets of the bootstrapper.
+func (reset *Reset) hasAssets() bool {
+	for name, file := range reset.config.Config.Assets.Files {
+		if file.Labels.HasLabels(config.Labels{utils.NodeController, utils.NodeWorker}) {
+			continue
+		}
+
+		if utils.FileExists(reset.config.GetFullLocalAssetFilename(name)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// overlaps checks if one of the paths contains the other one
+func overlaps(first, second string) bool {
+	first = path.Clean(first)
+	second = path.Clean(second)
+
+	isParent := func(parent, child string) bool {
+		return parent == child || parent == "/" || strings.HasPrefix(child, parent+"/")
+	}
+
+	return isParent(first, second) || isParent(second, first)
+}
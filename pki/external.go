@@ -0,0 +1,244 @@
+package pki
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+
+	"github.com/darxkies/k8s-tew/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+func isSelfSigned(certificate *x509.Certificate) bool {
+	return bytes.Equal(certificate.RawIssuer, certificate.RawSubject) && certificate.CheckSignatureFrom(certificate) == nil
+}
+
+// BuildChain returns the intermediate CAs between the certificate and its root, starting with the certificate itself
+// unless it is a root. The issuers are looked up in candidates.
+func BuildChain(certificate *x509.Certificate, candidates []*x509.Certificate) []*x509.Certificate {
+	result := []*x509.Certificate{}
+
+	for current := certificate; current != nil && !isSelfSigned(current); {
+		result = append(result, current)
+
+		var issuer *x509.Certificate
+
+		for _, candidate := range candidates {
+			if candidate != current && bytes.Equal(current.RawIssuer, candidate.RawSubject) && current.CheckSignatureFrom(candidate) == nil {
+				issuer = candidate
+
+				break
+			}
+		}
+
+		current = issuer
+	}
+
+	return result
+}
+
+func findRoot(certificate *x509.Certificate, candidates []*x509.Certificate) *x509.Certificate {
+	for _, candidate := range candidates {
+		if isSelfSigned(candidate) && certificate.CheckSignatureFrom(candidate) == nil {
+			return candidate
+		}
+	}
+
+	return nil
+}
+
+func equalPublicKeys(first, second crypto.PublicKey) bool {
+	firstContent, error := x509.MarshalPKIXPublicKey(first)
+	if error != nil {
+		return false
+	}
+
+	secondContent, error := x509.MarshalPKIXPublicKey(second)
+	if error != nil {
+		return false
+	}
+
+	return bytes.Equal(firstContent, secondContent)
+}
+
+func encodeCertificates(certificates []*x509.Certificate) []byte {
+	result := []byte{}
+
+	for _, certificate := range certificates {
+		result = append(result, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certificate.Raw})...)
+	}
+
+	return result
+}
+
+// ImportCA stores an existing CA, root or intermediate, as the CA of the cluster. The certificates of the chain file, if any,
+// are appended so that the bundle leads to the root. Without a private key the CA can only be used to sign certificates externally.
+func ImportCA(certificateFilename, privateKeyFilename, chainFilename, caFilename, caKeyFilename string) error {
+	certificates, error := LoadCertificates(certificateFilename)
+	if error != nil {
+		return error
+	}
+
+	if len(chainFilename) > 0 {
+		chain, error := LoadCertificates(chainFilename)
+		if error != nil {
+			return error
+		}
+
+		certificates = append(certificates, chain...)
+	}
+
+	ca := certificates[0]
+
+	if !ca.IsCA {
+		return fmt.Errorf("'%s' is not a CA certificate", certificateFilename)
+	}
+
+	// Keep the CA first followed by its issuers up to the root
+	bundle := BuildChain(ca, certificates[1:])
+
+	if len(bundle) == 0 {
+		bundle = []*x509.Certificate{ca}
+
+	} else if root := findRoot(bundle[len(bundle)-1], certificates[1:]); root != nil {
+		bundle = append(bundle, root)
+
+	} else {
+		log.WithFields(log.Fields{"subject": ca.Subject.CommonName}).Warn("The root CA is missing, clients might not be able to verify the certificates")
+	}
+
+	if len(privateKeyFilename) > 0 {
+		privateKey, error := loadPrivateKey(privateKeyFilename)
+		if error != nil {
+			return error
+		}
+
+		if !equalPublicKeys(privateKey.Public(), ca.PublicKey) {
+			return fmt.Errorf("the private key '%s' does not belong to '%s'", privateKeyFilename, certificateFilename)
+		}
+
+		privateKeyPEM, error := encodePrivateKey(privateKey)
+		if error != nil {
+			return error
+		}
+
+		if error := ioutil.WriteFile(caKeyFilename, privateKeyPEM, 0600); error != nil {
+			return error
+		}
+
+		utils.LogFilename("Generated", caKeyFilename)
+
+	} else if utils.FileExists(caKeyFilename) {
+		// The key belongs to the replaced CA
+		if error := os.Remove(caKeyFilename); error != nil {
+			return error
+		}
+
+		utils.LogFilename("Removed", caKeyFilename)
+	}
+
+	return SaveCertificates(caFilename, bundle)
+}
+
+// GenerateCSR writes a certificate signing request for the private key, which is generated if it does not exist yet
+func GenerateCSR(keyOptions KeyOptions, commonName, organization string, dnsNames []string, ipAddresses []string, privateKeyFilename, csrFilename string) error {
+	var privateKey crypto.Signer
+
+	if utils.FileExists(privateKeyFilename) {
+		var error error
+
+		privateKey, error = loadPrivateKey(privateKeyFilename)
+		if error != nil {
+			return error
+		}
+
+	} else {
+		var error error
+
+		privateKey, error = generateKey(keyOptions)
+		if error != nil {
+			return error
+		}
+
+		privateKeyPEM, error := encodePrivateKey(privateKey)
+		if error != nil {
+			return error
+		}
+
+		if error := ioutil.WriteFile(privateKeyFilename, privateKeyPEM, 0644); error != nil {
+			return error
+		}
+
+		utils.LogFilename("Generated", privateKeyFilename)
+	}
+
+	template := &x509.CertificateRequest{
+		Subject: pkix.Name{
+			CommonName:   commonName,
+			Organization: []string{organization},
+		},
+		DNSNames: dnsNames,
+	}
+
+	for _, ipString := range ipAddresses {
+		ipAddress := net.ParseIP(ipString)
+
+		if ipAddress == nil {
+			return fmt.Errorf("'%s' is not a valid IP address", ipString)
+		}
+
+		template.IPAddresses = append(template.IPAddresses, ipAddress)
+	}
+
+	content, error := x509.CreateCertificateRequest(rand.Reader, template, privateKey)
+	if error != nil {
+		return error
+	}
+
+	if error := ioutil.WriteFile(csrFilename, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: content}), 0644); error != nil {
+		return error
+	}
+
+	utils.LogFilename("Generated", csrFilename)
+
+	return nil
+}
+
+// ImportCertificate stores a certificate signed externally after checking that it belongs to the private key and that it
+// was issued by the CA. The intermediate CAs are appended to the certificate.
+func ImportCertificate(signer *CertificateAndPrivateKey, filename, certificateFilename, privateKeyFilename string) error {
+	certificates, error := LoadCertificates(filename)
+	if error != nil {
+		return error
+	}
+
+	certificate := certificates[0]
+
+	privateKey, error := loadPrivateKey(privateKeyFilename)
+	if error != nil {
+		return error
+	}
+
+	if !equalPublicKeys(privateKey.Public(), certificate.PublicKey) {
+		return fmt.Errorf("'%s' does not belong to the private key '%s'", filename, privateKeyFilename)
+	}
+
+	if error := certificate.CheckSignatureFrom(signer.Certificate); error != nil {
+		return fmt.Errorf("'%s' was not issued by '%s' (%s)", filename, signer.CertificateFilename, error.Error())
+	}
+
+	if error := ioutil.WriteFile(certificateFilename, append(encodeCertificates([]*x509.Certificate{certificate}), encodeCertificates(signer.Chain)...), 0644); error != nil {
+		return error
+	}
+
+	utils.LogFilename("Imported", certificateFilename)
+
+	return nil
+}
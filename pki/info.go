@@ -0,0 +1,66 @@
+package pki
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"time"
+)
+
+const probeTimeout = 5 * time.Second
+
+// CertificateInfo holds the fields of a certificate relevant for its renewal
+type CertificateInfo struct {
+	Subject     string    `json:"subject"`
+	DNSNames    []string  `json:"dns-names,omitempty"`
+	IPAddresses []string  `json:"ip-addresses,omitempty"`
+	Issuer      string    `json:"issuer"`
+	Serial      string    `json:"serial"`
+	Algorithm   string    `json:"key-algorithm"`
+	NotAfter    time.Time `json:"not-after"`
+	DaysLeft    int       `json:"days-left"`
+	Expired     bool      `json:"expired"`
+}
+
+func NewCertificateInfo(certificate *x509.Certificate) CertificateInfo {
+	ipAddresses := []string{}
+
+	for _, ipAddress := range certificate.IPAddresses {
+		ipAddresses = append(ipAddresses, ipAddress.String())
+	}
+
+	return CertificateInfo{
+		Subject:     certificate.Subject.String(),
+		DNSNames:    certificate.DNSNames,
+		IPAddresses: ipAddresses,
+		Issuer:      certificate.Issuer.String(),
+		Serial:      fmt.Sprintf("%x", certificate.SerialNumber),
+		Algorithm:   GetKeyAlgorithm(certificate.PublicKey),
+		NotAfter:    certificate.NotAfter,
+		DaysLeft:    int(time.Until(certificate.NotAfter).Hours() / 24),
+		Expired:     time.Now().After(certificate.NotAfter),
+	}
+}
+
+// ProbeCertificate connects to the address and returns the certificate served there. The client certificate is only
+// presented to servers that require one, the served certificate is not verified.
+func ProbeCertificate(address string, clientCertificate tls.Certificate) (*x509.Certificate, error) {
+	connection, error := tls.DialWithDialer(&net.Dialer{Timeout: probeTimeout}, "tcp", address, &tls.Config{
+		Certificates:       []tls.Certificate{clientCertificate},
+		InsecureSkipVerify: true,
+	})
+	if error != nil {
+		return nil, error
+	}
+
+	defer connection.Close()
+
+	certificates := connection.ConnectionState().PeerCertificates
+
+	if len(certificates) == 0 {
+		return nil, fmt.Errorf("no certificate served by '%s'", address)
+	}
+
+	return certificates[0], nil
+}
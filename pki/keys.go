@@ -0,0 +1,126 @@
+package pki
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+
+	"github.com/darxkies/k8s-tew/utils"
+)
+
+// KeyOptions selects the algorithm of the generated private keys. RSASize is only used for RSA keys.
+type KeyOptions struct {
+	Algorithm string
+	RSASize   uint16
+}
+
+func NewKeyOptions(algorithm string, rsaSize uint16) KeyOptions {
+	return KeyOptions{Algorithm: algorithm, RSASize: rsaSize}
+}
+
+// ValidateKeyAlgorithm returns an error if the algorithm is not supported. Ed25519 is rejected, because the Kubernetes and
+// etcd binaries are built with a Go version that cannot parse Ed25519 keys.
+func ValidateKeyAlgorithm(algorithm string) error {
+	switch algorithm {
+	case utils.KeyAlgorithmRSA, utils.KeyAlgorithmECDSAP256, utils.KeyAlgorithmECDSAP384:
+		return nil
+	}
+
+	return fmt.Errorf("unsupported key algorithm '%s'", algorithm)
+}
+
+func generateKey(options KeyOptions) (crypto.Signer, error) {
+	switch options.Algorithm {
+	case utils.KeyAlgorithmRSA, "":
+		return rsa.GenerateKey(rand.Reader, int(options.RSASize))
+
+	case utils.KeyAlgorithmECDSAP256:
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	case utils.KeyAlgorithmECDSAP384:
+		return ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+
+	}
+
+	return nil, ValidateKeyAlgorithm(options.Algorithm)
+}
+
+// GetKeyAlgorithm returns the name of the algorithm of a public key the same way it is configured
+func GetKeyAlgorithm(publicKey crypto.PublicKey) string {
+	switch key := publicKey.(type) {
+	case *rsa.PublicKey:
+		return utils.KeyAlgorithmRSA
+
+	case *ecdsa.PublicKey:
+		switch key.Curve {
+		case elliptic.P256():
+			return utils.KeyAlgorithmECDSAP256
+
+		case elliptic.P384():
+			return utils.KeyAlgorithmECDSAP384
+		}
+
+		return "ecdsa"
+	}
+
+	return "unknown"
+}
+
+// encodePrivateKey encodes the key as PKCS#8
+func encodePrivateKey(privateKey crypto.Signer) ([]byte, error) {
+	content, error := x509.MarshalPKCS8PrivateKey(privateKey)
+	if error != nil {
+		return nil, error
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: content}), nil
+}
+
+func loadPrivateKey(filename string) (crypto.Signer, error) {
+	block, error := loadPEMBlock(filename)
+	if error != nil {
+		return nil, error
+	}
+
+	if block == nil {
+		return nil, fmt.Errorf("wrong private key format in '%s'", filename)
+	}
+
+	privateKey, error := decodePrivateKey(block)
+	if error != nil {
+		return nil, fmt.Errorf("wrong private key format in '%s' (%s)", filename, error.Error())
+	}
+
+	return privateKey, nil
+}
+
+// decodePrivateKey parses PKCS#8 keys and, for keys generated by older versions, PKCS#1 RSA and SEC 1 EC keys
+func decodePrivateKey(block *pem.Block) (crypto.Signer, error) {
+	switch block.Type {
+	case "PRIVATE KEY":
+		privateKey, error := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if error != nil {
+			return nil, error
+		}
+
+		signer, ok := privateKey.(crypto.Signer)
+		if !ok {
+			return nil, fmt.Errorf("unsupported private key type %T", privateKey)
+		}
+
+		return signer, nil
+
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+
+	case "EC PRIVATE KEY":
+		return x509.ParseECPrivateKey(block.Bytes)
+	}
+
+	return nil, fmt.Errorf("unsupported private key format '%s'", block.Type)
+}
@@ -1,8 +1,8 @@
 package pki
 
 import (
+	"crypto"
 	"crypto/rand"
-	"crypto/rsa"
 	"crypto/sha1"
 	"crypto/x509"
 	"crypto/x509/pkix"
@@ -50,11 +50,14 @@ func bigIntHash() ([]byte, error) {
 	return hash.Sum(nil), nil
 }
 
+// CertificateAndPrivateKey is a CA used to sign certificates. Chain holds the intermediate CAs appended to the issued certificates.
+// PrivateKey is nil for CAs whose key is kept outside of the cluster, their certificates are signed externally.
 type CertificateAndPrivateKey struct {
 	CertificateFilename string
 	PrivateKeyFilename  string
 	Certificate         *x509.Certificate
-	PrivateKey          *rsa.PrivateKey
+	Chain               []*x509.Certificate
+	PrivateKey          crypto.Signer
 }
 
 func loadPEMBlock(filename string) (*pem.Block, error) {
@@ -75,41 +78,95 @@ func loadPEMBlock(filename string) (*pem.Block, error) {
 	return block, nil
 }
 
+// LoadCertificateAndPrivateKey loads the first certificate of the file and its private key. The other certificates of the
+// file are used to build the chain. Without a private key filename only the certificate is loaded.
 func LoadCertificateAndPrivateKey(certificateFilename, privateKeyFilename string) (*CertificateAndPrivateKey, error) {
 	result := &CertificateAndPrivateKey{CertificateFilename: certificateFilename, PrivateKeyFilename: privateKeyFilename}
 
-	block, error := loadPEMBlock(certificateFilename)
+	certificates, error := LoadCertificates(certificateFilename)
 	if error != nil {
 		return nil, error
 	}
 
-	if block == nil || block.Type != "CERTIFICATE" {
-		return nil, fmt.Errorf("wrong certificate format in '%s'", certificateFilename)
+	result.Certificate = certificates[0]
+	result.Chain = BuildChain(certificates[0], certificates[1:])
+
+	if len(privateKeyFilename) == 0 {
+		return result, nil
 	}
 
-	result.Certificate, error = x509.ParseCertificate(block.Bytes)
+	result.PrivateKey, error = loadPrivateKey(privateKeyFilename)
 	if error != nil {
 		return nil, error
 	}
 
-	block, error = loadPEMBlock(privateKeyFilename)
+	return result, nil
+}
+
+// LoadCertificates parses all certificates of a PEM bundle in the order they appear in the file
+func LoadCertificates(filename string) ([]*x509.Certificate, error) {
+	raw, error := ioutil.ReadFile(filename)
 	if error != nil {
 		return nil, error
 	}
 
-	if block == nil || block.Type != "RSA PRIVATE KEY" {
-		return nil, fmt.Errorf("wrong private key format in '%s'", privateKeyFilename)
-	}
-
-	result.PrivateKey, error = x509.ParsePKCS1PrivateKey(block.Bytes)
+	result, error := ParseCertificates(raw)
 	if error != nil {
 		return nil, error
 	}
 
+	if len(result) == 0 {
+		return nil, fmt.Errorf("no certificates found in '%s'", filename)
+	}
+
 	return result, nil
 }
 
-func newTemplate(validityPeriod int, commonName, organization string) (*x509.Certificate, error) {
+// ParseCertificates parses all certificates of PEM encoded content
+func ParseCertificates(raw []byte) ([]*x509.Certificate, error) {
+	result := []*x509.Certificate{}
+
+	for {
+		var block *pem.Block
+
+		block, raw = pem.Decode(raw)
+		if block == nil {
+			break
+		}
+
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+
+		certificate, error := x509.ParseCertificate(block.Bytes)
+		if error != nil {
+			return nil, error
+		}
+
+		result = append(result, certificate)
+	}
+
+	return result, nil
+}
+
+// SaveCertificates writes the certificates as one PEM bundle
+func SaveCertificates(filename string, certificates []*x509.Certificate) error {
+	content := []byte{}
+
+	for _, certificate := range certificates {
+		content = append(content, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certificate.Raw})...)
+	}
+
+	if error := ioutil.WriteFile(filename, content, 0644); error != nil {
+		return error
+	}
+
+	utils.LogFilename("Generated", filename)
+
+	return nil
+}
+
+func newTemplate(notAfter time.Time, commonName string, organizations []string) (*x509.Certificate, error) {
 	serialNumber, error := newBigInt()
 	if error != nil {
 		return nil, error
@@ -127,39 +184,50 @@ func newTemplate(validityPeriod int, commonName, organization string) (*x509.Cer
 		SubjectKeyId: subjectKeyId,
 		Subject: pkix.Name{
 			CommonName:   commonName,
-			Organization: []string{organization},
+			Organization: organizations,
 		},
 		NotBefore: now.Add(-5 * time.Minute),
-		NotAfter:  now.AddDate(validityPeriod, 0, 0),
+		NotAfter:  notAfter,
 	}
 
 	return template, nil
 }
 
-func createAndSaveCertificate(signer *CertificateAndPrivateKey, template *x509.Certificate, rsaSize int, certificateFilename, privateKeyFilename string) error {
+func createAndSaveCertificate(signer *CertificateAndPrivateKey, template *x509.Certificate, keyOptions KeyOptions, certificateFilename, privateKeyFilename string) error {
 	var error error
 
-	privateKey, error := rsa.GenerateKey(rand.Reader, rsaSize)
+	privateKey, error := generateKey(keyOptions)
 	if error != nil {
 		return error
 	}
 
+	chain := []*x509.Certificate{}
+
 	if signer == nil {
 		signer = &CertificateAndPrivateKey{Certificate: template, PrivateKey: privateKey}
+
+	} else if signer.PrivateKey == nil {
+		return fmt.Errorf("the private key of '%s' is not available, '%s' has to be signed externally", signer.CertificateFilename, certificateFilename)
+
+	} else {
+		chain = signer.Chain
 	}
 
-	certificateData, error := x509.CreateCertificate(rand.Reader, template, signer.Certificate, &privateKey.PublicKey, signer.PrivateKey)
+	certificateData, error := x509.CreateCertificate(rand.Reader, template, signer.Certificate, privateKey.Public(), signer.PrivateKey)
 	if error != nil {
 		return error
 	}
 
-	certificatePEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certificateData})
+	certificatePEM := append(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certificateData}), encodeCertificates(chain)...)
 
 	if error := ioutil.WriteFile(certificateFilename, certificatePEM, 0644); error != nil {
 		return error
 	}
 
-	privateKeyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(privateKey)})
+	privateKeyPEM, error := encodePrivateKey(privateKey)
+	if error != nil {
+		return error
+	}
 
 	if error := ioutil.WriteFile(privateKeyFilename, privateKeyPEM, 0644); error != nil {
 		return error
@@ -171,15 +239,15 @@ func createAndSaveCertificate(signer *CertificateAndPrivateKey, template *x509.C
 	return nil
 }
 
-func GenerateCA(rsaSize uint16, validityPeriod uint, commonName, organization, certificateFilename, privateKeyFilename string) error {
-	if utils.FileExists(certificateFilename) && utils.FileExists(privateKeyFilename) {
+func GenerateCA(keyOptions KeyOptions, validityPeriod uint, commonName, organization, certificateFilename, privateKeyFilename string, force bool) error {
+	if utils.FileExists(certificateFilename) && utils.FileExists(privateKeyFilename) && !force {
 		utils.LogFilename("Skipped", certificateFilename)
 		utils.LogFilename("Skipped", privateKeyFilename)
 
 		return nil
 	}
 
-	template, error := newTemplate(int(validityPeriod), commonName, organization)
+	template, error := newTemplate(time.Now().AddDate(int(validityPeriod), 0, 0), commonName, []string{organization})
 	if error != nil {
 		return error
 	}
@@ -189,10 +257,10 @@ func GenerateCA(rsaSize uint16, validityPeriod uint, commonName, organization, c
 	template.IsCA = true
 	template.MaxPathLen = 2
 
-	return createAndSaveCertificate(nil, template, int(rsaSize), certificateFilename, privateKeyFilename)
+	return createAndSaveCertificate(nil, template, keyOptions, certificateFilename, privateKeyFilename)
 }
 
-func GenerateClient(signer *CertificateAndPrivateKey, rsaSize uint16, validityPeriod uint, commonName, organization string, dnsNames []string, ipAddresses []string, certificateFilename, privateKeyFilename string, force bool) error {
+func GenerateClient(signer *CertificateAndPrivateKey, keyOptions KeyOptions, validityPeriod uint, commonName, organization string, dnsNames []string, ipAddresses []string, certificateFilename, privateKeyFilename string, force bool) error {
 	if utils.FileExists(certificateFilename) && utils.FileExists(privateKeyFilename) && !force {
 		utils.LogFilename("Skipped", certificateFilename)
 		utils.LogFilename("Skipped", privateKeyFilename)
@@ -200,12 +268,12 @@ func GenerateClient(signer *CertificateAndPrivateKey, rsaSize uint16, validityPe
 		return nil
 	}
 
-	template, error := newTemplate(int(validityPeriod), commonName, organization)
+	template, error := newTemplate(time.Now().AddDate(int(validityPeriod), 0, 0), commonName, []string{organization})
 	if error != nil {
 		return error
 	}
 
-	template.KeyUsage = x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature
+	template.KeyUsage = getKeyUsage(keyOptions)
 	template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth}
 
 	template.IPAddresses = []net.IP{}
@@ -222,5 +290,29 @@ func GenerateClient(signer *CertificateAndPrivateKey, rsaSize uint16, validityPe
 
 	template.DNSNames = dnsNames
 
-	return createAndSaveCertificate(signer, template, int(rsaSize), certificateFilename, privateKeyFilename)
+	return createAndSaveCertificate(signer, template, keyOptions, certificateFilename, privateKeyFilename)
+}
+
+// GenerateUser issues a client certificate for a user valid for the given duration. The groups are stored as organizations.
+func GenerateUser(signer *CertificateAndPrivateKey, keyOptions KeyOptions, validity time.Duration, name string, groups []string, certificateFilename, privateKeyFilename string) error {
+	template, error := newTemplate(time.Now().Add(validity), name, groups)
+	if error != nil {
+		return error
+	}
+
+	template.KeyUsage = getKeyUsage(keyOptions)
+	template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+
+	return createAndSaveCertificate(signer, template, keyOptions, certificateFilename, privateKeyFilename)
+}
+
+func getKeyUsage(keyOptions KeyOptions) x509.KeyUsage {
+	result := x509.KeyUsageDigitalSignature
+
+	// Key encipherment is only used by RSA key exchanges
+	if keyOptions.Algorithm == utils.KeyAlgorithmRSA {
+		result |= x509.KeyUsageKeyEncipherment
+	}
+
+	return result
 }
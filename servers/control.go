@@ -0,0 +1,184 @@
+package servers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// controlResult is the answer of the control API to actions and failed requests
+type controlResult struct {
+	Message string `json:"message,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// controlServer serves the local control API of 'k8s-tew run' on a unix socket. Only root can connect to it.
+//
+//	GET  /status                  the servers, the commands and the config version
+//	POST /servers/<name>/restart  restart a server
+//	POST /commands/<name>/run     execute a command again
+//	POST /reload                  load the config again and apply the changes to the servers
+type controlServer struct {
+	servers  *Servers
+	filename string
+	server   *http.Server
+}
+
+func newControlServer(servers *Servers, filename string) (*controlServer, error) {
+	// Remove the socket left behind by a previous run
+	if error := os.Remove(filename); error != nil && !os.IsNotExist(error) {
+		return nil, error
+	}
+
+	listener, error := net.Listen("unix", filename)
+	if error != nil {
+		return nil, error
+	}
+
+	if error := os.Chmod(filename, 0600); error != nil {
+		listener.Close()
+
+		return nil, error
+	}
+
+	control := &controlServer{servers: servers, filename: filename}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/status", control.handleStatus)
+	mux.HandleFunc("/servers/", control.handleServer)
+	mux.HandleFunc("/commands/", control.handleCommand)
+	mux.HandleFunc("/reload", control.handleReload)
+
+	control.server = &http.Server{Handler: mux}
+
+	go func() {
+		if error := control.server.Serve(listener); error != nil && error != http.ErrServerClosed {
+			log.WithFields(log.Fields{"filename": filename, "error": error}).Error("Control api failed")
+		}
+	}()
+
+	log.WithFields(log.Fields{"filename": filename}).Info("Serving control api")
+
+	return control, nil
+}
+
+func (control *controlServer) Close() {
+	control.server.Close()
+
+	os.Remove(control.filename)
+}
+
+func (control *controlServer) handleStatus(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet {
+		writeJSON(writer, http.StatusMethodNotAllowed, controlResult{Error: "method not allowed"})
+
+		return
+	}
+
+	status := control.servers.getStatus()
+	status.Running = true
+	status.SetUptimes()
+
+	writeJSON(writer, http.StatusOK, status)
+}
+
+func (control *controlServer) handleServer(writer http.ResponseWriter, request *http.Request) {
+	name, action := getControlPath(request.URL.Path, "/servers/")
+
+	if action != "restart" {
+		writeJSON(writer, http.StatusNotFound, controlResult{Error: "not found"})
+
+		return
+	}
+
+	if request.Method != http.MethodPost {
+		writeJSON(writer, http.StatusMethodNotAllowed, controlResult{Error: "method not allowed"})
+
+		return
+	}
+
+	if control.servers.getServer(name) == nil {
+		writeJSON(writer, http.StatusNotFound, controlResult{Error: fmt.Sprintf("server '%s' not found", name)})
+
+		return
+	}
+
+	if error := control.servers.RestartServer(name); error != nil {
+		writeJSON(writer, http.StatusConflict, controlResult{Error: error.Error()})
+
+		return
+	}
+
+	writeJSON(writer, http.StatusOK, controlResult{Message: fmt.Sprintf("server '%s' restarted", name)})
+}
+
+func (control *controlServer) handleCommand(writer http.ResponseWriter, request *http.Request) {
+	name, action := getControlPath(request.URL.Path, "/commands/")
+
+	if action != "run" {
+		writeJSON(writer, http.StatusNotFound, controlResult{Error: "not found"})
+
+		return
+	}
+
+	if request.Method != http.MethodPost {
+		writeJSON(writer, http.StatusMethodNotAllowed, controlResult{Error: "method not allowed"})
+
+		return
+	}
+
+	if len(control.servers.getCommandState(name)) == 0 {
+		writeJSON(writer, http.StatusNotFound, controlResult{Error: fmt.Sprintf("command '%s' not found", name)})
+
+		return
+	}
+
+	if error := control.servers.RerunCommand(name); error != nil {
+		writeJSON(writer, http.StatusConflict, controlResult{Error: error.Error()})
+
+		return
+	}
+
+	writeJSON(writer, http.StatusAccepted, controlResult{Message: fmt.Sprintf("command '%s' started", name)})
+}
+
+func (control *controlServer) handleReload(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodPost {
+		writeJSON(writer, http.StatusMethodNotAllowed, controlResult{Error: "method not allowed"})
+
+		return
+	}
+
+	if error := control.servers.Reload(); error != nil {
+		writeJSON(writer, http.StatusInternalServerError, controlResult{Error: error.Error()})
+
+		return
+	}
+
+	writeJSON(writer, http.StatusOK, controlResult{Message: "config reloaded"})
+}
+
+// getControlPath splits '<prefix><name>/<action>' into name and action
+func getControlPath(path, prefix string) (string, string) {
+	tokens := strings.Split(strings.TrimPrefix(path, prefix), "/")
+
+	if len(tokens) != 2 || len(tokens[0]) == 0 {
+		return "", ""
+	}
+
+	return tokens[0], tokens[1]
+}
+
+func writeJSON(writer http.ResponseWriter, code int, value interface{}) {
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(code)
+
+	if error := json.NewEncoder(writer).Encode(value); error != nil {
+		log.WithFields(log.Fields{"error": error}).Debug("Could not write control api response")
+	}
+}
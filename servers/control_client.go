@@ -0,0 +1,84 @@
+package servers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/darxkies/k8s-tew/config"
+	"github.com/darxkies/k8s-tew/utils"
+	"github.com/pkg/errors"
+)
+
+// ControlClient talks to the control API of 'k8s-tew run' on the same node
+type ControlClient struct {
+	client *http.Client
+}
+
+func NewControlClient(filename string) *ControlClient {
+	dialer := &net.Dialer{}
+
+	transport := &http.Transport{
+		DialContext: func(_context context.Context, _, _ string) (net.Conn, error) {
+			return dialer.DialContext(_context, "unix", filename)
+		},
+	}
+
+	return &ControlClient{client: &http.Client{Transport: transport, Timeout: utils.ControlTimeout * time.Second}}
+}
+
+// Status returns the status of the servers and the commands
+func (client *ControlClient) Status() (*config.ServersStatus, error) {
+	status := &config.ServersStatus{}
+
+	if error := client.request(http.MethodGet, "/status", status); error != nil {
+		return nil, error
+	}
+
+	return status, nil
+}
+
+func (client *ControlClient) RestartServer(name string) error {
+	return client.request(http.MethodPost, fmt.Sprintf("/servers/%s/restart", name), nil)
+}
+
+func (client *ControlClient) RerunCommand(name string) error {
+	return client.request(http.MethodPost, fmt.Sprintf("/commands/%s/run", name), nil)
+}
+
+func (client *ControlClient) Reload() error {
+	return client.request(http.MethodPost, "/reload", nil)
+}
+
+func (client *ControlClient) request(method, path string, result interface{}) error {
+	request, error := http.NewRequest(method, "http://k8s-tew"+path, nil)
+	if error != nil {
+		return error
+	}
+
+	response, error := client.client.Do(request)
+	if error != nil {
+		return fmt.Errorf("Could not connect to 'k8s-tew run' (%s)", error.Error())
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode >= http.StatusBadRequest {
+		_result := controlResult{}
+
+		if error := json.NewDecoder(response.Body).Decode(&_result); error != nil || len(_result.Error) == 0 {
+			return fmt.Errorf("Request failed (%s)", response.Status)
+		}
+
+		return errors.New(_result.Error)
+	}
+
+	if result == nil {
+		return nil
+	}
+
+	return json.NewDecoder(response.Body).Decode(result)
+}
@@ -0,0 +1,317 @@
+package servers
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"log/syslog"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/darxkies/k8s-tew/config"
+	"github.com/darxkies/k8s-tew/utils"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const logBackupTimeFormat = "20060102-150405.000"
+
+// Delay before a failed rotation is tried again, the server keeps writing to the current file meanwhile
+const logRotateRetryInterval = time.Minute
+
+// logWriter writes the output of a server to its log file and rotates the file, the server keeps writing to the
+// same pipe. Complete lines are optionally forwarded to journald or syslog.
+type logWriter struct {
+	mutex       sync.Mutex
+	name        string
+	config      config.LoggerConfig
+	file        *os.File
+	size        int64
+	openedAt    time.Time
+	retryAt     time.Time
+	writeFailed bool
+	forwarder   func(line string) error
+	buffer      bytes.Buffer
+	closers     []io.Closer
+}
+
+func newLogWriter(name string, loggerConfig config.LoggerConfig) (*logWriter, error) {
+	writer := &logWriter{name: name, config: loggerConfig, closers: []io.Closer{}}
+
+	switch loggerConfig.Forward {
+	case utils.LoggerForwardSyslog:
+		syslogWriter, error := syslog.New(syslog.LOG_INFO|syslog.LOG_DAEMON, name)
+		if error != nil {
+			return nil, fmt.Errorf("Could not connect to syslog (%s)", error.Error())
+		}
+
+		writer.forwarder = syslogWriter.Info
+		writer.closers = append(writer.closers, syslogWriter)
+
+	case utils.LoggerForwardJournald:
+		connection, error := net.Dial("unixgram", utils.JournaldSocket)
+		if error != nil {
+			return nil, fmt.Errorf("Could not connect to journald (%s)", error.Error())
+		}
+
+		writer.forwarder = newJournaldForwarder(connection, name)
+		writer.closers = append(writer.closers, connection)
+	}
+
+	if loggerConfig.Enabled {
+		if error := writer.open(); error != nil {
+			writer.Close()
+
+			return nil, error
+		}
+	}
+
+	return writer, nil
+}
+
+// newJournaldForwarder sends the lines using the native protocol of journald
+func newJournaldForwarder(connection net.Conn, name string) func(line string) error {
+	return func(line string) error {
+		_, error := fmt.Fprintf(connection, "SYSLOG_IDENTIFIER=%s\nPRIORITY=6\nMESSAGE=%s\n", name, line)
+
+		return error
+	}
+}
+
+func (writer *logWriter) open() error {
+	file, size, error := openLogFile(writer.config.Filename)
+	if error != nil {
+		return error
+	}
+
+	writer.file = file
+	writer.size = size
+	writer.openedAt = time.Now()
+
+	return nil
+}
+
+func openLogFile(filename string) (*os.File, int64, error) {
+	file, error := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if error != nil {
+		return nil, 0, fmt.Errorf("Could not open log file '%s' (%s)", filename, error.Error())
+	}
+
+	info, error := file.Stat()
+	if error != nil {
+		file.Close()
+
+		return nil, 0, error
+	}
+
+	return file, info.Size(), nil
+}
+
+func (writer *logWriter) needsRotation(length int) bool {
+	if time.Now().Before(writer.retryAt) {
+		return false
+	}
+
+	if writer.size > 0 && writer.size+int64(length) > int64(writer.config.GetMaxSize())*1024*1024 {
+		return true
+	}
+
+	return writer.config.Interval > 0 && time.Since(writer.openedAt) >= time.Duration(writer.config.Interval)*time.Hour
+}
+
+// Write never fails, an error would make exec stop copying the output and the server would block on a full pipe
+func (writer *logWriter) Write(data []byte) (int, error) {
+	writer.mutex.Lock()
+	defer writer.mutex.Unlock()
+
+	if writer.forwarder != nil {
+		writer.forward(data)
+	}
+
+	if writer.file == nil {
+		return len(data), nil
+	}
+
+	if writer.needsRotation(len(data)) {
+		if error := writer.rotate(); error != nil {
+			writer.retryAt = time.Now().Add(logRotateRetryInterval)
+
+			log.WithFields(log.Fields{"name": writer.name, "filename": writer.config.Filename, "error": error}).Error("Could not rotate log file")
+		}
+	}
+
+	count, error := writer.file.Write(data)
+
+	writer.size += int64(count)
+
+	// Only the first of consecutive failures is logged
+	if error != nil && !writer.writeFailed {
+		log.WithFields(log.Fields{"name": writer.name, "filename": writer.config.Filename, "error": error}).Error("Could not write log file")
+	}
+
+	writer.writeFailed = error != nil
+
+	return len(data), nil
+}
+
+// forward sends the complete lines and keeps the rest for the next write
+func (writer *logWriter) forward(data []byte) {
+	writer.buffer.Write(data)
+
+	for {
+		index := bytes.IndexByte(writer.buffer.Bytes(), '\n')
+		if index < 0 {
+			break
+		}
+
+		line := string(writer.buffer.Next(index + 1))
+
+		if error := writer.forwarder(strings.TrimRight(line, "\r\n")); error != nil {
+			log.WithFields(log.Fields{"name": writer.name, "forward": writer.config.Forward, "error": error}).Debug("Could not forward log line")
+		}
+	}
+}
+
+// rotate renames the log file, opens a new one and compresses and prunes the backups in the background. The current file
+// is only closed once the new one is open. If the rotation fails, the current file is renamed back and kept.
+func (writer *logWriter) rotate() error {
+	backup := fmt.Sprintf("%s.%s", writer.config.Filename, time.Now().Format(logBackupTimeFormat))
+
+	if error := os.Rename(writer.config.Filename, backup); error != nil {
+		return error
+	}
+
+	file, size, error := openLogFile(writer.config.Filename)
+	if error != nil {
+		if _error := os.Rename(backup, writer.config.Filename); _error != nil {
+			log.WithFields(log.Fields{"name": writer.name, "filename": backup, "error": _error}).Error("Could not restore log file")
+		}
+
+		return error
+	}
+
+	if error := writer.file.Close(); error != nil {
+		log.WithFields(log.Fields{"name": writer.name, "filename": backup, "error": error}).Debug("Could not close log file")
+	}
+
+	writer.file = file
+	writer.size = size
+	writer.openedAt = time.Now()
+
+	go func() {
+		if writer.config.Compress {
+			if error := compressLogFile(backup); error != nil {
+				log.WithFields(log.Fields{"name": writer.name, "filename": backup, "error": error}).Error("Could not compress log file")
+			}
+		}
+
+		if error := pruneLogFiles(writer.config.Filename, writer.config.GetMaxBackups()); error != nil {
+			log.WithFields(log.Fields{"name": writer.name, "filename": writer.config.Filename, "error": error}).Error("Could not remove old log files")
+		}
+	}()
+
+	log.WithFields(log.Fields{"name": writer.name, "filename": backup}).Debug("Rotated log file")
+
+	return nil
+}
+
+func (writer *logWriter) Close() error {
+	writer.mutex.Lock()
+	defer writer.mutex.Unlock()
+
+	if writer.buffer.Len() > 0 && writer.forwarder != nil {
+		writer.forwarder(writer.buffer.String())
+
+		writer.buffer.Reset()
+	}
+
+	for _, closer := range writer.closers {
+		closer.Close()
+	}
+
+	writer.closers = nil
+
+	if writer.file == nil {
+		return nil
+	}
+
+	error := writer.file.Close()
+
+	writer.file = nil
+
+	return error
+}
+
+func compressLogFile(filename string) error {
+	in, error := os.Open(filename)
+	if error != nil {
+		return error
+	}
+
+	defer in.Close()
+
+	temporaryFilename := filename + ".gz.tmp"
+
+	out, error := os.OpenFile(temporaryFilename, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if error != nil {
+		return error
+	}
+
+	defer out.Close()
+
+	compressor := gzip.NewWriter(out)
+
+	if _, error := io.Copy(compressor, in); error != nil {
+		return error
+	}
+
+	if error := compressor.Close(); error != nil {
+		return error
+	}
+
+	if error := out.Close(); error != nil {
+		return error
+	}
+
+	if error := os.Rename(temporaryFilename, filename+".gz"); error != nil {
+		return error
+	}
+
+	return os.Remove(filename)
+}
+
+// pruneLogFiles removes the oldest backups of the log file, the timestamps in their names sort them by age
+func pruneLogFiles(filename string, maxBackups uint) error {
+	matches, error := filepath.Glob(filename + ".*")
+	if error != nil {
+		return error
+	}
+
+	backups := []string{}
+
+	for _, match := range matches {
+		if strings.HasSuffix(match, ".tmp") {
+			continue
+		}
+
+		backups = append(backups, match)
+	}
+
+	sort.Strings(backups)
+
+	for len(backups) > int(maxBackups) {
+		if error := os.Remove(backups[0]); error != nil && !os.IsNotExist(error) {
+			return error
+		}
+
+		backups = backups[1:]
+	}
+
+	return nil
+}
@@ -1,7 +1,12 @@
 package servers
 
+import "github.com/darxkies/k8s-tew/config"
+
 type Server interface {
 	Start() error
 	Stop()
+	Restart() error
+	Equal(other Server) bool
 	Name() string
+	Status() config.ServerStatus
 }
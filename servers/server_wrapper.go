@@ -6,7 +6,9 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"reflect"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
@@ -22,23 +24,40 @@ type ServerWrapper struct {
 	baseDirectory   string
 	command         []string
 	logger          config.LoggerConfig
+	restartPolicy   string
 	pathEnvironment string
 	started         bool
 	context         context.Context
 	cancel          context.CancelFunc
 	done            chan bool
+	restart         chan bool
+	cancelRun       context.CancelFunc
+	generation      uint64
+	restartRequest  uint64
+	supervising     bool
+	logWriter       *logWriter
+	mutex           sync.Mutex
+	status          config.ServerStatus
+	onChange        func()
 }
 
-func NewServerWrapper(_config config.InternalConfig, name string, serverConfig config.ServerConfig, pathEnvironment string) (Server, error) {
+// NewServerWrapper creates a supervised server. onChange is called whenever the status of the server changes.
+func NewServerWrapper(_config config.InternalConfig, name string, serverConfig config.ServerConfig, pathEnvironment string, onChange func()) (Server, error) {
 	var error error
 
+	if error = serverConfig.Validate(); error != nil {
+		return nil, error
+	}
+
 	serverConfig.Command, error = _config.ApplyTemplate("command", serverConfig.Command)
 
 	if error != nil {
 		return nil, error
 	}
 
-	server := &ServerWrapper{name: name, baseDirectory: _config.BaseDirectory, command: []string{serverConfig.Command}, logger: serverConfig.Logger, pathEnvironment: pathEnvironment}
+	server := &ServerWrapper{name: name, baseDirectory: _config.BaseDirectory, command: []string{serverConfig.Command}, logger: serverConfig.Logger, restartPolicy: serverConfig.GetRestartPolicy(), pathEnvironment: pathEnvironment, onChange: onChange}
+
+	server.status = config.ServerStatus{Name: name, State: utils.ServerStateStopped, RestartPolicy: server.restartPolicy}
 
 	server.logger.Filename, error = _config.ApplyTemplate("LoggingDirectory", server.logger.Filename)
 	if error != nil {
@@ -63,12 +82,10 @@ func NewServerWrapper(_config config.InternalConfig, name string, serverConfig c
 }
 
 func (server *ServerWrapper) Start() error {
-	if server.started {
+	if server.isStarted() {
 		return fmt.Errorf("%s already started", server.name)
 	}
 
-	server.stop = false
-
 	if server.logger.Enabled {
 		logsDirectory := filepath.Dir(server.logger.Filename)
 
@@ -77,63 +94,390 @@ func (server *ServerWrapper) Start() error {
 		}
 	}
 
-	log.WithFields(log.Fields{"name": server.Name(), "_command": strings.Join(server.command, " ")}).Info("Starting server")
+	if error := server.openLogWriter(); error != nil {
+		return error
+	}
+
+	log.WithFields(log.Fields{"name": server.Name(), "_command": strings.Join(server.command, " "), "restart-policy": server.restartPolicy}).Info("Starting server")
+
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
 
 	server.context, server.cancel = context.WithCancel(context.Background())
 	server.done = make(chan bool, 1)
-
+	server.restart = make(chan bool, 1)
+	server.stop = false
 	server.started = true
+	server.supervising = true
 
-	go func() {
-		for !server.stop {
-			command := exec.CommandContext(server.context, server.command[0], server.command[1:]...)
-			command.SysProcAttr = &syscall.SysProcAttr{
-				Setpgid: true,
-				Pgid:    0,
-			}
+	go server.supervise(server.done)
 
-			command.Env = os.Environ()
-			command.Env = append(command.Env, server.pathEnvironment)
+	return nil
+}
 
-			var logFile *os.File
-			var error error
+func (server *ServerWrapper) openLogWriter() error {
+	if !server.logger.Enabled && len(server.logger.Forward) == 0 {
+		return nil
+	}
 
-			if server.logger.Enabled {
-				logFile, error = os.OpenFile(server.logger.Filename, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
+	var error error
 
-				if error != nil {
-					log.WithFields(log.Fields{"filename": logFile, "error": error}).Error("Could not open file")
+	server.logWriter, error = newLogWriter(server.name, server.logger)
 
-					continue
-				}
+	return error
+}
 
-				command.Stdout = logFile
-				command.Stderr = logFile
-			}
+// supervise runs the server and restarts it according to the restart policy. The delay between restarts doubles up
+// to a maximum and is reset once the server runs longer than the maximum delay. Servers restarted too often within
+// the crash loop window are marked as degraded. The log writer is closed once the server is not restarted anymore.
+func (server *ServerWrapper) supervise(done chan bool) {
+	defer close(done)
 
-			defer func() {
-				if logFile != nil {
-					logFile.Close()
-				}
-			}()
+	defer func() {
+		if server.logWriter != nil {
+			server.logWriter.Close()
+		}
+	}()
+
+	backoff := time.Duration(0)
+	restarts := []time.Time{}
+
+	for !server.isStopping() {
+		startedAt := time.Now()
+
+		error := server.run()
+
+		if server.isStopping() {
+			break
+		}
+
+		exitCode, signal := getExitStatus(error)
+		exitedAt := time.Now().UTC().Truncate(time.Second)
+
+		// Restarts requested through the control API skip the restart policy and the backoff
+		if server.restartRequested() {
+			backoff = 0
+			restarts = []time.Time{}
 
-			error = command.Run()
+			server.updateStatus(func(status *config.ServerStatus) {
+				status.State = utils.ServerStateBackoff
+				status.PID = 0
+				status.Degraded = false
+				status.Restarts++
+				status.ExitedAt = &exitedAt
+				status.ExitCode = exitCode
+				status.Signal = signal
+				status.Error = ""
+			})
 
-			if !server.stop {
-				time.Sleep(time.Second)
+			log.WithFields(log.Fields{"name": server.name}).Info("Restarted server")
 
-				log.WithFields(log.Fields{"name": server.name, "error": error, "_command": strings.Join(server.command, " ")}).Error("Restarting server")
+			continue
+		}
+
+		if time.Since(startedAt) > utils.ServerBackoffMaximum*time.Second {
+			backoff = 0
+			restarts = []time.Time{}
+		}
+
+		if !server.shouldRestart(error) {
+			server.updateStatus(func(status *config.ServerStatus) {
+				status.State = utils.ServerStateExited
+				status.PID = 0
+				status.ExitedAt = &exitedAt
+				status.ExitCode = exitCode
+				status.Signal = signal
+				status.Error = getErrorMessage(error)
+			})
+
+			log.WithFields(log.Fields{"name": server.name, "error": error, "restart-policy": server.restartPolicy}).Warn("Server exited")
+
+			if server.leave() {
+				return
 			}
+
+			continue
+		}
+
+		backoff *= 2
+
+		if backoff == 0 {
+			backoff = utils.ServerBackoffInitial * time.Second
+		}
+
+		if backoff > utils.ServerBackoffMaximum*time.Second {
+			backoff = utils.ServerBackoffMaximum * time.Second
+		}
+
+		restarts = append(restarts, time.Now())
+
+		for len(restarts) > 0 && time.Since(restarts[0]) > utils.ServerCrashLoopWindow*time.Second {
+			restarts = restarts[1:]
+		}
+
+		degraded := len(restarts) >= utils.ServerCrashLoopRestarts
+
+		server.updateStatus(func(status *config.ServerStatus) {
+			status.State = utils.ServerStateBackoff
+			status.PID = 0
+			status.Degraded = degraded
+			status.Restarts++
+			status.ExitedAt = &exitedAt
+			status.ExitCode = exitCode
+			status.Signal = signal
+			status.Error = getErrorMessage(error)
+		})
+
+		fields := log.Fields{"name": server.name, "error": error, "backoff": backoff, "restarts": len(restarts), "_command": strings.Join(server.command, " ")}
+
+		if degraded {
+			log.WithFields(fields).Error("Server is crash looping")
+
+		} else {
+			log.WithFields(fields).Error("Restarting server")
 		}
 
-		close(server.done)
+		select {
+		case <-server.context.Done():
+		case <-server.restart:
+		case <-time.After(backoff):
+		}
+	}
+
+	server.updateStatus(func(status *config.ServerStatus) {
+		status.State = utils.ServerStateStopped
+		status.PID = 0
+	})
+}
+
+// run starts the server and waits for it to exit
+func (server *ServerWrapper) run() error {
+	_context, cancel := context.WithCancel(server.context)
+
+	defer cancel()
+
+	server.mutex.Lock()
+
+	server.cancelRun = cancel
+	server.generation++
+
+	// Wake ups sent to the backoff of the previous run are not needed anymore
+	select {
+	case <-server.restart:
+	default:
+	}
+
+	server.mutex.Unlock()
+
+	defer func() {
+		server.mutex.Lock()
+		server.cancelRun = nil
+		server.mutex.Unlock()
 	}()
 
+	command := exec.CommandContext(_context, server.command[0], server.command[1:]...)
+	command.SysProcAttr = &syscall.SysProcAttr{
+		Setpgid: true,
+		Pgid:    0,
+	}
+
+	command.Env = os.Environ()
+	command.Env = append(command.Env, server.pathEnvironment)
+
+	// The output goes through a pipe, so that the log file can be rotated while the server is running
+	if server.logWriter != nil {
+		command.Stdout = server.logWriter
+		command.Stderr = server.logWriter
+	}
+
+	if error := command.Start(); error != nil {
+		return error
+	}
+
+	startedAt := time.Now().UTC().Truncate(time.Second)
+
+	server.updateStatus(func(status *config.ServerStatus) {
+		status.State = utils.ServerStateRunning
+		status.PID = command.Process.Pid
+		status.StartedAt = &startedAt
+	})
+
+	// A server running longer than the maximum delay recovered
+	recovered := time.AfterFunc(utils.ServerBackoffMaximum*time.Second, func() {
+		server.updateStatus(func(status *config.ServerStatus) {
+			status.Degraded = false
+		})
+	})
+
+	error := command.Wait()
+
+	recovered.Stop()
+
+	return error
+}
+
+// Restart kills the server and starts it again right away. Servers that exited for good are started again.
+func (server *ServerWrapper) Restart() error {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	if !server.started || server.stop {
+		return fmt.Errorf("%s not started", server.name)
+	}
+
+	if !server.supervising {
+		// The supervisor gave up on the server according to the restart policy
+		<-server.done
+
+		if error := server.openLogWriter(); error != nil {
+			return error
+		}
+
+		server.done = make(chan bool, 1)
+		server.supervising = true
+
+		go server.supervise(server.done)
+
+	} else if server.cancelRun != nil {
+		// The request only applies to the current run, so that a run that crashed on its own does not take it
+		server.restartRequest = server.generation
+
+		server.cancelRun()
+
+	} else {
+		// Cut the backoff short
+		select {
+		case server.restart <- true:
+		default:
+		}
+	}
+
+	log.WithFields(log.Fields{"name": server.name}).Info("Restarting server")
+
 	return nil
 }
 
+// restartRequested returns true if a restart was requested for the run that just ended
+func (server *ServerWrapper) restartRequested() bool {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	return server.restartRequest == server.generation
+}
+
+// leave marks the supervisor as gone, so that later restart requests start a new one. It returns false if a restart
+// was requested in the meantime.
+func (server *ServerWrapper) leave() bool {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	select {
+	case <-server.restart:
+		return false
+
+	default:
+		server.supervising = false
+
+		return true
+	}
+}
+
+func (server *ServerWrapper) isStarted() bool {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	return server.started
+}
+
+func (server *ServerWrapper) isStopping() bool {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	return server.stop
+}
+
+// Equal returns true if the other server runs the same command with the same settings
+func (server *ServerWrapper) Equal(other Server) bool {
+	otherServer, ok := other.(*ServerWrapper)
+	if !ok {
+		return false
+	}
+
+	return server.name == otherServer.name && reflect.DeepEqual(server.command, otherServer.command) && server.logger == otherServer.logger && server.restartPolicy == otherServer.restartPolicy && server.pathEnvironment == otherServer.pathEnvironment
+}
+
+func (server *ServerWrapper) shouldRestart(error error) bool {
+	switch server.restartPolicy {
+	case utils.RestartPolicyNever:
+		return false
+
+	case utils.RestartPolicyOnFailure:
+		return error != nil
+	}
+
+	return true
+}
+
+func (server *ServerWrapper) updateStatus(update func(status *config.ServerStatus)) {
+	server.mutex.Lock()
+
+	update(&server.status)
+
+	server.mutex.Unlock()
+
+	if server.onChange != nil {
+		server.onChange()
+	}
+}
+
+func (server *ServerWrapper) Status() config.ServerStatus {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	return server.status
+}
+
+// getExitStatus returns the exit code or the signal that terminated the server
+func getExitStatus(error error) (*int, string) {
+	if error == nil {
+		exitCode := 0
+
+		return &exitCode, ""
+	}
+
+	exitError, ok := error.(*exec.ExitError)
+	if !ok {
+		return nil, ""
+	}
+
+	waitStatus, ok := exitError.Sys().(syscall.WaitStatus)
+	if !ok {
+		return nil, ""
+	}
+
+	if waitStatus.Signaled() {
+		return nil, waitStatus.Signal().String()
+	}
+
+	exitCode := waitStatus.ExitStatus()
+
+	return &exitCode, ""
+}
+
+func getErrorMessage(error error) string {
+	if error == nil {
+		return ""
+	}
+
+	return error.Error()
+}
+
 func (server *ServerWrapper) Stop() {
+	server.mutex.Lock()
+
 	if !server.started {
+		server.mutex.Unlock()
+
 		return
 	}
 
@@ -141,7 +485,11 @@ func (server *ServerWrapper) Stop() {
 
 	server.cancel()
 
-	<-server.done
+	done := server.done
+
+	server.mutex.Unlock()
+
+	<-done
 
 	log.WithFields(log.Fields{"name": server.name, "_command": strings.Join(server.command, " ")}).Info("Stopped server")
 }
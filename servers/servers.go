@@ -6,9 +6,12 @@ import (
 	"os"
 	"os/signal"
 	"path"
+	"sync"
 	"syscall"
 	"time"
 
+	"github.com/darxkies/k8s-tew/pkg/etcd"
+	"github.com/darxkies/k8s-tew/pkg/manifest"
 	"github.com/darxkies/k8s-tew/utils"
 	"github.com/pkg/errors"
 
@@ -18,21 +21,205 @@ import (
 )
 
 type Servers struct {
-	config  *config.InternalConfig
-	servers []Server
-	stop    bool
+	config         *config.InternalConfig
+	configVersion  string
+	servers        []Server
+	commands       []config.CommandStatus
+	commandRetries uint
+	stop           bool
+	mutex          sync.Mutex
+	actionMutex    sync.Mutex
 }
 
 func NewServers(_config *config.InternalConfig) *Servers {
-	return &Servers{config: _config, servers: []Server{}, stop: false}
+	return &Servers{config: _config, servers: []Server{}, commands: []config.CommandStatus{}, stop: false}
 }
 
-func (servers *Servers) add(server Server) {
-	servers.servers = append(servers.servers, server)
+// getStatus returns the status of all servers and commands
+func (servers *Servers) getStatus() *config.ServersStatus {
+	servers.mutex.Lock()
+	defer servers.mutex.Unlock()
+
+	status := config.NewServersStatus(servers.config.GetFullLocalAssetFilename(utils.ServersStatus), servers.config.Name)
+	status.ConfigVersion = servers.configVersion
+	status.Commands = append(status.Commands, servers.commands...)
+
+	for _, server := range servers.servers {
+		status.Servers = append(status.Servers, server.Status())
+	}
+
+	return status
+}
+
+// saveStatus writes the status of all servers, 'k8s-tew node status' reads it if 'k8s-tew run' is not running
+func (servers *Servers) saveStatus() {
+	status := servers.getStatus()
+
+	if error := utils.CreateDirectoryIfMissing(servers.getConfig().GetFullLocalAssetDirectory(utils.DirectoryVarRun)); error != nil {
+		log.WithFields(log.Fields{"error": error}).Warn("Could not save servers status")
+
+		return
+	}
+
+	if error := status.Save(); error != nil {
+		log.WithFields(log.Fields{"error": error}).Warn("Could not save servers status")
+	}
+}
+
+func (servers *Servers) getConfig() *config.InternalConfig {
+	servers.mutex.Lock()
+	defer servers.mutex.Unlock()
+
+	return servers.config
+}
+
+func (servers *Servers) getServers() []Server {
+	servers.mutex.Lock()
+	defer servers.mutex.Unlock()
+
+	return append([]Server{}, servers.servers...)
+}
+
+func (servers *Servers) getServer(name string) Server {
+	for _, server := range servers.getServers() {
+		if server.Name() == name {
+			return server
+		}
+	}
+
+	return nil
+}
+
+// createServers creates the servers enabled on this node without starting them
+func (servers *Servers) createServers(_config *config.InternalConfig) ([]Server, error) {
+	result := []Server{}
+
+	pathEnvironment := os.Getenv("PATH")
+	pathEnvironment = fmt.Sprintf("PATH=%s:%s", _config.GetFullLocalAssetDirectory(utils.DirectoryHostBinaries), pathEnvironment)
+
+	for _, serverConfig := range _config.Config.Servers {
+		if !serverConfig.Enabled {
+			continue
+		}
+
+		if !config.CompareLabels(_config.Node.Labels, serverConfig.Labels) {
+			continue
+		}
+
+		server, error := NewServerWrapper(*_config, serverConfig.Name, serverConfig, pathEnvironment, servers.saveStatus)
+
+		if error != nil {
+			return nil, errors.Wrapf(error, "server wrapper for '%s' failed", serverConfig.Name)
+		}
+
+		result = append(result, server)
+	}
+
+	return result, nil
 }
 
-func (servers *Servers) runCommand(command *config.Command, commandRetries uint, step, count int) error {
-	newCommand, error := servers.config.ApplyTemplate(command.Name, command.Command)
+// getCommands returns the commands executed on this node
+func (servers *Servers) getCommands(_config *config.InternalConfig) []*config.Command {
+	result := []*config.Command{}
+
+	for _, command := range _config.Config.Commands {
+		if !config.CompareLabels(_config.Node.Labels, command.Labels) {
+			continue
+		}
+
+		if !utils.HasOS(command.OS) {
+			continue
+		}
+
+		result = append(result, command)
+	}
+
+	return result
+}
+
+func (servers *Servers) setCommandState(name, state string, error error) {
+	servers.mutex.Lock()
+
+	for index := range servers.commands {
+		command := &servers.commands[index]
+
+		if command.Name != name {
+			continue
+		}
+
+		now := time.Now().UTC().Truncate(time.Second)
+
+		command.State = state
+		command.Error = getErrorMessage(error)
+
+		if state == utils.CommandStateRunning {
+			command.StartedAt = &now
+			command.FinishedAt = nil
+
+		} else {
+			command.FinishedAt = &now
+		}
+	}
+
+	servers.mutex.Unlock()
+
+	servers.saveStatus()
+}
+
+func (servers *Servers) getCommandState(name string) string {
+	servers.mutex.Lock()
+	defer servers.mutex.Unlock()
+
+	for _, command := range servers.commands {
+		if command.Name == name {
+			return command.State
+		}
+	}
+
+	return ""
+}
+
+func (servers *Servers) applyManifest(command *config.Command) error {
+	_config := servers.getConfig()
+
+	applier, error := manifest.NewApplier(_config)
+	if error != nil {
+		return error
+	}
+
+	statuses, error := applier.Apply(command.Name, command.GetFeature(), _config.GetFullLocalAssetFilename(command.Manifest), command.GetTimeout())
+	if error != nil {
+		statuses.Dump()
+
+		log.WithFields(log.Fields{"name": command.Name, "error": error}).Error("Manifest failed")
+	}
+
+	return error
+}
+
+// runCommand executes the command and records its state
+func (servers *Servers) runCommand(command *config.Command, commandRetries uint) error {
+	servers.setCommandState(command.Name, utils.CommandStateRunning, nil)
+
+	error := servers.executeCommand(command, commandRetries)
+
+	if error != nil {
+		servers.setCommandState(command.Name, utils.CommandStateFailed, error)
+
+		return error
+	}
+
+	servers.setCommandState(command.Name, utils.CommandStateSucceeded, nil)
+
+	return nil
+}
+
+func (servers *Servers) executeCommand(command *config.Command, commandRetries uint) error {
+	if len(command.Manifest) > 0 {
+		return servers.applyManifest(command)
+	}
+
+	newCommand, error := servers.getConfig().ApplyTemplate(command.Name, command.Command)
 	if error != nil {
 		return error
 	}
@@ -62,7 +249,7 @@ func (servers *Servers) runCommand(command *config.Command, commandRetries uint,
 }
 
 func (servers *Servers) Steps() int {
-	return len(servers.config.Config.Servers) + len(servers.config.Config.Commands) + 1
+	return len(servers.config.Config.Servers) + len(servers.getCommands(servers.config)) + 1
 }
 
 func (servers *Servers) extractEmbeddedFiles() error {
@@ -106,28 +293,29 @@ func (servers *Servers) Run(commandRetries uint) error {
 		return errors.Wrap(error, "extracting embedded files failed")
 	}
 
-	pathEnvironment := os.Getenv("PATH")
-	pathEnvironment = fmt.Sprintf("PATH=%s:%s", servers.config.GetFullLocalAssetDirectory(utils.DirectoryHostBinaries), pathEnvironment)
+	servers.commandRetries = commandRetries
 
-	// Add servers
-	for _, serverConfig := range servers.config.Config.Servers {
-		if !serverConfig.Enabled {
-			continue
-		}
+	if configVersion, error := servers.config.GetConfigVersion(); error == nil {
+		servers.configVersion = configVersion
+	}
 
-		if !config.CompareLabels(servers.config.Node.Labels, serverConfig.Labels) {
-			continue
-		}
+	// Add servers
+	_servers, error := servers.createServers(servers.config)
+	if error != nil {
+		return error
+	}
 
-		server, error := NewServerWrapper(*servers.config, serverConfig.Name, serverConfig, pathEnvironment)
+	servers.servers = _servers
 
-		if error != nil {
-			return errors.Wrapf(error, "server wrapper for '%s' failed", serverConfig.Name)
-		}
+	// Register commands
+	commands := servers.getCommands(servers.config)
 
-		servers.add(server)
+	for _, command := range commands {
+		servers.commands = append(servers.commands, config.CommandStatus{Name: command.Name, State: utils.CommandStatePending})
 	}
 
+	servers.saveStatus()
+
 	// Start servers
 	for _, server := range servers.servers {
 		if error := server.Start(); error != nil {
@@ -141,39 +329,39 @@ func (servers *Servers) Run(commandRetries uint) error {
 
 	// Register servers' stop
 	defer func() {
-		for _, server := range servers.servers {
+		// Wait for running actions
+		servers.actionMutex.Lock()
+		defer servers.actionMutex.Unlock()
+
+		for _, server := range servers.getServers() {
 			log.WithFields(log.Fields{"name": server.Name()}).Info("Stopping server")
 
 			server.Stop()
 		}
 
+		servers.saveStatus()
+
 		log.Info("Stopped all servers")
 	}()
 
-	go func() {
-		successful := true
-
-		// Register commands based on labels to be executed asynchronously
-		for index, command := range servers.config.Config.Commands {
-			if !config.CompareLabels(servers.config.Node.Labels, command.Labels) {
-				utils.IncreaseProgressStep()
-
-				continue
-			}
+	// Serve the control API
+	controlServer, error := newControlServer(servers, servers.config.GetFullLocalAssetFilename(utils.ControlSocket))
+	if error != nil {
+		return errors.Wrap(error, "control api failed")
+	}
 
-			if !utils.HasOS(command.OS) {
-				utils.IncreaseProgressStep()
+	defer controlServer.Close()
 
-				continue
-			}
+	go func() {
+		successful := true
 
-			if error := servers.runCommand(command, commandRetries, index+1, len(servers.config.Config.Commands)); error != nil {
+		// Execute commands asynchronously
+		for _, command := range commands {
+			if error := servers.runCommand(command, commandRetries); error != nil {
 				log.WithFields(log.Fields{"error": error}).Error("Cluster setup failed")
 
 				successful = false
 
-				servers.stop = true
-
 				break
 			}
 
@@ -187,6 +375,15 @@ func (servers *Servers) Run(commandRetries uint) error {
 		utils.HideProgress()
 	}()
 
+	// Take etcd snapshots periodically on the bootstrapper
+	stopSnapshots := make(chan struct{})
+
+	defer close(stopSnapshots)
+
+	if servers.config.Node.Labels.HasLabels([]string{utils.NodeBootstrapper}) {
+		go etcd.ScheduleSnapshots(servers.config, stopSnapshots)
+	}
+
 	// Wait for signals to stop
 	signals := make(chan os.Signal, 1)
 
@@ -198,3 +395,152 @@ func (servers *Servers) Run(commandRetries uint) error {
 
 	return nil
 }
+
+// RestartServer restarts a server right away
+func (servers *Servers) RestartServer(name string) error {
+	servers.actionMutex.Lock()
+	defer servers.actionMutex.Unlock()
+
+	server := servers.getServer(name)
+	if server == nil {
+		return fmt.Errorf("server '%s' not found", name)
+	}
+
+	return server.Restart()
+}
+
+// RerunCommand executes a command again in the background
+func (servers *Servers) RerunCommand(name string) error {
+	servers.actionMutex.Lock()
+	defer servers.actionMutex.Unlock()
+
+	var command *config.Command
+
+	for _, _command := range servers.getCommands(servers.getConfig()) {
+		if _command.Name == name {
+			command = _command
+
+			break
+		}
+	}
+
+	if command == nil {
+		return fmt.Errorf("command '%s' not found", name)
+	}
+
+	if servers.getCommandState(name) == utils.CommandStateRunning {
+		return fmt.Errorf("command '%s' is already running", name)
+	}
+
+	servers.setCommandState(name, utils.CommandStateRunning, nil)
+
+	log.WithFields(log.Fields{"name": name}).Info("Rerunning command")
+
+	go servers.runCommand(command, servers.commandRetries)
+
+	return nil
+}
+
+// Reload loads the config again. Removed servers are stopped, added servers are started and changed servers are
+// restarted. Commands that were added are only registered, they can be executed with RerunCommand.
+func (servers *Servers) Reload() error {
+	servers.actionMutex.Lock()
+	defer servers.actionMutex.Unlock()
+
+	_config := config.NewInternalConfig(servers.config.BaseDirectory)
+	_config.Name = servers.config.Name
+
+	if error := _config.Load(); error != nil {
+		return errors.Wrap(error, "loading config failed")
+	}
+
+	if _config.Node == nil {
+		return errors.New("current host not found in the list of nodes")
+	}
+
+	configVersion, error := _config.GetConfigVersion()
+	if error != nil {
+		return error
+	}
+
+	newServers, error := servers.createServers(_config)
+	if error != nil {
+		return error
+	}
+
+	oldServers := map[string]Server{}
+
+	for _, server := range servers.getServers() {
+		oldServers[server.Name()] = server
+	}
+
+	result := []Server{}
+	started := []Server{}
+	stopped := 0
+
+	for _, newServer := range newServers {
+		if oldServer, ok := oldServers[newServer.Name()]; ok {
+			delete(oldServers, newServer.Name())
+
+			if oldServer.Equal(newServer) {
+				result = append(result, oldServer)
+
+				continue
+			}
+
+			log.WithFields(log.Fields{"name": oldServer.Name()}).Info("Server changed")
+
+			oldServer.Stop()
+
+			stopped++
+		}
+
+		result = append(result, newServer)
+		started = append(started, newServer)
+	}
+
+	for _, oldServer := range oldServers {
+		log.WithFields(log.Fields{"name": oldServer.Name()}).Info("Stopping removed server")
+
+		oldServer.Stop()
+
+		stopped++
+	}
+
+	// Keep the state of the commands that are still executed on this node
+	commands := []config.CommandStatus{}
+	oldStates := servers.getStatus().Commands
+
+	for _, command := range servers.getCommands(_config) {
+		state := config.CommandStatus{Name: command.Name, State: utils.CommandStatePending}
+
+		for _, oldState := range oldStates {
+			if oldState.Name == command.Name {
+				state = oldState
+			}
+		}
+
+		commands = append(commands, state)
+	}
+
+	servers.mutex.Lock()
+	servers.config = _config
+	servers.configVersion = configVersion
+	servers.servers = result
+	servers.commands = commands
+	servers.mutex.Unlock()
+
+	for _, server := range started {
+		if error := server.Start(); error != nil {
+			log.WithFields(log.Fields{"name": server.Name(), "error": error}).Error("Server start failed")
+
+			return error
+		}
+	}
+
+	servers.saveStatus()
+
+	log.WithFields(log.Fields{"config-version": configVersion, "started": len(started), "stopped": stopped}).Info("Reloaded config")
+
+	return nil
+}
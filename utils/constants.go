@@ -59,6 +59,9 @@ const VersionTiller = "gcr.io/kubernetes-helm/tiller:v%s"
 const ProjectTitle = "Kubernetes - The Easier Way"
 const ClusterName = "k8s-tew"
 const RsaSize = 2048
+const KeyAlgorithmRSA = "rsa"
+const KeyAlgorithmECDSAP256 = "ecdsa-p256"
+const KeyAlgorithmECDSAP384 = "ecdsa-p384"
 const CaValidityPeriod = 20
 const ClientValidityPeriod = 15
 const BaseDirectory = "assets"
@@ -75,6 +78,51 @@ const Email = "k8s-tew@gmail.com"
 const DeploymentDirectory = "/"
 const IngressDomain = "k8s-tew.net"
 const IngressSubdomainWordpress = "wordpress"
+const Revisions = 3
+const PreflightMinimumDiskSpace = 10
+const PreflightMaximumTimeOffset = 2
+const AddonTimeout = 600
+const CARotationLegacy = "legacy"
+const CARotationTrust = "trust"
+const CARotationSwitch = "switch"
+const CARotationFinish = "finish"
+const EncryptionRotationAdd = "add"
+const EncryptionRotationPromote = "promote"
+const EncryptionRotationDrop = "drop"
+const RestartPolicyAlways = "always"
+const RestartPolicyOnFailure = "on-failure"
+const RestartPolicyNever = "never"
+const ServerBackoffInitial = 1
+const ServerBackoffMaximum = 60
+const ServerCrashLoopRestarts = 5
+const ServerCrashLoopWindow = 300
+const ServerStateRunning = "running"
+const ServerStateBackoff = "backoff"
+const ServerStateExited = "exited"
+const ServerStateStopped = "stopped"
+const CommandStatePending = "pending"
+const CommandStateRunning = "running"
+const CommandStateSucceeded = "succeeded"
+const CommandStateFailed = "failed"
+const ControlTimeout = 30
+const LoggerMaxSize = 100
+const LoggerMaxBackups = 5
+const LoggerForwardJournald = "journald"
+const LoggerForwardSyslog = "syslog"
+const JournaldSocket = "/run/systemd/journal/socket"
+const UserRoleView = "view"
+const UserRoleEdit = "edit"
+const UserRoleAdmin = "admin"
+const UserRoleClusterAdmin = "cluster-admin"
+const UserBindingPrefix = "k8s-tew-user"
+const EtcdClusterStateNew = "new"
+const EtcdClusterStateExisting = "existing"
+const EtcdSnapshotRetention = 7
+const EtcdSnapshotStorageLocal = "local"
+const EtcdSnapshotStorageMinio = "minio"
+const MinioAccessKeyLength = 20
+const MinioSecretKeyLength = 40
+const MinioEtcdSnapshotsBucket = "etcd-snapshots"
 
 // Ports
 const PortVipRaftController uint16 = 16277
@@ -82,6 +130,9 @@ const PortVipRaftWorker uint16 = 16728
 const PortLoadBalancer uint16 = 16443
 const PortKubernetesDashboard uint16 = 32443
 const PortApiServer uint16 = 6443
+const PortEtcdClient uint16 = 2379
+const PortEtcdPeer uint16 = 2380
+const PortKubelet uint16 = 10250
 const PortCephManager uint16 = 30700
 const PortCephRadosGateway uint16 = 30750
 const PortMinio uint16 = 30800
@@ -111,6 +162,20 @@ const VeleroDownloadUrl = "https://github.com/heptio/velero/releases/download/{{
 
 // Config
 const ConfigFilename = "config.yaml"
+const DeploymentHistory = "deployment-history.yaml"
+const DeploymentChecksums = "deployment-checksums.yaml"
+const DeploymentManifest = "deployment-manifest.sha256"
+const RevisionAddedFiles = "added-files"
+const ResetReport = "reset-report.yaml"
+const DeploymentReport = "deployment-report.yaml"
+const UpgradeState = "upgrade-state.yaml"
+const EncryptionRotationState = "encryption-rotation-state.yaml"
+const CARotationState = "ca-rotation-state.yaml"
+const EtcdMembers = "etcd-members.yaml"
+const EtcdCaMigration = "etcd-ca-migration"
+const Users = "users.yaml"
+const ServersStatus = "servers-status.yaml"
+const ControlSocket = "control.sock"
 
 // Node Labels
 const NodeBootstrapper = "bootstrapper"
@@ -127,6 +192,17 @@ const FeatureShowcase = "showcase"
 const FeatureIngress = "ingress"
 const FeaturePackaging = "packaging"
 
+// Addon Labels
+const LabelAddon = "k8s-tew/addon"
+const LabelFeature = "k8s-tew/feature"
+const LabelApplySet = "k8s-tew/apply-set"
+
+// Hook Phases
+const HookPreUpload = "pre-upload"
+const HookPostUpload = "post-upload"
+const HookPreSetup = "pre-setup"
+const HookPostSetup = "post-setup"
+
 // OS
 const OsUbuntu = "ubuntu"
 const OsUbuntu1804 = "ubuntu/18.04"
@@ -173,6 +249,10 @@ const SubdirectoryHost = "host"
 const SubdirectoryPlugins = "plugins"
 const SubdirectoryCsiCephfsPlugin = "csi-cephfsplugin"
 const SubdirectoryCsiRbdPlugin = "csi-rbdplugin"
+const SubdirectoryRevisions = "revisions"
+const SubdirectoryStaging = "staging"
+const SubdirectoryEtcdSnapshots = "etcd-snapshots"
+const SubdirectoryUsers = "users"
 
 // Directories
 const DirectoryConfig = "config"
@@ -218,6 +298,10 @@ const DirectoryKubeletPlugins = "kubelet-plugins"
 const DirectoryKubeletPluginsRegistry = "kubelet-plugins-registry"
 const DirectoryVarRun = "var-run"
 const DirectoryRun = "run"
+const DirectoryRevisions = "revisions"
+const DirectoryStaging = "staging"
+const DirectoryEtcdSnapshots = "etcd-snapshots"
+const DirectoryUsers = "users"
 
 // Binaries
 const BinaryK8sTew = "k8s-tew"
@@ -237,6 +321,9 @@ const BinaryVelero = "velero"
 // Certificates
 const PemCa = "ca.pem"
 const PemCaKey = "ca-key.pem"
+const PemCaNext = "ca-next.pem"
+const PemCaNextKey = "ca-next-key.pem"
+const PemCaPrevious = "ca-previous.pem"
 const PemKubernetes = "kubernetes.pem"
 const PemKubernetesKey = "kubernetes-key.pem"
 const PemAdmin = "admin.pem"
@@ -255,6 +342,24 @@ const PemVirtualIp = "virtual-ip.pem"
 const PemVirtualIpKey = "virtual-ip-key.pem"
 const PemAggregator = "aggregator.pem"
 const PemAggregatorKey = "aggregator-key.pem"
+const PemEtcdCa = "etcd-ca.pem"
+const PemEtcdCaKey = "etcd-ca-key.pem"
+const PemEtcdCaNext = "etcd-ca-next.pem"
+const PemEtcdCaNextKey = "etcd-ca-next-key.pem"
+const PemEtcdCaPrevious = "etcd-ca-previous.pem"
+const PemEtcdCaBundle = "etcd-ca-bundle.pem"
+const PemEtcdServer = "etcd-server-{{.Name}}.pem"
+const PemEtcdServerKey = "etcd-server-{{.Name}}-key.pem"
+const PemEtcdPeer = "etcd-peer-{{.Name}}.pem"
+const PemEtcdPeerKey = "etcd-peer-{{.Name}}-key.pem"
+const PemEtcdClient = "etcd-client.pem"
+const PemEtcdClientKey = "etcd-client-key.pem"
+const PemFrontProxyCa = "front-proxy-ca.pem"
+const PemFrontProxyCaKey = "front-proxy-ca-key.pem"
+const PemFrontProxyCaNext = "front-proxy-ca-next.pem"
+const PemFrontProxyCaNextKey = "front-proxy-ca-next-key.pem"
+const PemFrontProxyCaPrevious = "front-proxy-ca-previous.pem"
+const PemOIDCCa = "oidc-ca.pem"
 
 // Kubeconfig
 const KubeconfigAdmin = "admin.kubeconfig"
@@ -327,6 +432,16 @@ const BashCompletionCrictl = "crictl.bash-completion"
 // Logging
 const AuditLog = "audit.log"
 
+// Audit
+const AuditPolicy = "audit-policy.yaml"
+const AuditWebhookConfig = "audit-webhook.kubeconfig"
+const AuditPolicyMinimal = "minimal"
+const AuditPolicyMetadata = "metadata"
+const AuditPolicyRequestResponse = "request-response"
+const AuditMaxAge = 30
+const AuditMaxSize = 100
+const AuditMaxBackups = 3
+
 // Deployment
 const DeploymentUser = "root"
 
@@ -363,6 +478,7 @@ const ElectionWorker = "/worker-vip-manager"
 // Common Names
 const CnAdmin = "admin"
 const CnAggregator = "aggregator"
+const CnEtcdClient = "kube-apiserver-etcd-client"
 const CnSystemKubeControllerManager = "system:kube-controller-manager"
 const CnSystemKubeScheduler = "system:kube-scheduler"
 const CnSystemKubeProxy = "system:kube-proxy"
@@ -377,7 +493,10 @@ const TemplateGobetweenToml = "k8s/lb/gobetween.toml"
 const TemplateKubeSchedulerConfiguration = "k8s/kube-scheduler-configuration.yaml"
 const TemplateKubeletConfiguration = "k8s/kubelet-configuration.yaml"
 const TemplateEncryptionConfig = "k8s/encryption-config.yaml"
+const TemplateAuditPolicy = "k8s/audit-policy.yaml"
+const TemplateAuditWebhookConfig = "k8s/audit-webhook-kubeconfig.yaml"
 const TemplateKubeconfig = "k8s/kubeconfig.yaml"
+const TemplateKubeconfigOIDC = "k8s/kubeconfig-oidc.yaml"
 const TemplateServiceAccount = "k8s/service-account.yaml"
 const TemplateKubeletSetup = "k8s/setup/kubelet-setup.yaml"
 const TemplateCephClientKeyring = "ceph/client.keyring"
@@ -424,3 +543,4 @@ const ControllerOnlyTaintKey = "node-role.kubernetes.io/master"
 const WorkerOnlyTaintKey = "node-role.kubernetes.io/worker"
 const StorageOnlyTaintKey = "node-role.kubernetes.io/storage"
 const ConcurrentSshConnectionsLimit = 10
+const SshDialTimeout = 30